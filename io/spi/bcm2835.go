@@ -0,0 +1,316 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// Offsets of the registers from the GPIO block, see the BCM2835 ARM
+// Peripherals datasheet. The mapping covers the GPIO and SPI0 blocks.
+const (
+	bcmGPIOOffset = 0x200000 // offset of the GPIO block from the peripherals
+	bcmMapSize    = 0x5000
+
+	bcmGPFSEL0 = 0x0000
+	bcmGPFSEL1 = 0x0004
+	bcmCS      = 0x4000
+	bcmFIFO    = 0x4004
+	bcmCLK     = 0x4008
+)
+
+// Bits of the SPI0 CS register.
+const (
+	bcmCPHA    = 1 << 2
+	bcmCPOL    = 1 << 3
+	bcmClearTX = 1 << 4
+	bcmClearRX = 1 << 5
+	bcmCSPOL   = 1 << 6
+	bcmTA      = 1 << 7 // transfer active
+	bcmDone    = 1 << 16
+	bcmRXD     = 1 << 17 // the RX FIFO is not empty
+	bcmTXD     = 1 << 18 // the TX FIFO is not full
+	bcmCSPOL0  = 1 << 21
+
+	bcmDefaultCoreClock = 250000000
+	bcmDefaultSpeed     = 1000000
+)
+
+// BCM2835 is an SPI driver for the SPI0 controller of the Broadcom
+// BCM2835 family of chips of the Raspberry Pi boards. It accesses the
+// registers of the controller directly through /dev/mem, which avoids
+// the cost of the system calls of DevFS on small transfers but requires
+// root privileges. The kernel SPI driver must not be enabled at the
+// same time, e.g. remove dtparam=spi=on from /boot/config.txt.
+//
+// Open sets the GPIO lines 7 to 11 to their SPI0 functions.
+// The bus number is ignored and chips 0 and 1 select CE0 and CE1.
+// Words are 8 bits, MSB first, and CSHigh is the only supported
+// mode flag.
+type BCM2835 struct {
+	// Base is the physical address of the peripherals, 0x20000000
+	// on the BCM2835, 0x3f000000 on the BCM2836 and BCM2837 and
+	// 0xfe000000 on the BCM2711. If zero, it is read from the
+	// device tree.
+	Base int64
+
+	// CoreClock is the frequency of the core clock in Hz, which is
+	// divided to produce the SPI clock. If zero, the default of
+	// 250MHz is used; it depends on core_freq in /boot/config.txt.
+	CoreClock int
+}
+
+// Open maps the registers of the controller and returns a connection.
+func (d *BCM2835) Open(bus, chip int) (driver.Conn, error) {
+	if chip < 0 || chip > 1 {
+		return nil, fmt.Errorf("invalid chip select: %d", chip)
+	}
+	r, err := d.mapRegisters()
+	if err != nil {
+		return nil, err
+	}
+	clock := d.CoreClock
+	if clock <= 0 {
+		clock = bcmDefaultCoreClock
+	}
+	c := newBCMConn(r, chip, clock)
+	c.init()
+	return c, nil
+}
+
+// bcmRegisters are the registers of the GPIO and SPI0 blocks,
+// indexed by their offsets.
+type bcmRegisters interface {
+	read(off int) uint32
+	write(off int, v uint32)
+	close() error
+}
+
+type bcmConn struct {
+	r     bcmRegisters
+	chip  int
+	clock int
+
+	mode     uint32
+	speed    uint32
+	delay    time.Duration
+	csChange bool
+
+	// active is whether the chip select was left asserted
+	// by the last transfer.
+	active bool
+}
+
+func newBCMConn(r bcmRegisters, chip, clock int) *bcmConn {
+	return &bcmConn{r: r, chip: chip, clock: clock, speed: bcmDefaultSpeed}
+}
+
+// init sets the SPI0 functions of the GPIO lines and resets the controller.
+func (c *bcmConn) init() {
+	// GPIO 7 to 9 are in GPFSEL0 and 10 and 11 in GPFSEL1,
+	// 3 bits per line; 4 is the alternate function 0.
+	sel0 := c.r.read(bcmGPFSEL0)
+	for n := uint(7); n <= 9; n++ {
+		sel0 = sel0&^(7<<(3*n)) | 4<<(3*n)
+	}
+	c.r.write(bcmGPFSEL0, sel0)
+	sel1 := c.r.read(bcmGPFSEL1)
+	for n := uint(0); n <= 1; n++ {
+		sel1 = sel1&^(7<<(3*n)) | 4<<(3*n)
+	}
+	c.r.write(bcmGPFSEL1, sel1)
+
+	c.r.write(bcmCS, c.csBits()|bcmClearTX|bcmClearRX)
+	c.r.write(bcmCLK, c.cdiv(c.speed))
+}
+
+// csBits returns the value of the CS register for the
+// mode and the chip select, with no transfer active.
+func (c *bcmConn) csBits() uint32 {
+	v := uint32(c.chip)
+	if c.mode&1 != 0 {
+		v |= bcmCPHA
+	}
+	if c.mode&2 != 0 {
+		v |= bcmCPOL
+	}
+	if c.mode&uint32(CSHigh) != 0 {
+		v |= bcmCSPOL | bcmCSPOL0<<uint(c.chip)
+	}
+	return v
+}
+
+// cdiv returns the clock divisor producing the highest frequency
+// not above speed Hz. The divisor must be even; 0 divides by 65536.
+func (c *bcmConn) cdiv(speed uint32) uint32 {
+	if speed == 0 {
+		speed = bcmDefaultSpeed
+	}
+	div := (c.clock + int(speed) - 1) / int(speed)
+	div += div & 1
+	if div < 2 {
+		div = 2
+	}
+	if div > 65535 {
+		return 0
+	}
+	return uint32(div)
+}
+
+func (c *bcmConn) Configure(k, v int) error {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		if v < 0 || Mode(v)&^(3|CSHigh) != 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.mode = uint32(v)
+		c.active = false
+		c.r.write(bcmCS, c.csBits()|bcmClearTX|bcmClearRX)
+	case driver.Bits:
+		if v != 8 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	case driver.Speed:
+		if v < 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.speed = uint32(v)
+		if c.speed == 0 {
+			c.speed = bcmDefaultSpeed
+		}
+		c.r.write(bcmCLK, c.cdiv(c.speed))
+	case driver.Order:
+		if v != 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	case driver.Delay:
+		if v < 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.delay = time.Duration(v) * time.Microsecond
+	case driver.TxNBits, driver.RxNBits:
+		if v != 0 && v != 1 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	case driver.CSChange:
+		c.csChange = v != 0
+	case driver.WordDelay:
+		if v != 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownKey, k)
+	}
+	return nil
+}
+
+func (c *bcmConn) Query(k int) (int, error) {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		return int(c.mode), nil
+	case driver.Bits:
+		return 8, nil
+	case driver.Speed:
+		// Report the frequency actually generated by the divisor.
+		div := int(c.cdiv(c.speed))
+		if div == 0 {
+			div = 65536
+		}
+		return c.clock / div, nil
+	case driver.Order:
+		return 0, nil
+	case driver.Delay:
+		return int(c.delay / time.Microsecond), nil
+	case driver.TxNBits, driver.RxNBits:
+		return 1, nil
+	case driver.CSChange:
+		if c.csChange {
+			return 1, nil
+		}
+		return 0, nil
+	case driver.WordDelay:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrUnknownKey, k)
+	}
+}
+
+func (c *bcmConn) Transfer(tx, rx []byte) error {
+	return c.TransferMany([]driver.Message{{Tx: tx, Rx: rx}})
+}
+
+// TransferMany performs the messages with the transfer active bit
+// of the controller set, which asserts the chip select. It is cleared
+// between the messages with CSChange set and at the end.
+func (c *bcmConn) TransferMany(msgs []driver.Message) error {
+	msgs = allocBuffers(msgs)
+	for i, m := range msgs {
+		if len(m.Rx) != len(m.Tx) {
+			return fmt.Errorf("message %d: rx length (%d) does not match tx length (%d)", i, len(m.Rx), len(m.Tx))
+		}
+		if m.Bits != 0 && m.Bits != 8 {
+			return fmt.Errorf("message %d: unsupported bits per word: %d", i, m.Bits)
+		}
+		if m.TxNBits > 1 || m.RxNBits > 1 {
+			return fmt.Errorf("message %d: unsupported number of lines", i)
+		}
+	}
+	cs := c.csBits()
+	for i, m := range msgs {
+		if m.Speed != 0 {
+			c.r.write(bcmCLK, c.cdiv(uint32(m.Speed)))
+		}
+		if !c.active {
+			c.r.write(bcmCS, cs|bcmClearTX|bcmClearRX)
+			c.r.write(bcmCS, cs|bcmTA)
+			c.active = true
+		}
+		c.shift(m.Tx, m.Rx)
+		if m.Speed != 0 {
+			c.r.write(bcmCLK, c.cdiv(c.speed))
+		}
+		last := i == len(msgs)-1
+		csChange := m.CSChange || c.csChange && !m.NoCSChange
+		if last != csChange {
+			c.r.write(bcmCS, cs)
+			c.active = false
+		}
+		delay := c.delay
+		if m.Delay != 0 {
+			delay = m.Delay
+		}
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+// shift writes tx to the TX FIFO while draining the RX FIFO to rx,
+// then waits for the controller to be done.
+func (c *bcmConn) shift(tx, rx []byte) {
+	for w, r := 0, 0; r < len(rx); {
+		for w < len(tx) && w-r < bcmFIFOSize && c.r.read(bcmCS)&bcmTXD != 0 {
+			c.r.write(bcmFIFO, uint32(tx[w]))
+			w++
+		}
+		for r < w && c.r.read(bcmCS)&bcmRXD != 0 {
+			rx[r] = byte(c.r.read(bcmFIFO))
+			r++
+		}
+	}
+	for c.r.read(bcmCS)&bcmDone == 0 {
+	}
+}
+
+// bcmFIFOSize is the size of the FIFOs. At most this many bytes are
+// written ahead of the bytes read so that the RX FIFO never overflows.
+const bcmFIFOSize = 64
+
+func (c *bcmConn) Close() error {
+	c.r.write(bcmCS, c.csBits()|bcmClearTX|bcmClearRX)
+	return c.r.close()
+}
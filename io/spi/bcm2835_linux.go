@@ -0,0 +1,77 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapRegisters maps the GPIO and SPI0 blocks from /dev/mem.
+func (d *BCM2835) mapRegisters() (bcmRegisters, error) {
+	base := d.Base
+	if base == 0 {
+		var err error
+		if base, err = peripheralBase("/proc/device-tree/soc/ranges"); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile("/dev/mem", os.O_RDWR|os.O_SYNC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mem, err := unix.Mmap(int(f.Fd()), base+bcmGPIOOffset, bcmMapSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("error mapping the peripherals: %w", err)
+	}
+	return &mmapRegisters{
+		mem:  mem,
+		regs: unsafe.Slice((*uint32)(unsafe.Pointer(&mem[0])), len(mem)/4),
+	}, nil
+}
+
+// peripheralBase returns the physical address of the peripherals
+// read from the ranges property of the soc node of the device tree.
+// Its second cell is the address, or its third cell if the parent
+// address has two cells, as on the BCM2711.
+func peripheralBase(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) < 12 {
+		return 0, fmt.Errorf("invalid soc ranges: % x", b)
+	}
+	base := binary.BigEndian.Uint32(b[4:])
+	if base == 0 && len(b) >= 16 {
+		base = binary.BigEndian.Uint32(b[8:])
+	}
+	return int64(base), nil
+}
+
+// mmapRegisters are registers mapped from /dev/mem. They are accessed
+// atomically so that the compiler doesn't elide or reorder the accesses.
+type mmapRegisters struct {
+	mem  []byte
+	regs []uint32
+}
+
+func (r *mmapRegisters) read(off int) uint32 {
+	return atomic.LoadUint32(&r.regs[off/4])
+}
+
+func (r *mmapRegisters) write(off int, v uint32) {
+	atomic.StoreUint32(&r.regs[off/4], v)
+}
+
+func (r *mmapRegisters) close() error {
+	return unix.Munmap(r.mem)
+}
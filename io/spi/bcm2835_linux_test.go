@@ -0,0 +1,38 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeripheralBase(t *testing.T) {
+	dir, err := os.MkdirTemp("", "spi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		ranges []byte
+		want   int64
+	}{
+		// Raspberry Pi 3.
+		{[]byte{0x7e, 0, 0, 0, 0x3f, 0, 0, 0, 0x01, 0, 0, 0}, 0x3f000000},
+		// Raspberry Pi 4, with a two cell parent address.
+		{[]byte{0x7e, 0, 0, 0, 0, 0, 0, 0, 0xfe, 0, 0, 0, 0x01, 0x80, 0, 0}, 0xfe000000},
+	}
+	for _, test := range tests {
+		p := filepath.Join(dir, "ranges")
+		if err := os.WriteFile(p, test.ranges, 0644); err != nil {
+			t.Fatal(err)
+		}
+		base, err := peripheralBase(p)
+		if err != nil || base != test.want {
+			t.Errorf("peripheralBase(% x)=%#x, %v, want %#x, nil", test.ranges, base, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package spi
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (d *BCM2835) mapRegisters() (bcmRegisters, error) {
+	return nil, fmt.Errorf("spi: bcm2835: %w %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
@@ -0,0 +1,261 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// fakeBCM emulates the GPIO and SPI0 registers of a BCM2835 with the
+// data out line of the controller tied to its data in line.
+type fakeBCM struct {
+	regs map[int]uint32
+	// fifo is the size of the emulated FIFOs.
+	fifo int
+	rx   []uint32
+	tx   []byte // bytes shifted out
+	// active records the changes of the transfer active bit.
+	active   []bool
+	overflow bool
+	closed   bool
+}
+
+func newFakeBCM() *fakeBCM {
+	return &fakeBCM{regs: make(map[int]uint32), fifo: 16}
+}
+
+func (f *fakeBCM) read(off int) uint32 {
+	switch off {
+	case bcmCS:
+		v := f.regs[bcmCS] | bcmDone
+		if len(f.rx) < f.fifo {
+			v |= bcmTXD
+		}
+		if len(f.rx) > 0 {
+			v |= bcmRXD
+		}
+		return v
+	case bcmFIFO:
+		if len(f.rx) == 0 {
+			return 0
+		}
+		v := f.rx[0]
+		f.rx = f.rx[1:]
+		return v
+	}
+	return f.regs[off]
+}
+
+func (f *fakeBCM) write(off int, v uint32) {
+	switch off {
+	case bcmCS:
+		if v&bcmClearRX != 0 {
+			f.rx = nil
+		}
+		v &^= bcmClearTX | bcmClearRX
+		if ta := v&bcmTA != 0; ta != (f.regs[bcmCS]&bcmTA != 0) {
+			f.active = append(f.active, ta)
+		}
+		f.regs[bcmCS] = v
+	case bcmFIFO:
+		if f.regs[bcmCS]&bcmTA == 0 {
+			return
+		}
+		if len(f.rx) >= f.fifo {
+			f.overflow = true
+			return
+		}
+		f.tx = append(f.tx, byte(v))
+		f.rx = append(f.rx, v&0xff)
+	default:
+		f.regs[off] = v
+	}
+}
+
+func (f *fakeBCM) close() error {
+	f.closed = true
+	return nil
+}
+
+func TestBCMInit(t *testing.T) {
+	f := newFakeBCM()
+	f.regs[bcmGPFSEL0] = 0x3f   // GPIO 0 and 1 are outputs.
+	f.regs[bcmGPFSEL1] = 7 << 6 // GPIO 12 uses function 3.
+	c := newBCMConn(f, 1, bcmDefaultCoreClock)
+	c.init()
+	if v, want := f.regs[bcmGPFSEL0], uint32(0x3f|0x124<<21); v != want {
+		t.Errorf("GPFSEL0=%#x, want %#x", v, want)
+	}
+	if v, want := f.regs[bcmGPFSEL1], uint32(7<<6|0x24); v != want {
+		t.Errorf("GPFSEL1=%#x, want %#x", v, want)
+	}
+	if cs := f.regs[bcmCS]; cs&3 != 1 {
+		t.Errorf("CS=%#x, want chip select 1", cs)
+	}
+	if div := f.regs[bcmCLK]; div != 250 {
+		t.Errorf("CLK=%d, want 250", div)
+	}
+	if s, err := c.Query(driver.Speed); err != nil || s != 1000000 {
+		t.Errorf("Query(Speed)=%d, %v, want 1000000, nil", s, err)
+	}
+	if err := c.Close(); err != nil || !f.closed {
+		t.Errorf("Close()=%v, closed=%t, want nil, true", err, f.closed)
+	}
+}
+
+func TestBCMConfigure(t *testing.T) {
+	f := newFakeBCM()
+	c := newBCMConn(f, 0, bcmDefaultCoreClock)
+	if err := c.Configure(driver.Speed, 7000000); err != nil {
+		t.Fatalf("Configure(Speed): %v", err)
+	}
+	// 250MHz/36 is the fastest clock not above 7MHz with an even divisor.
+	if div := f.regs[bcmCLK]; div != 36 {
+		t.Errorf("CLK=%d, want 36", div)
+	}
+	if s, err := c.Query(driver.Speed); err != nil || s != 6944444 {
+		t.Errorf("Query(Speed)=%d, %v, want 6944444, nil", s, err)
+	}
+	if err := c.Configure(driver.Speed, 1000); err != nil {
+		t.Fatalf("Configure(Speed): %v", err)
+	}
+	if div := f.regs[bcmCLK]; div != 0 {
+		t.Errorf("CLK=%d, want 0 for the slowest clock", div)
+	}
+
+	tests := []struct {
+		mode Mode
+		want uint32
+	}{
+		{Mode0, 0},
+		{Mode1, bcmCPHA},
+		{Mode2, bcmCPOL},
+		{Mode3, bcmCPOL | bcmCPHA},
+		{Mode0 | CSHigh, bcmCSPOL | bcmCSPOL0},
+	}
+	for _, test := range tests {
+		if err := c.Configure(driver.Mode, int(test.mode)); err != nil {
+			t.Errorf("Configure(Mode, %v): %v", test.mode, err)
+			continue
+		}
+		if cs := f.regs[bcmCS]; cs != test.want {
+			t.Errorf("mode %v: CS=%#x, want %#x", test.mode, cs, test.want)
+		}
+	}
+
+	errs := []struct{ k, v int }{
+		{driver.Mode, int(Mode0 | Loop)},
+		{driver.Bits, 16},
+		{driver.Order, 1},
+		{driver.TxNBits, 2},
+	}
+	for _, e := range errs {
+		if err := c.Configure(e.k, e.v); err == nil {
+			t.Errorf("Configure(%d, %d) succeeded, want error", e.k, e.v)
+		}
+	}
+}
+
+func TestBCMTransfer(t *testing.T) {
+	f := newFakeBCM()
+	c := newBCMConn(f, 0, bcmDefaultCoreClock)
+	tx := make([]byte, 200)
+	for i := range tx {
+		tx[i] = byte(i * 3)
+	}
+	rx := make([]byte, len(tx))
+	if err := c.Transfer(tx, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if f.overflow {
+		t.Errorf("RX FIFO overflowed")
+	}
+	if !bytes.Equal(f.tx, tx) {
+		t.Errorf("shifted out % x, want % x", f.tx, tx)
+	}
+	if !bytes.Equal(rx, tx) {
+		t.Errorf("rx=% x, want % x", rx, tx)
+	}
+	if want := []bool{true, false}; !reflect.DeepEqual(f.active, want) {
+		t.Errorf("transfer active changes=%v, want %v", f.active, want)
+	}
+}
+
+func TestBCMTransferNilTx(t *testing.T) {
+	f := newFakeBCM()
+	c := newBCMConn(f, 0, bcmDefaultCoreClock)
+	rx := bytes.Repeat([]byte{0xff}, 4)
+	if err := c.Transfer(nil, rx); err != nil {
+		t.Fatalf("Transfer(nil, rx): %v", err)
+	}
+	if want := make([]byte, len(rx)); !bytes.Equal(f.tx, want) {
+		t.Errorf("shifted out % x, want % x", f.tx, want)
+	}
+	if want := make([]byte, len(rx)); !bytes.Equal(rx, want) {
+		t.Errorf("rx=% x, want % x", rx, want)
+	}
+}
+
+func TestBCMTransferNilRx(t *testing.T) {
+	f := newFakeBCM()
+	c := newBCMConn(f, 0, bcmDefaultCoreClock)
+	tx := []byte{1, 2, 3}
+	if err := c.Transfer(tx, nil); err != nil {
+		t.Fatalf("Transfer(tx, nil): %v", err)
+	}
+	if !bytes.Equal(f.tx, tx) {
+		t.Errorf("shifted out % x, want % x", f.tx, tx)
+	}
+}
+
+func TestBCMTransferManyCSChange(t *testing.T) {
+	f := newFakeBCM()
+	c := newBCMConn(f, 0, bcmDefaultCoreClock)
+	msgs := []driver.Message{
+		{Tx: []byte{1}, Rx: make([]byte, 1), CSChange: true},
+		{Tx: []byte{2}, Rx: make([]byte, 1)},
+		{Tx: []byte{3}, Rx: make([]byte, 1), CSChange: true},
+	}
+	if err := c.TransferMany(msgs); err != nil {
+		t.Fatalf("TransferMany: %v", err)
+	}
+	// The chip select is released after the first message
+	// and left asserted after the last one.
+	if want := []bool{true, false, true}; !reflect.DeepEqual(f.active, want) {
+		t.Errorf("transfer active changes=%v, want %v", f.active, want)
+	}
+	if err := c.Transfer([]byte{4}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if want := []bool{true, false, true, false}; !reflect.DeepEqual(f.active, want) {
+		t.Errorf("transfer active changes=%v, want %v", f.active, want)
+	}
+	if want := []byte{1, 2, 3, 4}; !bytes.Equal(f.tx, want) {
+		t.Errorf("shifted out % x, want % x", f.tx, want)
+	}
+}
+
+// BenchmarkBCMTransfer64 measures the cost of the BCM2835 transfers
+// of 64 bytes, to be compared with BenchmarkTransfer64.
+func BenchmarkBCMTransfer64(b *testing.B) {
+	f := newFakeBCM()
+	f.fifo = bcmFIFOSize
+	c := newBCMConn(f, 0, bcmDefaultCoreClock)
+	tx := make([]byte, 64)
+	rx := make([]byte, 64)
+	b.SetBytes(64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.tx = f.tx[:0]
+		if err := c.Transfer(tx, rx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
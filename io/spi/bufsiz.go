@@ -0,0 +1,59 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// MaxTransferSize returns the maximum number of bytes the driver
+// transfers with a single request, or zero if it has no limit. With
+// DevFS, it is the bufsiz parameter of the spidev kernel driver, read
+// when the device is opened, or 4096 if the parameter can't be read,
+// which limits the combined length of the messages of each
+// SPI_IOC_MESSAGE request. Transfer splits larger buffers into several
+// requests, but the messages of TxMany are a single request, so their
+// total length must not exceed it.
+func (d *Device) MaxTransferSize() int {
+	if c, ok := d.driverConn().(driver.MaxTransferSizer); ok {
+		return c.MaxTransferSize()
+	}
+	return 0
+}
+
+// streamChunk returns the number of bytes of the transfers of the
+// streams of d: MaxTransferSize, or defaultBufsiz for the drivers
+// without a limit.
+func (d *Device) streamChunk() int {
+	if n := d.MaxTransferSize(); n > 0 {
+		return n
+	}
+	return defaultBufsiz
+}
+
+// bufsizPath is the file of the spidev module parameter limiting the
+// number of bytes of a single SPI_IOC_MESSAGE request.
+var bufsizPath = "/sys/module/spidev/parameters/bufsiz"
+
+// defaultBufsiz is the default value of the spidev bufsiz parameter.
+const defaultBufsiz = 4096
+
+// readBufsiz returns the value of the bufsiz parameter read from path,
+// or defaultBufsiz if it can't be read.
+func readBufsiz(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return defaultBufsiz
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || n <= 0 {
+		return defaultBufsiz
+	}
+	return n
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// sizedConn is a connection limiting the messages to max bytes.
+type sizedConn struct {
+	*spitest.Conn
+	max int
+}
+
+func (c sizedConn) MaxTransferSize() int {
+	return c.max
+}
+
+func TestMaxTransferSize(t *testing.T) {
+	dev := &Device{conn: sizedConn{&spitest.Conn{}, 65536}}
+	dev.SetTracer(func(TraceEvent) {})
+	if n := dev.MaxTransferSize(); n != 65536 {
+		t.Errorf("MaxTransferSize()=%d, want 65536", n)
+	}
+	if n := dev.streamChunk(); n != 65536 {
+		t.Errorf("streamChunk()=%d, want 65536", n)
+	}
+
+	// The drivers other than DevFS have no limit.
+	dev = &Device{conn: &spitest.Conn{}}
+	if n := dev.MaxTransferSize(); n != 0 {
+		t.Errorf("MaxTransferSize() without a limit=%d, want 0", n)
+	}
+	if n := dev.streamChunk(); n != defaultBufsiz {
+		t.Errorf("streamChunk() without a limit=%d, want %d", n, defaultBufsiz)
+	}
+}
+
+func TestReadBufsiz(t *testing.T) {
+	dir, err := os.MkdirTemp("", "spi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		data string
+		want int
+	}{
+		{"8192\n", 8192},
+		{"", defaultBufsiz},
+		{"0\n", defaultBufsiz},
+		{"abc\n", defaultBufsiz},
+	}
+	for _, test := range tests {
+		p := filepath.Join(dir, "bufsiz")
+		if err := os.WriteFile(p, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if n := readBufsiz(p); n != test.want {
+			t.Errorf("readBufsiz(%q)=%d, want %d", test.data, n, test.want)
+		}
+	}
+}
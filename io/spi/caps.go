@@ -0,0 +1,75 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// errNoCaps is returned by Capabilities for the drivers
+// that don't report capabilities.
+var errNoCaps = errors.New("spi: driver does not report capabilities")
+
+// Caps are the capabilities of a device opened with the DevFS or
+// DevFSFile driver, as far as the kernel tells them.
+//
+// The fields read from the device tree through the sysfs are
+// best-effort: they are zero if the device has no device tree node, as
+// is the case for devices declared by board files or ACPI, or if the
+// device file is not named after the spidev device. Linux doesn't tell
+// which modes the controller supports; setting an unsupported mode
+// fails with syscall.EINVAL.
+type Caps struct {
+	// MaxSpeed is the maximum clock speed in Hz of the device tree
+	// (spi-max-frequency), or 0 if unknown.
+	MaxSpeed int
+	// TxLanes and RxLanes are the numbers of data lines wired to
+	// write and read (spi-tx-bus-width and spi-rx-bus-width), e.g. 4
+	// for quad SPI, or 0 if unknown. The device tree default is 1.
+	TxLanes, RxLanes int
+	// Mode32 is whether the kernel supports the 32-bit mode word of
+	// SetMode32 and Mode32, which the multi-line modes need.
+	Mode32 bool
+	// MaxTransferSize is the value of MaxTransferSize,
+	// the bufsiz limit of the kernel driver.
+	MaxTransferSize int
+}
+
+// Capabilities returns the capabilities of d, for the applications to
+// adapt to the device rather than trying settings until they succeed.
+// It returns an error for the drivers other than DevFS and DevFSFile.
+func (d *Device) Capabilities() (Caps, error) {
+	c, ok := d.driverConn().(interface {
+		caps() Caps
+	})
+	if !ok {
+		return Caps{}, errNoCaps
+	}
+	caps := c.caps()
+	caps.MaxTransferSize = d.MaxTransferSize()
+	return caps, nil
+}
+
+// readOFCaps sets the fields of caps read from the device tree node
+// of the device file path, for the spidev class directory sys.
+func readOFCaps(caps *Caps, sys, path string) {
+	if path == "" {
+		return
+	}
+	name := filepath.Base(path)
+	if _, err := os.Stat(filepath.Join(sys, name, "device", "of_node")); err != nil {
+		return
+	}
+	caps.MaxSpeed, _ = readOFProperty(sys, name, "spi-max-frequency")
+	caps.TxLanes, caps.RxLanes = 1, 1
+	if n, ok := readOFProperty(sys, name, "spi-tx-bus-width"); ok {
+		caps.TxLanes = n
+	}
+	if n, ok := readOFProperty(sys, name, "spi-rx-bus-width"); ok {
+		caps.RxLanes = n
+	}
+}
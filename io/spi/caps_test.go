@@ -0,0 +1,65 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// writeOFNode writes the 32-bit device tree properties props
+// of the spidev device name in the spidev class directory sys.
+func writeOFNode(t *testing.T, sys, name string, props map[string]uint32) {
+	of := filepath.Join(sys, name, "device", "of_node")
+	if err := os.MkdirAll(of, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for p, v := range props {
+		b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		if err := os.WriteFile(filepath.Join(of, p), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadOFCaps(t *testing.T) {
+	sys, err := os.MkdirTemp("", "spi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sys)
+	writeOFNode(t, sys, "spidev0.0", map[string]uint32{
+		"spi-max-frequency": 8000000,
+		"spi-rx-bus-width":  4,
+	})
+	writeOFNode(t, sys, "spidev0.1", nil)
+
+	tests := []struct {
+		path string
+		want Caps
+	}{
+		{"/dev/spidev0.0", Caps{MaxSpeed: 8000000, TxLanes: 1, RxLanes: 4}},
+		{"/dev/spidev0.1", Caps{TxLanes: 1, RxLanes: 1}},
+		{"/dev/spidev1.0", Caps{}}, // no device tree node
+		{"", Caps{}},
+	}
+	for _, test := range tests {
+		var caps Caps
+		readOFCaps(&caps, sys, test.path)
+		if caps != test.want {
+			t.Errorf("readOFCaps(%q)=%+v, want %+v", test.path, caps, test.want)
+		}
+	}
+}
+
+func TestCapabilitiesUnsupported(t *testing.T) {
+	dev := &Device{conn: &spitest.Conn{}}
+	if _, err := dev.Capabilities(); err != errNoCaps {
+		t.Errorf("Capabilities()=%v, want %v", err, errNoCaps)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import "golang.org/x/exp/io/spi/driver"
+
+// SetChipSelect sets functions asserting and deasserting the chip select
+// of the device around each transfer, for devices whose chip select is
+// a GPIO line or goes through an external multiplexer, usually with the
+// NoCS mode flag set. assert is called before the transfer and, if it
+// succeeds, deassert is called after the transfer even if it fails.
+// Nil functions disable it, which is the default. It must not be
+// called concurrently with other methods of the device.
+func (d *Device) SetChipSelect(assert, deassert func() error) {
+	// The chip select is beneath the tracer, if any,
+	// so that the tracer can be removed independently.
+	conn := &d.conn
+	if tc, ok := d.conn.(*tracingConn); ok {
+		conn = &tc.Conn
+	}
+	if cc, ok := (*conn).(*chipSelectConn); ok {
+		*conn = cc.Conn
+	}
+	if assert != nil || deassert != nil {
+		*conn = &chipSelectConn{Conn: *conn, assert: assert, deassert: deassert}
+	}
+}
+
+// chipSelectConn is a connection calling assert and deassert
+// around the transfers of Conn.
+type chipSelectConn struct {
+	driver.Conn
+	assert, deassert func() error
+
+	// held is whether the chip select is held asserted
+	// by a Transaction, which asserts and deasserts it.
+	held bool
+}
+
+func (c *chipSelectConn) Transfer(tx, rx []byte) error {
+	return c.selected(func() error { return c.Conn.Transfer(tx, rx) })
+}
+
+func (c *chipSelectConn) TransferMany(msgs []driver.Message) error {
+	return c.selected(func() error { return c.Conn.TransferMany(msgs) })
+}
+
+// selected calls f with the chip select asserted and returns the first
+// error of asserting the chip select, f and deasserting it.
+func (c *chipSelectConn) selected(f func() error) (err error) {
+	if c.held {
+		return f()
+	}
+	if c.assert != nil {
+		if err := c.assert(); err != nil {
+			return err
+		}
+	}
+	if c.deassert != nil {
+		defer func() {
+			if derr := c.deassert(); err == nil {
+				err = derr
+			}
+		}()
+	}
+	return f()
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestSetChipSelect(t *testing.T) {
+	var calls []string
+	c := &spitest.Conn{
+		TransferError: func(driver.Message) error {
+			calls = append(calls, "transfer")
+			return nil
+		},
+	}
+	dev := &Device{conn: c}
+	dev.SetChipSelect(
+		func() error { calls = append(calls, "assert"); return nil },
+		func() error { calls = append(calls, "deassert"); return nil },
+	)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := dev.TxMany([]Message{{Tx: []byte{2}}, {Tx: []byte{3}}}); err != nil {
+		t.Fatalf("TxMany: %v", err)
+	}
+	want := []string{
+		"assert", "transfer", "deassert",
+		"assert", "transfer", "transfer", "deassert",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls=%v, want %v", calls, want)
+	}
+
+	calls = nil
+	dev.SetChipSelect(nil, nil)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if want := []string{"transfer"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls without chip select=%v, want %v", calls, want)
+	}
+}
+
+func TestSetChipSelectErrors(t *testing.T) {
+	errTransfer := errors.New("transfer failed")
+	errAssert := errors.New("assert failed")
+	c := &spitest.Conn{
+		TransferError: func(driver.Message) error { return errTransfer },
+	}
+	dev := &Device{conn: c}
+	deasserted := 0
+	var assertErr error
+	dev.SetChipSelect(
+		func() error { return assertErr },
+		func() error { deasserted++; return nil },
+	)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != errTransfer {
+		t.Errorf("Transfer()=%v, want %v", err, errTransfer)
+	}
+	if deasserted != 1 {
+		t.Errorf("deasserted %d times after a failed transfer, want 1", deasserted)
+	}
+
+	assertErr = errAssert
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != errAssert {
+		t.Errorf("Transfer() with failing assert=%v, want %v", err, errAssert)
+	}
+	if deasserted != 1 {
+		t.Errorf("deasserted %d times after a failed assert, want 1", deasserted)
+	}
+}
+
+func TestSetChipSelectTracer(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	var events int
+	dev.SetTracer(func(TraceEvent) { events++ })
+	asserted := 0
+	dev.SetChipSelect(func() error { asserted++; return nil }, nil)
+	dev.SetTracer(nil)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if events != 0 || asserted != 1 {
+		t.Errorf("got %d events and %d asserts, want 0 and 1", events, asserted)
+	}
+	dev.SetChipSelect(nil, nil)
+	if dev.conn != c {
+		t.Errorf("conn=%T after removing the chip select, want the driver connection", dev.conn)
+	}
+}
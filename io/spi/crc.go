@@ -0,0 +1,32 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/io/spi/crc8"
+)
+
+// TxCRC performs a duplex transmission of tx followed by its CRC with
+// the parameters p, for the devices checking the integrity of their
+// frames with a trailing CRC byte. The frame read has the same length;
+// its last byte must be the CRC of the bytes before it, which TxCRC
+// returns. It returns an error wrapping ErrCRCMismatch, and no data,
+// if the CRC read doesn't match.
+func (d *Device) TxCRC(tx []byte, p crc8.Params) ([]byte, error) {
+	frame := make([]byte, len(tx)+1)
+	copy(frame, tx)
+	frame[len(tx)] = crc8.Checksum(p, tx)
+	rx := make([]byte, len(frame))
+	if err := d.Transfer(frame, rx); err != nil {
+		return nil, err
+	}
+	data, crc := rx[:len(tx)], rx[len(tx)]
+	if want := crc8.Checksum(p, data); crc != want {
+		return nil, fmt.Errorf("%w: read %#02x, want %#02x", ErrCRCMismatch, crc, want)
+	}
+	return data, nil
+}
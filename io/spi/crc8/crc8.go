@@ -0,0 +1,66 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package crc8 computes the 8-bit cyclic redundancy checks that some
+// SPI devices, such as ADCs and safety devices, append to their frames.
+package crc8 // import "golang.org/x/exp/io/spi/crc8"
+
+import "math/bits"
+
+// Params are the parameters of a CRC-8, as listed in the catalogues
+// of parametrised CRC algorithms.
+type Params struct {
+	// Poly is the generator polynomial, without its x^8 term,
+	// e.g. 0x07 for x^8 + x^2 + x + 1.
+	Poly byte
+	// Init is the initial value of the register.
+	Init byte
+	// Reflect processes the bits of the bytes from the least
+	// significant one, and reflects the result (refin and refout).
+	Reflect bool
+	// XorOut is xored with the result.
+	XorOut byte
+}
+
+// Common CRC-8 parameters.
+var (
+	// SMBus is the CRC-8 of SMBus packet error checking,
+	// also known as CRC-8/ATM.
+	SMBus = Params{Poly: 0x07}
+	// Maxim is the CRC-8 of the Dallas/Maxim 1-Wire devices.
+	Maxim = Params{Poly: 0x31, Reflect: true}
+	// SAEJ1850 is the CRC-8 of SAE J1850 and AUTOSAR.
+	SAEJ1850 = Params{Poly: 0x1d, Init: 0xff, XorOut: 0xff}
+)
+
+// Checksum returns the CRC of data with the parameters p.
+func Checksum(p Params, data []byte) byte {
+	if p.Reflect {
+		poly := bits.Reverse8(p.Poly)
+		crc := bits.Reverse8(p.Init)
+		for _, b := range data {
+			crc ^= b
+			for i := 0; i < 8; i++ {
+				if crc&1 != 0 {
+					crc = crc>>1 ^ poly
+				} else {
+					crc >>= 1
+				}
+			}
+		}
+		return crc ^ p.XorOut
+	}
+	crc := p.Init
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ p.Poly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc ^ p.XorOut
+}
@@ -0,0 +1,29 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crc8
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	// The check values are the CRCs of "123456789".
+	tests := []struct {
+		name string
+		p    Params
+		want byte
+	}{
+		{"SMBus", SMBus, 0xf4},
+		{"Maxim", Maxim, 0xa1},
+		{"SAEJ1850", SAEJ1850, 0x4b},
+		{"ROHC", Params{Poly: 0x07, Init: 0xff, Reflect: true}, 0xd0},
+	}
+	for _, test := range tests {
+		if got := Checksum(test.p, []byte("123456789")); got != test.want {
+			t.Errorf("Checksum(%s)=%#02x, want %#02x", test.name, got, test.want)
+		}
+	}
+	if got := Checksum(SAEJ1850, nil); got != 0 {
+		t.Errorf("Checksum(SAEJ1850, nil)=%#02x, want 0", got)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi/crc8"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestDeviceTxCRC(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	// 0xf4 is the SMBus CRC of "123456789".
+	c.Respond([]byte("123456789\xf4"))
+	rx, err := dev.TxCRC([]byte("abcdefghi"), crc8.SMBus)
+	if err != nil {
+		t.Fatalf("TxCRC: %v", err)
+	}
+	if string(rx) != "123456789" {
+		t.Errorf("TxCRC()=%q, want %q", rx, "123456789")
+	}
+	ts := c.Transfers()
+	want := append([]byte("abcdefghi"), crc8.Checksum(crc8.SMBus, []byte("abcdefghi")))
+	if len(ts) != 1 || !reflect.DeepEqual(ts[0].Tx, want) {
+		t.Errorf("transfers=%v, want a single write of % x", ts, want)
+	}
+
+	c.Respond([]byte("123456780\xf4"))
+	if rx, err := dev.TxCRC([]byte("abcdefghi"), crc8.SMBus); !errors.Is(err, ErrCRCMismatch) || rx != nil {
+		t.Errorf("TxCRC() of a corrupted frame=%q, %v, want nil, ErrCRCMismatch", rx, err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import "fmt"
+
+// DaisyChain transfers the frames of daisy-chained devices sharing a
+// chip select, such as LED drivers and shift registers: the data output
+// of each device is wired to the data input of the next one, so that
+// the frames of all the devices are shifted through the chain with
+// a single transfer.
+//
+// The devices are numbered in the order of the chain: device 0 is the
+// one wired to the data output of the controller, and the last device
+// the one wired to its data input.
+type DaisyChain struct {
+	d     *Device
+	sizes []int
+	total int
+}
+
+// NewDaisyChain returns a daisy chain of devices on d, whose frames
+// are sizes bytes long, in the order of the chain.
+func NewDaisyChain(d *Device, sizes ...int) *DaisyChain {
+	c := &DaisyChain{d: d, sizes: append([]int(nil), sizes...)}
+	for _, n := range sizes {
+		c.total += n
+	}
+	return c
+}
+
+// Transfer writes the frame tx[i] to device i, and returns the frames
+// shifted out of the devices at the same time, rx[i] being the frame of
+// device i. The frames are transferred with a single transfer, so the
+// chip select stays asserted during all of it. Since the first bytes
+// written are shifted the farthest, the frames are written from the one
+// of the last device to the one of device 0; likewise, the frame of the
+// last device is read first.
+func (c *DaisyChain) Transfer(tx [][]byte) (rx [][]byte, err error) {
+	if len(tx) != len(c.sizes) {
+		return nil, fmt.Errorf("got %d frames for %d devices", len(tx), len(c.sizes))
+	}
+	w := make([]byte, 0, c.total)
+	for i := len(tx) - 1; i >= 0; i-- {
+		if len(tx[i]) != c.sizes[i] {
+			return nil, fmt.Errorf("frame %d: length (%d) does not match device frame size (%d)", i, len(tx[i]), c.sizes[i])
+		}
+		w = append(w, tx[i]...)
+	}
+	r := make([]byte, len(w))
+	if err := c.d.Transfer(w, r); err != nil {
+		return nil, err
+	}
+	rx = make([][]byte, len(c.sizes))
+	for i := len(c.sizes) - 1; i >= 0; i-- {
+		rx[i], r = r[:c.sizes[i]:c.sizes[i]], r[c.sizes[i]:]
+	}
+	return rx, nil
+}
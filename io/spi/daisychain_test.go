@@ -0,0 +1,55 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestDaisyChain(t *testing.T) {
+	// Three chained 16-bit shift registers: each transfer shifts out
+	// their contents, the last device first, and shifts in the frame
+	// written, the frame of the last device first.
+	regs := [][]byte{{0x00, 0x01}, {0x10, 0x11}, {0x20, 0x21}}
+	c := &spitest.Conn{
+		Reply: func(tx []byte) []byte {
+			var out []byte
+			for i := len(regs) - 1; i >= 0; i-- {
+				out = append(out, regs[i]...)
+			}
+			for i := range regs {
+				j := 2 * (len(regs) - 1 - i)
+				regs[i] = append([]byte(nil), tx[j:j+2]...)
+			}
+			return out
+		},
+	}
+	chain := NewDaisyChain(&Device{conn: c}, 2, 2, 2)
+	tx := [][]byte{{0xa0, 0xa1}, {0xb0, 0xb1}, {0xc0, 0xc1}}
+	rx, err := chain.Transfer(tx)
+	if err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if want := [][]byte{{0x00, 0x01}, {0x10, 0x11}, {0x20, 0x21}}; !reflect.DeepEqual(rx, want) {
+		t.Errorf("Transfer()=% x, want % x", rx, want)
+	}
+	if !reflect.DeepEqual(regs, tx) {
+		t.Errorf("device registers=% x, want % x", regs, tx)
+	}
+	ts := c.Transfers()
+	if want := []byte{0xc0, 0xc1, 0xb0, 0xb1, 0xa0, 0xa1}; len(ts) != 1 || !reflect.DeepEqual(ts[0].Tx, want) {
+		t.Errorf("transfers=%v, want a single write of % x", ts, want)
+	}
+
+	if _, err := chain.Transfer(tx[:2]); err == nil {
+		t.Errorf("Transfer of 2 frames for 3 devices succeeded, want error")
+	}
+	if _, err := chain.Transfer([][]byte{{1}, {2, 3}, {4, 5}}); err == nil {
+		t.Errorf("Transfer of a short frame succeeded, want error")
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import "unsafe"
+
+// DevFiles opens the device files of the DevFS driver.
+// The default opens them with the operating system.
+type DevFiles interface {
+	// Open opens the device file name, e.g. "/dev/spidev0.1",
+	// for reading and writing.
+	Open(name string) (DevFile, error)
+}
+
+// DevFile is a device file opened by DevFiles.
+type DevFile interface {
+	// Ioctl issues the ioctl request with the argument arg,
+	// returning the syscall.Errno of a failed request.
+	Ioctl(request uintptr, arg unsafe.Pointer) error
+	Close() error
+}
@@ -0,0 +1,16 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !ppc && !ppc64 && !ppc64le
+
+package spi
+
+// The generic encoding of the ioctl requests, of asm-generic/ioctl.h.
+const (
+	devfs_SIZEBITS = 14
+	devfs_DIRBITS  = 2
+
+	devfs_WRITE = 1
+	devfs_READ  = 2
+)
@@ -0,0 +1,18 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && (mips || mipsle || mips64 || mips64le || ppc || ppc64 || ppc64le)
+
+package spi
+
+// The encoding of the ioctl requests on MIPS and PowerPC, which have
+// a smaller size field and a third direction bit, of
+// arch/mips/include/uapi/asm/ioctl.h and arch/powerpc/include/uapi/asm/ioctl.h.
+const (
+	devfs_SIZEBITS = 13
+	devfs_DIRBITS  = 3
+
+	devfs_WRITE = 4
+	devfs_READ  = 2
+)
@@ -0,0 +1,750 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	devfs_MAGIC = 107
+
+	devfs_NRBITS   = 8
+	devfs_TYPEBITS = 8
+
+	devfs_NRSHIFT   = 0
+	devfs_TYPESHIFT = devfs_NRSHIFT + devfs_NRBITS
+	devfs_SIZESHIFT = devfs_TYPESHIFT + devfs_TYPEBITS
+	devfs_DIRSHIFT  = devfs_SIZESHIFT + devfs_SIZEBITS
+)
+
+// payload is struct spi_ioc_transfer of linux/spi/spidev.h. Its
+// layout is the same on 32 and 64-bit platforms: the buffer addresses
+// are 64-bit on all of them and the fields are naturally aligned,
+// so there is no padding between them.
+type payload struct {
+	tx       uint64
+	rx       uint64
+	length   uint32
+	speed    uint32
+	delay    uint16
+	bits     uint8
+	csChange uint8
+	txNBits  uint8
+	rxNBits  uint8
+
+	// wordDelay is word_delay_usecs, which replaced a padding byte in
+	// Linux 5.3; older kernels ignore it. The size of the struct is
+	// unchanged, so it is always set.
+	wordDelay uint8
+	pad       uint8
+}
+
+// String returns the fields of p followed by its raw bytes,
+// as they are passed to the kernel.
+func (p *payload) String() string {
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(p)), unsafe.Sizeof(*p))
+	return fmt.Sprintf("tx_buf=%#x rx_buf=%#x len=%d speed_hz=%d delay_usecs=%d bits_per_word=%d cs_change=%d tx_nbits=%d rx_nbits=%d word_delay_usecs=%d [% x]",
+		p.tx, p.rx, p.length, p.speed, p.delay, p.bits, p.csChange, p.txNBits, p.rxNBits, p.wordDelay, raw)
+}
+
+// The size of payload must be SPI_MSGSIZE(1), 32 bytes, since the kernel
+// computes the number of messages from the size of the request. These
+// declarations fail to compile otherwise.
+var (
+	_ [32 - unsafe.Sizeof(payload{})]byte
+	_ [unsafe.Sizeof(payload{}) - 32]byte
+)
+
+// payloadPools holds the payload arrays of the SPI_IOC_MESSAGE
+// requests, to save their allocation. payloadPools[i] holds arrays
+// of 1<<i payloads; the arrays of larger requests are not pooled.
+var payloadPools [7]sync.Pool
+
+// getPayloads returns an array of n payloads, which
+// putPayloads returns to the pool once the request is done.
+func getPayloads(n int) *[]payload {
+	i := bits.Len(uint(n - 1))
+	if i >= len(payloadPools) {
+		ps := make([]payload, n)
+		return &ps
+	}
+	if v := payloadPools[i].Get(); v != nil {
+		ps := v.(*[]payload)
+		*ps = (*ps)[:n]
+		return ps
+	}
+	ps := make([]payload, n, 1<<i)
+	return &ps
+}
+
+// putPayloads clears the payloads of ps, so that the buffer addresses
+// of a request can't leak into the next one, and returns ps to its pool.
+func putPayloads(ps *[]payload) {
+	i := bits.Len(uint(cap(*ps) - 1))
+	if i >= len(payloadPools) || cap(*ps) != 1<<i {
+		return
+	}
+	clear(*ps)
+	payloadPools[i].Put(ps)
+}
+
+// DevFS is an SPI driver that works against the devfs.
+// You need to load the "spidev" module to use this driver.
+//
+// When built with the spidebug tag, the driver logs the fields and
+// the raw bytes of each spi_ioc_transfer struct passed to the kernel,
+// to diagnose transfers returning unexpected data.
+type DevFS struct {
+	// BitsPerWord, if non-zero, is the number of bits per word
+	// set when opening the device.
+	BitsPerWord int
+	// Order, if non-zero, is the bit order set when opening the device.
+	Order Order
+	// Files, if non-nil, opens the device files instead of the
+	// operating system, for instance to use fake devices in tests.
+	Files DevFiles
+	// PathFmt, if non-empty, is the format of the path of the device
+	// files, formatted with the bus and chip numbers, for the systems
+	// that name them differently, e.g. "/dev/spidevB%d.%d". The default
+	// is DefaultPathFmt.
+	PathFmt string
+}
+
+// DefaultPathFmt is the default format of the path
+// of the device files of DevFS.
+const DefaultPathFmt = "/dev/spidev%d.%d"
+
+// Open opens the device file of bus and chip, by default
+// /dev/spidev<bus>.<chip>, and returns a connection.
+func (d *DevFS) Open(bus, chip int) (driver.Conn, error) {
+	pathFmt := d.PathFmt
+	if pathFmt == "" {
+		pathFmt = DefaultPathFmt
+	}
+	n := fmt.Sprintf(pathFmt, bus, chip)
+	files := d.Files
+	if files == nil {
+		files = osFiles{}
+	}
+	f, err := files.Open(n)
+	if err != nil {
+		return nil, err
+	}
+	c := &devfsConn{f: f, path: n, bufsiz: readBufsiz(bufsizPath)}
+	if err := d.configure(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// configure applies the non-zero settings of d to c.
+func (d *DevFS) configure(c driver.Conn) error {
+	if d.BitsPerWord != 0 {
+		if err := c.Configure(driver.Bits, d.BitsPerWord); err != nil {
+			return err
+		}
+	}
+	if d.Order != MSBFirst {
+		if err := c.Configure(driver.Order, int(d.Order)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DevFSFile is an SPI driver that works against an already open
+// spidev device file, for instance one passed by a supervisor
+// process or opened with specific flags.
+type DevFSFile struct {
+	// File is the open device file, e.g. a /dev/spidev<bus>.<chip>
+	// file opened for reading and writing. The connection takes
+	// ownership of File and closes it when it is closed.
+	File *os.File
+}
+
+// Open returns a connection using File. The bus and chip numbers are
+// ignored; the device is the one File was opened for.
+func (d *DevFSFile) Open(bus, chip int) (driver.Conn, error) {
+	if d.File == nil {
+		return nil, fmt.Errorf("no devfs file")
+	}
+	return &devfsConn{f: osFile{d.File}, path: d.File.Name(), bufsiz: readBufsiz(bufsizPath)}, nil
+}
+
+// osFiles opens the device files of the operating system.
+type osFiles struct{}
+
+func (osFiles) Open(name string) (DevFile, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return osFile{f}, nil
+}
+
+// osFile is a device file of the operating system.
+type osFile struct {
+	*os.File
+}
+
+func (f osFile) Ioctl(request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+type devfsConn struct {
+	// mu serializes the configuration and the transfers,
+	// and guards the fields below.
+	mu sync.Mutex
+
+	f        DevFile
+	path     string // the path of the device file, if known
+	mode     uint32
+	speed    uint32
+	bits     uint8
+	delay    uint16
+	txNBits  uint8
+	rxNBits  uint8
+	csChange uint8
+	// wordDelay is the delay between words in usecs.
+	wordDelay uint8
+
+	// bufsiz is the maximum number of bytes of a request,
+	// or zero for defaultBufsiz.
+	bufsiz int
+
+	// closed is set by Close, which doesn't take mu.
+	closed atomic.Bool
+}
+
+func (c *devfsConn) Configure(k, v int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch k {
+	case driver.Mode:
+		if v < 0 || Mode(v)&^modeMask != 0 {
+			return &ConfigError{Key: k, Value: v, Err: ErrInvalidMode}
+		}
+		// SPI_IOC_WR_MODE also sets the bit order: keep the current one.
+		cur, err := c.readMode()
+		if err != nil {
+			return &ConfigError{Key: k, Value: v, Err: err}
+		}
+		m := uint8(v) | cur&lsbFirst
+		if err := c.ioctl(requestCode(devfs_WRITE, devfs_MAGIC, 1, 1), unsafe.Pointer(&m)); err != nil {
+			return &ConfigError{Key: k, Value: v, Err: unsupported(k, err)}
+		}
+		c.mode = c.mode&^0xff | uint32(m)
+	case driver.Mode32:
+		if v < 0 || v&^mode32Mask != 0 {
+			return &ConfigError{Key: k, Value: v, Err: ErrInvalidMode}
+		}
+		m := uint32(v)
+		if err := c.writeMode32(m); err != nil {
+			return &ConfigError{Key: k, Value: v, Err: unsupported(k, err)}
+		}
+		c.mode = m
+	case driver.Bits:
+		if v < 0 || v > 32 {
+			return &ConfigError{Key: k, Value: v, Err: errBitsRange}
+		}
+		if v == 0 {
+			v = 8
+		}
+		b := uint8(v)
+		if err := c.ioctl(requestCode(devfs_WRITE, devfs_MAGIC, 3, 1), unsafe.Pointer(&b)); err != nil {
+			return &ConfigError{Key: k, Value: v, Err: unsupported(k, err)}
+		}
+		c.bits = b
+	case driver.Speed:
+		if v < 0 {
+			return &ConfigError{Key: k, Value: v, Err: unix.EINVAL}
+		}
+		// Zero means the current max speed of the device, which the
+		// kernel uses for transfers with a zero speed. It is not
+		// written, since not all kernels accept a zero max speed.
+		s := uint32(v)
+		if s == 0 {
+			c.speed = 0
+			break
+		}
+		if err := c.ioctl(requestCode(devfs_WRITE, devfs_MAGIC, 4, 4), unsafe.Pointer(&s)); err != nil {
+			return &ConfigError{Key: k, Value: v, Err: unsupported(k, err)}
+		}
+		// The kernel clamps the speed to the maximum of the controller
+		// without an error; keep the speed it applied for the transfers.
+		s, err := c.readSpeed()
+		if err != nil {
+			return &ConfigError{Key: k, Value: v, Err: err}
+		}
+		c.speed = s
+	case driver.Order:
+		if v != int(MSBFirst) && v != int(LSBFirst) {
+			return &ConfigError{Key: k, Value: v, Err: unix.EINVAL}
+		}
+		o := uint8(v)
+		if err := c.ioctl(requestCode(devfs_WRITE, devfs_MAGIC, 2, 1), unsafe.Pointer(&o)); err != nil {
+			return &ConfigError{Key: k, Value: v, Err: unsupported(k, err)}
+		}
+	case driver.Delay:
+		if v < 0 || v > math.MaxUint16 {
+			return &ConfigError{Key: k, Value: v, Err: unix.EINVAL}
+		}
+		c.delay = uint16(v)
+	case driver.TxNBits:
+		if !validNBits(v) {
+			return &ConfigError{Key: k, Value: v, Err: unix.EINVAL}
+		}
+		c.txNBits = uint8(v)
+	case driver.RxNBits:
+		if !validNBits(v) {
+			return &ConfigError{Key: k, Value: v, Err: unix.EINVAL}
+		}
+		c.rxNBits = uint8(v)
+	case driver.CSChange:
+		c.csChange = 0
+		if v != 0 {
+			c.csChange = 1
+		}
+	case driver.WordDelay:
+		if v < 0 || v > 0xff {
+			return &ConfigError{Key: k, Value: v, Err: unix.EINVAL}
+		}
+		c.wordDelay = uint8(v)
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownKey, k)
+	}
+	return nil
+}
+
+// Query reads the value of the configuration key k back from the
+// kernel driver, which may differ from the configured value.
+func (c *devfsConn) Query(k int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch k {
+	case driver.Mode:
+		m, err := c.readMode()
+		return int(m &^ lsbFirst), err
+	case driver.Bits:
+		b, err := c.readBits()
+		return int(b), err
+	case driver.Mode32:
+		m, err := c.readMode32()
+		return int(m), err
+	case driver.Speed:
+		s, err := c.readSpeed()
+		return int(s), err
+	case driver.Order:
+		o, err := c.readOrder()
+		return int(o), err
+	case driver.Delay:
+		return int(c.delay), nil
+	case driver.TxNBits:
+		return int(c.txNBits), nil
+	case driver.RxNBits:
+		return int(c.rxNBits), nil
+	case driver.CSChange:
+		return int(c.csChange), nil
+	case driver.WordDelay:
+		return int(c.wordDelay), nil
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrUnknownKey, k)
+	}
+}
+
+func (c *devfsConn) readMode() (uint8, error) {
+	var m uint8
+	if err := c.ioctl(requestCode(devfs_READ, devfs_MAGIC, 1, 1), unsafe.Pointer(&m)); err != nil {
+		return 0, fmt.Errorf("error reading mode: %w", err)
+	}
+	return m, nil
+}
+
+// writeMode32 sets the mode with SPI_IOC_WR_MODE32, or with
+// SPI_IOC_WR_MODE if m fits in 8 bits, since not all kernels
+// support the 32-bit request.
+func (c *devfsConn) writeMode32(m uint32) error {
+	if m <= 0xff {
+		b := uint8(m)
+		return c.ioctl(requestCode(devfs_WRITE, devfs_MAGIC, 1, 1), unsafe.Pointer(&b))
+	}
+	return c.ioctl(requestCode(devfs_WRITE, devfs_MAGIC, 5, 4), unsafe.Pointer(&m))
+}
+
+func (c *devfsConn) readMode32() (uint32, error) {
+	var m uint32
+	if err := c.ioctl(requestCode(devfs_READ, devfs_MAGIC, 5, 4), unsafe.Pointer(&m)); err != nil {
+		return 0, fmt.Errorf("error reading mode: %w", err)
+	}
+	return m, nil
+}
+
+func (c *devfsConn) readOrder() (uint8, error) {
+	var o uint8
+	if err := c.ioctl(requestCode(devfs_READ, devfs_MAGIC, 2, 1), unsafe.Pointer(&o)); err != nil {
+		return 0, fmt.Errorf("error reading bit order: %w", err)
+	}
+	return o, nil
+}
+
+func (c *devfsConn) readBits() (uint8, error) {
+	var b uint8
+	if err := c.ioctl(requestCode(devfs_READ, devfs_MAGIC, 3, 1), unsafe.Pointer(&b)); err != nil {
+		return 0, fmt.Errorf("error reading bits per word: %w", err)
+	}
+	return b, nil
+}
+
+func (c *devfsConn) readSpeed() (uint32, error) {
+	var s uint32
+	if err := c.ioctl(requestCode(devfs_READ, devfs_MAGIC, 4, 4), unsafe.Pointer(&s)); err != nil {
+		return 0, fmt.Errorf("error reading speed: %w", err)
+	}
+	return s, nil
+}
+
+// Transfer performs a full-duplex SPI_IOC_MESSAGE(1) transfer.
+// The kernel clocks out len(tx) bytes from tx and, at the same time,
+// writes the len(tx) bytes clocked in from the device to rx.
+// It is an error if rx and tx have different lengths; the kernel
+// would otherwise write past the end of rx. Empty buffers issue a
+// zero-length message, which only applies the delay. If tx is nil,
+// the kernel writes zeros while reading len(rx) bytes, and if rx is
+// nil, it discards the bytes read while writing tx.
+//
+// Buffers larger than the bufsiz limit of the kernel driver are
+// transferred in several requests. The chip select is left asserted
+// between them with cs_change, so they form a single transaction.
+func (c *devfsConn) Transfer(tx, rx []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, err := transferLen(tx, rx)
+	if err != nil {
+		return err
+	}
+	ps := getPayloads(1)
+	defer putPayloads(ps)
+	p := &(*ps)[0]
+	n := c.chunkSize()
+	for ; l > n; l -= n {
+		if *p, err = c.payload(driver.Message{Tx: head(tx, n), Rx: head(rx, n), CSChange: true}); err != nil {
+			return err
+		}
+		err = c.message(*ps)
+		runtime.KeepAlive(tx)
+		runtime.KeepAlive(rx)
+		if err != nil {
+			return err
+		}
+		tx, rx = tail(tx, n), tail(rx, n)
+	}
+	if *p, err = c.payload(driver.Message{Tx: tx, Rx: rx}); err != nil {
+		return err
+	}
+	err = c.message(*ps)
+	runtime.KeepAlive(tx)
+	runtime.KeepAlive(rx)
+	return err
+}
+
+// MaxTransferSize returns the bufsiz limit of the kernel driver.
+func (c *devfsConn) MaxTransferSize() int {
+	if c.bufsiz <= 0 {
+		return defaultBufsiz
+	}
+	return c.bufsiz
+}
+
+// chunkSize returns the largest number of bytes of a request,
+// rounded down to a whole number of words.
+func (c *devfsConn) chunkSize() int {
+	n := c.bufsiz
+	if n <= 0 {
+		n = defaultBufsiz
+	}
+	w := wordSize(int(c.bits))
+	if n < w {
+		return w
+	}
+	return n - n%w
+}
+
+// maxMessages is the largest number of messages of an SPI_IOC_MESSAGE
+// request, whose size must fit in the size field of the request code.
+const maxMessages = (1<<devfs_SIZEBITS - 1) / int(unsafe.Sizeof(payload{}))
+
+// TransferMany performs the transfers of msgs in order with a single
+// SPI_IOC_MESSAGE(len(msgs)) request, so the kernel runs them as one
+// transaction without returning to user space in between. It returns
+// an error for more than 511 messages, 255 on MIPS and PowerPC, which
+// don't fit in a request.
+func (c *devfsConn) TransferMany(msgs []driver.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if len(msgs) > maxMessages {
+		return fmt.Errorf("%d messages, more than the %d of a request", len(msgs), maxMessages)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pp := getPayloads(len(msgs))
+	defer putPayloads(pp)
+	ps := *pp
+	for i, m := range msgs {
+		p, err := c.payload(m)
+		if err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		ps[i] = p
+	}
+	err := c.message(ps)
+	// The messages reference the buffers.
+	runtime.KeepAlive(msgs)
+	return err
+}
+
+// debugPayloads, if non-nil, is called with the payloads
+// of each SPI_IOC_MESSAGE request before it is made.
+var debugPayloads func(ps []payload)
+
+// message makes the SPI_IOC_MESSAGE request of the payloads ps.
+func (c *devfsConn) message(ps []payload) error {
+	if debugPayloads != nil {
+		debugPayloads(ps)
+	}
+	return c.ioctl(msgRequestCode(uint32(len(ps))), unsafe.Pointer(&ps[0]))
+}
+
+// payload returns the kernel transfer struct for m. The zero
+// valued fields of m are filled from the connection's configuration.
+// A nil m.Tx leaves tx_buf null, and the kernel writes zeros;
+// a nil m.Rx leaves rx_buf null, and the kernel discards the read.
+func (c *devfsConn) payload(m driver.Message) (payload, error) {
+	l, err := transferLen(m.Tx, m.Rx)
+	if err != nil {
+		return payload{}, err
+	}
+	p := payload{
+		tx:        bufAddr(m.Tx),
+		rx:        bufAddr(m.Rx),
+		length:    uint32(l),
+		speed:     c.speed,
+		delay:     c.delay,
+		bits:      c.bits,
+		txNBits:   c.txNBits,
+		rxNBits:   c.rxNBits,
+		csChange:  c.csChange,
+		wordDelay: c.wordDelay,
+	}
+	if m.Speed != 0 {
+		p.speed = uint32(m.Speed)
+	}
+	if m.Bits != 0 {
+		if m.Bits < 0 || m.Bits > 32 {
+			return payload{}, fmt.Errorf("bits per word %d %w", m.Bits, errBitsRange)
+		}
+		p.bits = uint8(m.Bits)
+	}
+	if m.Delay != 0 {
+		// The kernel delay is a 16-bit number of microseconds.
+		us := microseconds(m.Delay)
+		if us < 0 || us > math.MaxUint16 {
+			return payload{}, fmt.Errorf("delay %v out of range [0, %v]", m.Delay, math.MaxUint16*time.Microsecond)
+		}
+		p.delay = uint16(us)
+	}
+	if m.TxNBits != 0 {
+		if !validNBits(m.TxNBits) {
+			return payload{}, fmt.Errorf("invalid number of tx lines: %v", m.TxNBits)
+		}
+		p.txNBits = uint8(m.TxNBits)
+	}
+	if m.RxNBits != 0 {
+		if !validNBits(m.RxNBits) {
+			return payload{}, fmt.Errorf("invalid number of rx lines: %v", m.RxNBits)
+		}
+		p.rxNBits = uint8(m.RxNBits)
+	}
+	switch {
+	case m.CSChange:
+		p.csChange = 1
+	case m.NoCSChange:
+		p.csChange = 0
+	}
+	return p, nil
+}
+
+// unsupported returns err, the error of the ioctl setting the
+// configuration key k, as an UnsupportedError if it means that the
+// kernel or the controller don't support the setting: ENOTTY for the
+// requests the kernel doesn't know, such as SPI_IOC_WR_MODE32 before
+// Linux 3.15, and EINVAL for the modes, bits per word and bit order
+// that the controller rejects.
+func unsupported(k int, err error) error {
+	switch {
+	case err == unix.ENOTTY:
+	case err == unix.EINVAL && k != driver.Speed:
+	default:
+		return err
+	}
+	return &UnsupportedError{Feature: keyName(k), Err: err}
+}
+
+// modeMask is the mode flags of the 8-bit mode. It excludes
+// SPI_LSB_FIRST, which the kernel keeps in the mode byte too: the Mode
+// query masks it out and the Mode configuration writes it back as it
+// is, so that the mode doesn't override the bit order set with Order.
+const modeMask = cpha | cpol | CSHigh | ThreeWire | Loop | NoCS | Ready
+
+// lsbFirst is SPI_LSB_FIRST, the bit of the mode byte set by Order.
+const lsbFirst = 0x08
+
+// mode32Mask is SPI_MODE_USER_MASK, the mode flags of the kernel:
+// the 8-bit mode, the flags for the dual, quad and octal transfers
+// (SPI_TX_DUAL to SPI_RX_OCTAL), SPI_CS_WORD, SPI_3WIRE_HIZ,
+// SPI_RX_CPHA_FLIP and the MOSI idle levels.
+const mode32Mask = 1<<19 - 1
+
+// validNBits returns whether n is a valid number of data lines.
+func validNBits(n int) bool {
+	switch n {
+	case 0, 1, 2, 4, 8:
+		return true
+	}
+	return false
+}
+
+// caps returns the capabilities of the device, see Device.Capabilities.
+func (c *devfsConn) caps() Caps {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var caps Caps
+	readOFCaps(&caps, spidevClassPath, c.path)
+	// Kernels without 32-bit mode support reject
+	// SPI_IOC_RD_MODE32 with ENOTTY.
+	_, err := c.readMode32()
+	caps.Mode32 = err == nil
+	return caps
+}
+
+// Ioctl issues the ioctl request with the argument arg
+// on the device file, see Device.Ioctl.
+func (c *devfsConn) Ioctl(request uintptr, arg unsafe.Pointer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ioctl(request, arg)
+}
+
+// Fd returns the file descriptor of the device file,
+// or ^uintptr(0) if the device file has none, see Device.Fd.
+func (c *devfsConn) Fd() uintptr {
+	if f, ok := c.f.(interface{ Fd() uintptr }); ok {
+		return f.Fd()
+	}
+	return ^uintptr(0)
+}
+
+// Close closes the device file without taking mu, which a transfer
+// abandoned after a timeout may hold while its ioctl is blocked in the
+// kernel. The kernel keeps the file open until the ioctl returns; the
+// later requests fail with ErrClosed instead of using a file descriptor
+// that may have been reused.
+func (c *devfsConn) Close() error {
+	c.closed.Store(true)
+	return c.f.Close()
+}
+
+// bufAddr returns the address of the first byte of b to be passed
+// to the kernel, or 0 if b is empty.
+//
+// The address is an integer, so it doesn't keep b alive: the callers
+// must keep b reachable with runtime.KeepAlive until the kernel is done
+// with it. The payloads themselves are passed as unsafe.Pointer
+// arguments of the system call, which keeps them alive during the call.
+func bufAddr(b []byte) uint64 {
+	if len(b) == 0 {
+		return 0
+	}
+	return uint64(uintptr(unsafe.Pointer(&b[0])))
+}
+
+// Directions and type of the spidev ioctl requests, for RequestCode.
+const (
+	IOCWrite = devfs_WRITE // _IOC_WRITE: the kernel reads the argument
+	IOCRead  = devfs_READ  // _IOC_READ: the kernel writes the argument
+	IOCMagic = devfs_MAGIC // SPI_IOC_MAGIC, the type of the spidev requests
+)
+
+// RequestCode returns the code of the ioctl request with the direction
+// dir, the type typ, the number nr and an argument of size bytes, like
+// the _IOC macro of the kernel, for use with Device.Ioctl.
+// For instance, RequestCode(IOCRead, IOCMagic, 4, 4) is
+// SPI_IOC_RD_MAX_SPEED_HZ.
+func RequestCode(dir, typ, nr, size uintptr) uintptr {
+	return requestCode(dir, typ, nr, size)
+}
+
+// MessageRequestCode returns the code of the SPI_IOC_MESSAGE(n)
+// request, for use with Device.Ioctl.
+func MessageRequestCode(n int) uintptr {
+	return msgRequestCode(uint32(n))
+}
+
+// requestCode returns the device specific request code for the specified direction,
+// type, number and size to be used in the ioctl call.
+func requestCode(dir, typ, nr, size uintptr) uintptr {
+	return (dir << devfs_DIRSHIFT) | (typ << devfs_TYPESHIFT) | (nr << devfs_NRSHIFT) | (size << devfs_SIZESHIFT)
+}
+
+// msgRequestCode returns the device specific value for the SPI
+// message payload to be used in the ioctl call.
+// n represents the number of messages.
+//
+// Like SPI_MSGSIZE, the size is zero if it doesn't fit in the size
+// field of the request. The kernel then returns without transferring
+// anything, so TransferMany rejects more than maxMessages messages.
+func msgRequestCode(n uint32) uintptr {
+	size := uintptr(n) * unsafe.Sizeof(payload{})
+	if size >= 1<<devfs_SIZEBITS {
+		size = 0
+	}
+	return requestCode(devfs_WRITE, devfs_MAGIC, 0, size)
+}
+
+// maxEINTR is the number of times an ioctl interrupted by a signal
+// is retried before giving up.
+const maxEINTR = 10
+
+// ioctl makes an IOCTL on the open device file.
+// The IOCTL is retried if it is interrupted by a signal.
+func (c *devfsConn) ioctl(req uintptr, arg unsafe.Pointer) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	var err error
+	for i := 0; i <= maxEINTR; i++ {
+		if err = c.f.Ioctl(req, arg); err != unix.EINTR {
+			break
+		}
+	}
+	return err
+}
@@ -0,0 +1,1882 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/sys/unix"
+)
+
+// fakeDev emulates the ioctl interface of the spidev kernel driver.
+type fakeDev struct {
+	// mode holds the bit order too, in SPI_LSB_FIRST, like the kernel.
+	mode  uint32
+	bits  uint8
+	speed uint32
+
+	// maxSpeed, if non-zero, is the maximum speed of the controller,
+	// which clamps the speeds written.
+	maxSpeed uint32
+
+	// bufsiz, if non-zero, is the maximum number of bytes
+	// of a SPI_IOC_MESSAGE request.
+	bufsiz uint32
+
+	// msgs holds the payloads of each SPI_IOC_MESSAGE request.
+	msgs [][]payload
+	// txs holds the bytes clocked out by each payload.
+	txs [][]byte
+	// reqs holds the request codes of all ioctls.
+	reqs []uintptr
+}
+
+func (d *fakeDev) conn() *devfsConn {
+	return &devfsConn{f: d}
+}
+
+func (d *fakeDev) Ioctl(req uintptr, arg unsafe.Pointer) error {
+	return ioctlFunc(d.ioctl).Ioctl(req, arg)
+}
+
+func (d *fakeDev) Close() error { return nil }
+
+// ioctlFunc is a DevFile calling the function for the ioctls.
+type ioctlFunc func(fd, req uintptr, arg unsafe.Pointer) unix.Errno
+
+func (f ioctlFunc) Ioctl(req uintptr, arg unsafe.Pointer) error {
+	if errno := f(0, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (f ioctlFunc) Close() error { return nil }
+
+func (d *fakeDev) ioctl(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+	d.reqs = append(d.reqs, req)
+	switch req {
+	case requestCode(devfs_WRITE, devfs_MAGIC, 1, 1):
+		d.mode = d.mode&^0xff | uint32(*(*uint8)(arg))
+	case requestCode(devfs_WRITE, devfs_MAGIC, 2, 1):
+		d.mode &^= lsbFirst
+		if *(*uint8)(arg) != 0 {
+			d.mode |= lsbFirst
+		}
+	case requestCode(devfs_WRITE, devfs_MAGIC, 3, 1):
+		d.bits = *(*uint8)(arg)
+	case requestCode(devfs_WRITE, devfs_MAGIC, 4, 4):
+		d.speed = *(*uint32)(arg)
+		if d.maxSpeed != 0 && d.speed > d.maxSpeed {
+			d.speed = d.maxSpeed
+		}
+	case requestCode(devfs_WRITE, devfs_MAGIC, 5, 4):
+		d.mode = *(*uint32)(arg)
+	case requestCode(devfs_READ, devfs_MAGIC, 1, 1):
+		*(*uint8)(arg) = uint8(d.mode)
+	case requestCode(devfs_READ, devfs_MAGIC, 2, 1):
+		*(*uint8)(arg) = uint8(d.mode&lsbFirst) >> 3
+	case requestCode(devfs_READ, devfs_MAGIC, 3, 1):
+		*(*uint8)(arg) = d.bits
+	case requestCode(devfs_READ, devfs_MAGIC, 4, 4):
+		*(*uint32)(arg) = d.speed
+	case requestCode(devfs_READ, devfs_MAGIC, 5, 4):
+		*(*uint32)(arg) = d.mode
+	default:
+		n := (req - msgRequestCode(0)) / (msgRequestCode(1) - msgRequestCode(0))
+		if n == 0 || req != msgRequestCode(uint32(n)) {
+			return unix.ENOTTY
+		}
+		ps := unsafe.Slice((*payload)(arg), n)
+		if d.bufsiz != 0 {
+			var total uint32
+			for _, p := range ps {
+				total += p.length
+			}
+			if total > d.bufsiz {
+				return unix.EMSGSIZE
+			}
+		}
+		d.msgs = append(d.msgs, append([]payload(nil), ps...))
+		for _, p := range ps {
+			tx := append([]byte(nil), bytesAt(p.tx, p.length)...)
+			d.txs = append(d.txs, tx)
+			if d.mode&uint32(Loop) != 0 && p.rx != 0 {
+				// A null tx_buf writes zeros.
+				rx := bytesAt(p.rx, p.length)
+				for i := copy(rx, tx); i < len(rx); i++ {
+					rx[i] = 0
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// bytesAt returns the n bytes at the user-space address addr.
+func bytesAt(addr uint64, n uint32) []byte {
+	if addr == 0 {
+		return nil
+	}
+	a := uintptr(addr)
+	return unsafe.Slice(*(**byte)(unsafe.Pointer(&a)), n)
+}
+
+// ioc converts the generic code of a request, of asm-generic/ioctl.h,
+// to the encoding of the host, which differs on MIPS and PowerPC.
+func ioc(generic uintptr) uintptr {
+	if devfs_DIRBITS == 2 {
+		return generic
+	}
+	dir := generic >> 30
+	code := generic &^ (3 << 30)
+	if dir&1 != 0 {
+		code |= devfs_WRITE << devfs_DIRSHIFT
+	}
+	if dir&2 != 0 {
+		code |= devfs_READ << devfs_DIRSHIFT
+	}
+	return code
+}
+
+func TestRequestCode(t *testing.T) {
+	// Values of the request codes defined in linux/spi/spidev.h.
+	tests := []struct {
+		name string
+		got  uintptr
+		want uintptr
+	}{
+		{"SPI_IOC_WR_MODE", requestCode(devfs_WRITE, devfs_MAGIC, 1, 1), ioc(0x40016b01)},
+		{"SPI_IOC_RD_MODE", requestCode(devfs_READ, devfs_MAGIC, 1, 1), ioc(0x80016b01)},
+		{"SPI_IOC_WR_LSB_FIRST", requestCode(devfs_WRITE, devfs_MAGIC, 2, 1), ioc(0x40016b02)},
+		{"SPI_IOC_RD_LSB_FIRST", requestCode(devfs_READ, devfs_MAGIC, 2, 1), ioc(0x80016b02)},
+		{"SPI_IOC_WR_BITS_PER_WORD", requestCode(devfs_WRITE, devfs_MAGIC, 3, 1), ioc(0x40016b03)},
+		{"SPI_IOC_RD_BITS_PER_WORD", requestCode(devfs_READ, devfs_MAGIC, 3, 1), ioc(0x80016b03)},
+		{"SPI_IOC_WR_MAX_SPEED_HZ", requestCode(devfs_WRITE, devfs_MAGIC, 4, 4), ioc(0x40046b04)},
+		{"SPI_IOC_RD_MAX_SPEED_HZ", requestCode(devfs_READ, devfs_MAGIC, 4, 4), ioc(0x80046b04)},
+		{"SPI_IOC_WR_MODE32", requestCode(devfs_WRITE, devfs_MAGIC, 5, 4), ioc(0x40046b05)},
+		{"SPI_IOC_RD_MODE32", requestCode(devfs_READ, devfs_MAGIC, 5, 4), ioc(0x80046b05)},
+		{"SPI_IOC_MESSAGE(1)", msgRequestCode(1), ioc(0x40206b00)},
+		{"SPI_IOC_MESSAGE(2)", msgRequestCode(2), ioc(0x40406b00)},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s=%#x, want %#x", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestTransferManyTooMany(t *testing.T) {
+	// The size of more than maxMessages messages doesn't fit in the
+	// request code, and the kernel would transfer nothing.
+	n := uint32(maxMessages)
+	if got := msgRequestCode(n) >> devfs_SIZESHIFT & (1<<devfs_SIZEBITS - 1); got != uintptr(n)*unsafe.Sizeof(payload{}) {
+		t.Errorf("size of msgRequestCode(%d)=%d, want %d", n, got, uintptr(n)*unsafe.Sizeof(payload{}))
+	}
+	if got := msgRequestCode(n+1) >> devfs_SIZESHIFT & (1<<devfs_SIZEBITS - 1); got != 0 {
+		t.Errorf("size of msgRequestCode(%d)=%d, want 0", n+1, got)
+	}
+
+	d := &fakeDev{}
+	c := d.conn()
+	msgs := make([]driver.Message, maxMessages+1)
+	for i := range msgs {
+		msgs[i] = driver.Message{Tx: []byte{byte(i)}, Rx: make([]byte, 1)}
+	}
+	if err := c.TransferMany(msgs); err == nil {
+		t.Errorf("TransferMany of %d messages succeeded, want error", len(msgs))
+	}
+	if len(d.msgs) != 0 {
+		t.Errorf("got %d requests, want none", len(d.msgs))
+	}
+	if err := c.TransferMany(msgs[:maxMessages]); err != nil {
+		t.Errorf("TransferMany of %d messages: %v", maxMessages, err)
+	}
+}
+
+func TestDevFSIoctl(t *testing.T) {
+	d := &fakeDev{speed: 500000}
+	dev := &Device{conn: d.conn()}
+	req := RequestCode(IOCRead, IOCMagic, 4, 4)
+	if req != ioc(0x80046b04) {
+		t.Errorf("RequestCode(IOCRead, IOCMagic, 4, 4)=%#x, want %#x", req, ioc(0x80046b04))
+	}
+	var speed uint32
+	if err := dev.Ioctl(req, unsafe.Pointer(&speed)); err != nil {
+		t.Fatalf("Ioctl: %v", err)
+	}
+	if speed != 500000 {
+		t.Errorf("speed=%d, want 500000", speed)
+	}
+	if err := dev.Ioctl(RequestCode(IOCRead, IOCMagic, 0x7f, 4), unsafe.Pointer(&speed)); err != unix.ENOTTY {
+		t.Errorf("Ioctl with an unknown request=%v, want %v", err, unix.ENOTTY)
+	}
+	if got, want := MessageRequestCode(3), ioc(0x40606b00); got != want {
+		t.Errorf("MessageRequestCode(3)=%#x, want %#x", got, want)
+	}
+}
+
+func TestPayloadLayout(t *testing.T) {
+	// Layout of struct spi_ioc_transfer in linux/spi/spidev.h.
+	var p payload
+	tests := []struct {
+		name string
+		got  uintptr
+		want uintptr
+	}{
+		{"tx_buf", unsafe.Offsetof(p.tx), 0},
+		{"rx_buf", unsafe.Offsetof(p.rx), 8},
+		{"len", unsafe.Offsetof(p.length), 16},
+		{"speed_hz", unsafe.Offsetof(p.speed), 20},
+		{"delay_usecs", unsafe.Offsetof(p.delay), 24},
+		{"bits_per_word", unsafe.Offsetof(p.bits), 26},
+		{"cs_change", unsafe.Offsetof(p.csChange), 27},
+		{"tx_nbits", unsafe.Offsetof(p.txNBits), 28},
+		{"rx_nbits", unsafe.Offsetof(p.rxNBits), 29},
+		{"word_delay_usecs", unsafe.Offsetof(p.wordDelay), 30},
+		{"pad", unsafe.Offsetof(p.pad), 31},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("offset of %s=%d, want %d", test.name, test.got, test.want)
+		}
+	}
+	if size := unsafe.Sizeof(p); size != 32 {
+		t.Errorf("size=%d, want 32", size)
+	}
+	ps := make([]payload, 2)
+	if stride := uintptr(unsafe.Pointer(&ps[1])) - uintptr(unsafe.Pointer(&ps[0])); stride != 32 {
+		t.Errorf("array stride=%d, want 32", stride)
+	}
+}
+
+func TestPayloadString(t *testing.T) {
+	p := payload{
+		tx:        0x1000,
+		rx:        0x2000,
+		length:    4,
+		speed:     500000,
+		delay:     10,
+		bits:      16,
+		csChange:  1,
+		txNBits:   2,
+		rxNBits:   4,
+		wordDelay: 3,
+	}
+	raw := make([]byte, 32)
+	nativeEndian.PutUint64(raw[0:], p.tx)
+	nativeEndian.PutUint64(raw[8:], p.rx)
+	nativeEndian.PutUint32(raw[16:], p.length)
+	nativeEndian.PutUint32(raw[20:], p.speed)
+	nativeEndian.PutUint16(raw[24:], p.delay)
+	copy(raw[26:], []byte{16, 1, 2, 4, 3, 0})
+	want := "tx_buf=0x1000 rx_buf=0x2000 len=4 speed_hz=500000 delay_usecs=10 bits_per_word=16 cs_change=1 tx_nbits=2 rx_nbits=4 word_delay_usecs=3 " +
+		fmt.Sprintf("[% x]", raw)
+	if got := p.String(); got != want {
+		t.Errorf("String()=%q, want %q", got, want)
+	}
+}
+
+func TestDebugPayloads(t *testing.T) {
+	defer func(f func([]payload)) { debugPayloads = f }(debugPayloads)
+	var got []payload
+	debugPayloads = func(ps []payload) { got = append(got, ps...) }
+
+	d := &fakeDev{}
+	c := d.conn()
+	msgs := []driver.Message{
+		{Tx: []byte{1, 2}, Bits: 8},
+		{Rx: make([]byte, 3), Speed: 1000},
+	}
+	if err := c.TransferMany(msgs); err != nil {
+		t.Fatalf("TransferMany: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("debugged %d payloads, want 2", len(got))
+	}
+	if got[0].length != 2 || got[0].bits != 8 || got[1].length != 3 || got[1].speed != 1000 {
+		t.Errorf("debugged payloads %v and %v", &got[0], &got[1])
+	}
+}
+
+func TestQuery(t *testing.T) {
+	d := &fakeDev{mode: 3 | lsbFirst, bits: 16, speed: 10000000}
+	c := d.conn()
+	tests := []struct {
+		k    int
+		want int
+	}{
+		{driver.Mode, 3},
+		{driver.Order, 1},
+		{driver.Bits, 16},
+		{driver.Speed, 10000000},
+	}
+	for _, test := range tests {
+		v, err := c.Query(test.k)
+		if err != nil {
+			t.Errorf("Query(%d): %v", test.k, err)
+			continue
+		}
+		if v != test.want {
+			t.Errorf("Query(%d)=%d, want %d", test.k, v, test.want)
+		}
+	}
+	if _, err := c.Query(-1); err == nil {
+		t.Errorf("Query(-1) succeeded, want error")
+	}
+}
+
+func TestConfigureMode32(t *testing.T) {
+	tests := []struct {
+		mode uint32
+		req  uintptr
+	}{
+		{0x03, requestCode(devfs_WRITE, devfs_MAGIC, 1, 1)},
+		{0xff, requestCode(devfs_WRITE, devfs_MAGIC, 1, 1)},
+		{0x0203, requestCode(devfs_WRITE, devfs_MAGIC, 5, 4)},
+		{0x800, requestCode(devfs_WRITE, devfs_MAGIC, 5, 4)},
+	}
+	for _, test := range tests {
+		d := &fakeDev{}
+		c := d.conn()
+		if err := c.Configure(driver.Mode32, int(test.mode)); err != nil {
+			t.Errorf("Configure(Mode32, %#x): %v", test.mode, err)
+			continue
+		}
+		if len(d.reqs) != 1 || d.reqs[0] != test.req {
+			t.Errorf("Configure(Mode32, %#x) issued %#x, want [%#x]", test.mode, d.reqs, test.req)
+		}
+		m, err := c.Query(driver.Mode32)
+		if err != nil {
+			t.Errorf("Query(Mode32): %v", err)
+			continue
+		}
+		if uint32(m) != test.mode {
+			t.Errorf("Query(Mode32)=%#x, want %#x", m, test.mode)
+		}
+	}
+}
+
+func TestDeviceMode32(t *testing.T) {
+	// The controller dropped SPI_TX_QUAD and SPI_RX_QUAD, keeping dual.
+	d := &fakeDev{mode: 0x0503}
+	dev := &Device{conn: d.conn()}
+	m, err := dev.Mode32()
+	if err != nil {
+		t.Fatalf("Mode32: %v", err)
+	}
+	if m != 0x0503 {
+		t.Errorf("Mode32()=%#x, want 0x503", m)
+	}
+	want := []uintptr{requestCode(devfs_READ, devfs_MAGIC, 5, 4)}
+	if !reflect.DeepEqual(d.reqs, want) {
+		t.Errorf("ioctls=%#x, want %#x", d.reqs, want)
+	}
+}
+
+func TestConfigureUnsupported(t *testing.T) {
+	tests := []struct {
+		k           int
+		v           int
+		errno       unix.Errno
+		unsupported bool
+	}{
+		{driver.Mode32, 0x800, unix.ENOTTY, true},
+		{driver.Mode, int(Mode0 | Ready), unix.EINVAL, true},
+		{driver.Bits, 12, unix.EINVAL, true},
+		{driver.Order, int(LSBFirst), unix.EINVAL, true},
+		{driver.Speed, 1000000, unix.ENOTTY, true},
+		{driver.Speed, 1000000, unix.EINVAL, false},
+		{driver.Mode, int(Mode0), unix.EBUSY, false},
+	}
+	for _, test := range tests {
+		d := &fakeDev{}
+		c := d.conn()
+		c.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+			if req>>devfs_DIRSHIFT == devfs_WRITE {
+				return test.errno
+			}
+			return d.ioctl(fd, req, arg)
+		})
+		err := c.Configure(test.k, test.v)
+		if !errors.Is(err, test.errno) {
+			t.Errorf("Configure(%s, %d)=%v, want %v", keyName(test.k), test.v, err, test.errno)
+		}
+		if errors.Is(err, ErrUnsupported) != test.unsupported {
+			t.Errorf("Configure(%s, %d)=%v, errors.Is(err, ErrUnsupported)=%v, want %v", keyName(test.k), test.v, err, !test.unsupported, test.unsupported)
+		}
+	}
+}
+
+func TestConfigureBits(t *testing.T) {
+	tests := []struct {
+		bits  int
+		want  uint8
+		valid bool
+	}{
+		{8, 8, true},
+		{16, 16, true},
+		{0, 8, true},
+		{32, 32, true},
+		{33, 0, false},
+		{300, 0, false},
+		{-1, 0, false},
+	}
+	for _, test := range tests {
+		d := &fakeDev{}
+		err := d.conn().Configure(driver.Bits, test.bits)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("Configure(Bits, %d) succeeded, want error", test.bits)
+			}
+			if len(d.reqs) != 0 {
+				t.Errorf("Configure(Bits, %d) issued %#x, want none", test.bits, d.reqs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Configure(Bits, %d)=%v, want nil", test.bits, err)
+			continue
+		}
+		if d.bits != test.want {
+			t.Errorf("Configure(Bits, %d) set %d bits, want %d", test.bits, d.bits, test.want)
+		}
+	}
+}
+
+func TestConfigureInvalidMode(t *testing.T) {
+	tests := []struct {
+		k     int
+		mode  int
+		valid bool
+	}{
+		{driver.Mode, int(Mode3 | CSHigh), true},
+		{driver.Mode, 0xf7, true},
+		{driver.Mode, 0x08, false}, // SPI_LSB_FIRST
+		{driver.Mode, 0xff, false},
+		{driver.Mode, 0x100, false},
+		{driver.Mode, -1, false},
+		{driver.Mode32, 0x0203, true},
+		{driver.Mode32, 1<<19 - 1, true},
+		{driver.Mode32, 1 << 19, false},
+		{driver.Mode32, 1<<20 | 3, false},
+		{driver.Mode32, -1, false},
+	}
+	for _, test := range tests {
+		d := &fakeDev{}
+		err := d.conn().Configure(test.k, test.mode)
+		if test.valid {
+			if err != nil {
+				t.Errorf("Configure(%d, %#x)=%v, want nil", test.k, test.mode, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidMode) {
+			t.Errorf("Configure(%d, %#x)=%v, want ErrInvalidMode", test.k, test.mode, err)
+		}
+		if len(d.reqs) != 0 {
+			t.Errorf("Configure(%d, %#x) issued %#x, want none", test.k, test.mode, d.reqs)
+		}
+	}
+}
+
+func TestDeviceMaxSpeed(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetMaxSpeed(1000000); err != nil {
+		t.Fatalf("SetMaxSpeed: %v", err)
+	}
+	d.speed = 500000 // the driver lowered the speed.
+	speed, err := dev.MaxSpeed()
+	if err != nil {
+		t.Fatalf("MaxSpeed: %v", err)
+	}
+	if speed != 500000 {
+		t.Errorf("MaxSpeed()=%d, want 500000", speed)
+	}
+}
+
+func TestTransferLoopback(t *testing.T) {
+	d := &fakeDev{}
+	c := d.conn()
+	if err := c.Configure(driver.Mode, int(Mode3|Loop)); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	tx := []byte{0xde, 0xad, 0xbe, 0xef, 0x00, 0xff, 0x55, 0xaa}
+	rx := make([]byte, len(tx))
+	if err := c.Transfer(tx, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !bytes.Equal(rx, tx) {
+		t.Errorf("rx=% x, want % x", rx, tx)
+	}
+	if len(d.msgs) != 1 || len(d.msgs[0]) != 1 {
+		t.Fatalf("got %d ioctls, want 1 with one message", len(d.msgs))
+	}
+	if got := d.msgs[0][0].length; got != uint32(len(tx)) {
+		t.Errorf("payload length=%d, want %d", got, len(tx))
+	}
+}
+
+func TestTransferNilTx(t *testing.T) {
+	d := &fakeDev{bufsiz: 4}
+	c := d.conn()
+	c.bufsiz = 4
+	if err := c.Configure(driver.Mode, int(Loop)); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	rx := bytes.Repeat([]byte{0xff}, 6)
+	if err := c.Transfer(nil, rx); err != nil {
+		t.Fatalf("Transfer(nil, rx): %v", err)
+	}
+	if want := make([]byte, len(rx)); !bytes.Equal(rx, want) {
+		t.Errorf("rx=% x, want % x", rx, want)
+	}
+	var lengths []uint32
+	for i, ps := range d.msgs {
+		if ps[0].tx != 0 {
+			t.Errorf("request %d: tx_buf=%#x, want 0", i, ps[0].tx)
+		}
+		lengths = append(lengths, ps[0].length)
+	}
+	if want := []uint32{4, 2}; !reflect.DeepEqual(lengths, want) {
+		t.Errorf("payload lengths=%v, want %v", lengths, want)
+	}
+}
+
+func TestTransferNilRx(t *testing.T) {
+	d := &fakeDev{}
+	c := d.conn()
+	if err := c.Configure(driver.Mode, int(Loop)); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	tx := []byte{1, 2, 3}
+	if err := c.Transfer(tx, nil); err != nil {
+		t.Fatalf("Transfer(tx, nil): %v", err)
+	}
+	if len(d.msgs) != 1 {
+		t.Fatalf("got %d ioctls, want 1", len(d.msgs))
+	}
+	if p := d.msgs[0][0]; p.rx != 0 || p.length != uint32(len(tx)) {
+		t.Errorf("rx_buf=%#x, len=%d, want 0, %d", p.rx, p.length, len(tx))
+	}
+	if !bytes.Equal(d.txs[0], tx) {
+		t.Errorf("tx=% x, want % x", d.txs[0], tx)
+	}
+}
+
+func TestTransferLengthMismatch(t *testing.T) {
+	tests := []struct {
+		tx, rx []byte
+	}{
+		{tx: make([]byte, 4), rx: make([]byte, 3)},
+		{tx: make([]byte, 4), rx: make([]byte, 5)},
+		{tx: make([]byte, 4), rx: []byte{}},
+	}
+	for _, test := range tests {
+		d := &fakeDev{}
+		if err := d.conn().Transfer(test.tx, test.rx); err == nil {
+			t.Errorf("Transfer(len(tx)=%d, len(rx)=%d) succeeded, want error", len(test.tx), len(test.rx))
+		}
+		if len(d.msgs) != 0 {
+			t.Errorf("Transfer(len(tx)=%d, len(rx)=%d) issued %d ioctls, want 0", len(test.tx), len(test.rx), len(d.msgs))
+		}
+	}
+}
+
+func TestTransferEmpty(t *testing.T) {
+	tests := []struct {
+		tx, rx []byte
+	}{
+		{tx: nil, rx: nil},
+		{tx: []byte{}, rx: []byte{}},
+	}
+	for _, test := range tests {
+		d := &fakeDev{}
+		if err := d.conn().Transfer(test.tx, test.rx); err != nil {
+			t.Errorf("Transfer(%#v, %#v): %v", test.tx, test.rx, err)
+			continue
+		}
+		if len(d.msgs) != 1 {
+			t.Errorf("Transfer(%#v, %#v) issued %d ioctls, want 1", test.tx, test.rx, len(d.msgs))
+			continue
+		}
+		if p := d.msgs[0][0]; p.tx != 0 || p.rx != 0 || p.length != 0 {
+			t.Errorf("Transfer(%#v, %#v) payload tx=%#x rx=%#x length=%d, want all 0", test.tx, test.rx, p.tx, p.rx, p.length)
+		}
+	}
+}
+
+func TestTransferChunks(t *testing.T) {
+	d := &fakeDev{mode: uint32(Loop), bufsiz: 4096}
+	c := d.conn()
+	c.bufsiz = 4096
+	tx := make([]byte, 10*1024)
+	for i := range tx {
+		tx[i] = byte(i * 7)
+	}
+	rx := make([]byte, len(tx))
+	if err := c.Transfer(tx, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !bytes.Equal(rx, tx) {
+		t.Errorf("rx does not match tx")
+	}
+	if !bytes.Equal(bytes.Join(d.txs, nil), tx) {
+		t.Errorf("transferred bytes do not match tx")
+	}
+	wantLens := []uint32{4096, 4096, 2048}
+	if len(d.msgs) != len(wantLens) {
+		t.Fatalf("Transfer issued %d ioctls, want %d", len(d.msgs), len(wantLens))
+	}
+	for i, ps := range d.msgs {
+		if ps[0].length != wantLens[i] {
+			t.Errorf("request %d length=%d, want %d", i, ps[0].length, wantLens[i])
+		}
+		last := i == len(d.msgs)-1
+		if cs := ps[0].csChange != 0; cs == last {
+			t.Errorf("request %d cs_change=%v, want %v", i, cs, !last)
+		}
+	}
+}
+
+func TestTransferMany(t *testing.T) {
+	d := &fakeDev{}
+	c := d.conn()
+	if err := c.Configure(driver.Mode, int(Loop)); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	msgs := []driver.Message{
+		{Tx: []byte{0x01}, Rx: make([]byte, 1)},
+		{Tx: []byte{0x02, 0x03}, Rx: make([]byte, 2)},
+		{Tx: []byte{0x04, 0x05, 0x06}, Rx: make([]byte, 3)},
+	}
+	if err := c.TransferMany(msgs); err != nil {
+		t.Fatalf("TransferMany: %v", err)
+	}
+	if len(d.msgs) != 1 {
+		t.Fatalf("got %d ioctls, want 1", len(d.msgs))
+	}
+	if len(d.msgs[0]) != len(msgs) {
+		t.Fatalf("got %d payloads, want %d", len(d.msgs[0]), len(msgs))
+	}
+	for i, m := range msgs {
+		if !bytes.Equal(d.txs[i], m.Tx) {
+			t.Errorf("payload %d: tx=% x, want % x", i, d.txs[i], m.Tx)
+		}
+		if !bytes.Equal(m.Rx, m.Tx) {
+			t.Errorf("message %d: rx=% x, want % x", i, m.Rx, m.Tx)
+		}
+	}
+}
+
+func TestTxPairs(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetLoopback(true); err != nil {
+		t.Fatalf("SetLoopback: %v", err)
+	}
+	pairs := [][2][]byte{
+		{[]byte{0x01, 0x02}, make([]byte, 2)},
+		{[]byte{0x03, 0x04, 0x05}, make([]byte, 3)},
+	}
+	if err := dev.TxPairs(pairs); err != nil {
+		t.Fatalf("TxPairs: %v", err)
+	}
+	if len(d.msgs) != 1 || len(d.msgs[0]) != len(pairs) {
+		t.Fatalf("got %d ioctls, want 1 with %d messages", len(d.msgs), len(pairs))
+	}
+	for i, p := range d.msgs[0] {
+		if p.csChange != 0 {
+			t.Errorf("payload %d: cs_change=%d, want 0", i, p.csChange)
+		}
+	}
+	for i, p := range pairs {
+		if !bytes.Equal(p[1], p[0]) {
+			t.Errorf("pair %d: rx=% x, want % x", i, p[1], p[0])
+		}
+	}
+}
+
+func TestTxvChunks(t *testing.T) {
+	d := &fakeDev{bufsiz: 4}
+	c := d.conn()
+	c.bufsiz = 4
+	dev := &Device{conn: c}
+	if err := dev.Txv(nil, []byte{1}, []byte{2, 3, 4}, []byte{5, 6}); err != nil {
+		t.Fatalf("Txv: %v", err)
+	}
+	// The parts are a single transfer, split at bufsiz only.
+	if len(d.txs) != 2 || !bytes.Equal(d.txs[0], []byte{1, 2, 3, 4}) || !bytes.Equal(d.txs[1], []byte{5, 6}) {
+		t.Errorf("transferred % x, want [01 02 03 04] [05 06]", d.txs)
+	}
+}
+
+func TestHeldCSHelpers(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(dev *Device) error
+	}{
+		{"WriteThenRead", func(dev *Device) error { return dev.WriteThenRead([]byte{1}, make([]byte, 2)) }},
+		{"WriteReg", func(dev *Device) error { return dev.WriteReg(1, []byte{2, 3}) }},
+		{"TxPairs", func(dev *Device) error { return dev.TxPairs([][2][]byte{{{1}, {0}}, {{2}, {0}}}) }},
+	}
+	for _, test := range tests {
+		d := &fakeDev{}
+		dev := &Device{conn: d.conn()}
+		if err := dev.SetCSChange(true); err != nil {
+			t.Fatalf("SetCSChange: %v", err)
+		}
+		if err := test.f(dev); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(d.msgs) != 1 || len(d.msgs[0]) != 2 {
+			t.Errorf("%s: got %d ioctls, want 1 with 2 messages", test.name, len(d.msgs))
+			continue
+		}
+		// The chip select is held between the messages, and left
+		// asserted afterwards like the transfers of the device.
+		if cs := []uint8{d.msgs[0][0].csChange, d.msgs[0][1].csChange}; cs[0] != 0 || cs[1] != 1 {
+			t.Errorf("%s: cs_change=%v, want [0 1]", test.name, cs)
+		}
+	}
+}
+
+func TestTransferManyOverrides(t *testing.T) {
+	d := &fakeDev{}
+	c := d.conn()
+	if err := c.Configure(driver.Speed, 500000); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if err := c.Configure(driver.Bits, 8); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if err := c.Configure(driver.Delay, 10); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	msgs := []driver.Message{
+		{Tx: []byte{0x01}, Rx: make([]byte, 1)},
+		{
+			Tx:       []byte{0x02, 0x03},
+			Rx:       make([]byte, 2),
+			Speed:    1000000,
+			Bits:     16,
+			Delay:    20 * time.Microsecond,
+			CSChange: true,
+		},
+	}
+	if err := c.TransferMany(msgs); err != nil {
+		t.Fatalf("TransferMany: %v", err)
+	}
+	want := []payload{
+		{speed: 500000, bits: 8, delay: 10, csChange: 0},
+		{speed: 1000000, bits: 16, delay: 20, csChange: 1},
+	}
+	for i, p := range d.msgs[0] {
+		w := want[i]
+		if p.speed != w.speed || p.bits != w.bits || p.delay != w.delay || p.csChange != w.csChange {
+			t.Errorf("payload %d: speed=%d bits=%d delay=%d csChange=%d, want speed=%d bits=%d delay=%d csChange=%d",
+				i, p.speed, p.bits, p.delay, p.csChange, w.speed, w.bits, w.delay, w.csChange)
+		}
+	}
+}
+
+func TestTransferManyBits(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetBitsPerWord(8); err != nil {
+		t.Fatalf("SetBitsPerWord: %v", err)
+	}
+	// An 8-bit command followed by 16-bit data, then a message
+	// using the device's bits per word again.
+	msgs := []Message{
+		{Tx: []byte{0x2c}},
+		{Tx: make([]byte, 4), Bits: 16},
+		{Tx: []byte{0x00}},
+	}
+	if err := dev.TxMany(msgs); err != nil {
+		t.Fatalf("TxMany: %v", err)
+	}
+	if len(d.msgs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(d.msgs))
+	}
+	for i, want := range []uint8{8, 16, 8} {
+		if got := d.msgs[0][i].bits; got != want {
+			t.Errorf("payload %d: bits=%d, want %d", i, got, want)
+		}
+	}
+	for _, bits := range []int{-1, 33, 264} {
+		err := dev.TxMany([]Message{{Tx: make([]byte, 4), Bits: bits}})
+		if !errors.Is(err, errBitsRange) {
+			t.Errorf("TxMany with Bits=%d: %v, want %v", bits, err, errBitsRange)
+		}
+	}
+}
+
+func TestTransferManyCSChange(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	flags := []bool{true, false, false, true}
+	msgs := make([]Message, len(flags))
+	for i, f := range flags {
+		msgs[i] = Message{Tx: []byte{byte(i)}, CSChange: f}
+	}
+	if err := dev.TxMany(msgs); err != nil {
+		t.Fatalf("TxMany: %v", err)
+	}
+	if len(d.msgs) != 1 || len(d.msgs[0]) != len(flags) {
+		t.Fatalf("got payloads %v, want a single request of %d", d.msgs, len(flags))
+	}
+	for i, p := range d.msgs[0] {
+		want := uint8(0)
+		if flags[i] {
+			want = 1
+		}
+		if p.csChange != want {
+			t.Errorf("payload %d: csChange=%d, want %d", i, p.csChange, want)
+		}
+	}
+}
+
+func TestConfigureNBits(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 4, 8} {
+		c := (&fakeDev{}).conn()
+		if err := c.Configure(driver.TxNBits, n); err != nil {
+			t.Errorf("Configure(TxNBits, %d): %v", n, err)
+		}
+		if err := c.Configure(driver.RxNBits, n); err != nil {
+			t.Errorf("Configure(RxNBits, %d): %v", n, err)
+		}
+	}
+	for _, n := range []int{-1, 3, 5, 16} {
+		c := (&fakeDev{}).conn()
+		if err := c.Configure(driver.TxNBits, n); err == nil {
+			t.Errorf("Configure(TxNBits, %d) succeeded, want error", n)
+		}
+		if err := c.Configure(driver.RxNBits, n); err == nil {
+			t.Errorf("Configure(RxNBits, %d) succeeded, want error", n)
+		}
+	}
+}
+
+func TestTransferManyNBits(t *testing.T) {
+	d := &fakeDev{}
+	c := d.conn()
+	if err := c.Configure(driver.TxNBits, 2); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if err := c.Configure(driver.RxNBits, 2); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	msgs := []driver.Message{
+		{Tx: []byte{0x6b}, Rx: make([]byte, 1)},
+		{Tx: make([]byte, 4), Rx: make([]byte, 4), TxNBits: 4, RxNBits: 4},
+	}
+	if err := c.TransferMany(msgs); err != nil {
+		t.Fatalf("TransferMany: %v", err)
+	}
+	for i, want := range []uint8{2, 4} {
+		p := d.msgs[0][i]
+		if p.txNBits != want || p.rxNBits != want {
+			t.Errorf("payload %d: txNBits=%d rxNBits=%d, want %d", i, p.txNBits, p.rxNBits, want)
+		}
+	}
+	bad := []driver.Message{{Tx: make([]byte, 1), Rx: make([]byte, 1), RxNBits: 3}}
+	if err := c.TransferMany(bad); err == nil {
+		t.Errorf("TransferMany with RxNBits=3 succeeded, want error")
+	}
+}
+
+func TestIoctlEINTR(t *testing.T) {
+	d := &fakeDev{}
+	eintrs := 2
+	calls := 0
+	c := &devfsConn{f: ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		calls++
+		if eintrs > 0 {
+			eintrs--
+			return unix.EINTR
+		}
+		return d.ioctl(fd, req, arg)
+	})}
+	if err := c.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if calls != 3 || len(d.msgs) != 1 {
+		t.Errorf("got %d calls and %d transfers, want 3 and 1", calls, len(d.msgs))
+	}
+
+	calls = 0
+	c.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		calls++
+		return unix.EINTR
+	})
+	if err := c.Transfer([]byte{1}, make([]byte, 1)); err != unix.EINTR {
+		t.Errorf("Transfer=%v, want %v", err, unix.EINTR)
+	}
+	if calls != maxEINTR+1 {
+		t.Errorf("got %d calls, want %d", calls, maxEINTR+1)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	d := &fakeDev{mode: uint32(Loop)}
+	dev := &Device{conn: d.conn()}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := dev.SetMaxSpeed(1000000 + j); err != nil {
+					t.Errorf("SetMaxSpeed: %v", err)
+					return
+				}
+				if err := dev.SetDelay(time.Duration(j) * time.Microsecond); err != nil {
+					t.Errorf("SetDelay: %v", err)
+					return
+				}
+				tx := []byte{byte(i), byte(j)}
+				rx := make([]byte, len(tx))
+				if err := dev.Transfer(tx, rx); err != nil {
+					t.Errorf("Transfer: %v", err)
+					return
+				}
+				if !bytes.Equal(rx, tx) {
+					t.Errorf("Transfer read % x, want % x", rx, tx)
+				}
+				if err := dev.TxMany([]Message{{Tx: tx, Rx: rx}}); err != nil {
+					t.Errorf("TxMany: %v", err)
+					return
+				}
+				if _, err := dev.MaxSpeed(); err != nil {
+					t.Errorf("MaxSpeed: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(d.msgs); n != 8*100*2 {
+		t.Errorf("got %d transfers, want %d", n, 8*100*2)
+	}
+}
+
+func TestDevFSFile(t *testing.T) {
+	f, err := os.CreateTemp("", "spidev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	conn, err := (&DevFSFile{File: f}).Open(0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	// A regular file does not implement the spidev ioctls.
+	if err := conn.Configure(driver.Speed, 1000000); err == nil {
+		t.Errorf("Configure on a regular file succeeded, want error")
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := f.Write([]byte{0}); err == nil {
+		t.Errorf("Write after Close succeeded, want the file to be closed")
+	}
+
+	if _, err := (&DevFSFile{}).Open(0, 0); err == nil {
+		t.Errorf("Open with a nil file succeeded, want error")
+	}
+}
+
+func TestConfigureErrors(t *testing.T) {
+	d := &fakeDev{}
+	c := d.conn()
+	c.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		switch req {
+		case requestCode(devfs_WRITE, devfs_MAGIC, 4, 4):
+			return unix.EBUSY
+		case msgRequestCode(2):
+			return unix.EINVAL
+		}
+		return d.ioctl(fd, req, arg)
+	})
+	err := c.Configure(driver.Speed, 1000000)
+	if !errors.Is(err, unix.EBUSY) {
+		t.Errorf("Configure(Speed)=%v, want %v", err, unix.EBUSY)
+	}
+	var cerr *ConfigError
+	if !errors.As(err, &cerr) || cerr.Key != driver.Speed || cerr.Value != 1000000 {
+		t.Errorf("Configure(Speed)=%#v, want a ConfigError for the speed", err)
+	}
+	if err := c.Configure(driver.TxNBits, 3); !errors.Is(err, unix.EINVAL) {
+		t.Errorf("Configure(TxNBits, 3)=%v, want %v", err, unix.EINVAL)
+	}
+	if err := c.Configure(-1, 0); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Configure(-1, 0)=%v, want %v", err, ErrUnknownKey)
+	}
+	if _, err := c.Query(-1); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Query(-1)=%v, want %v", err, ErrUnknownKey)
+	}
+	msgs := []driver.Message{{Tx: []byte{1}, Rx: make([]byte, 1)}, {Tx: []byte{2}, Rx: make([]byte, 1)}}
+	if err := c.TransferMany(msgs); !errors.Is(err, unix.EINVAL) {
+		t.Errorf("TransferMany=%v, want %v", err, unix.EINVAL)
+	}
+}
+
+func TestSetCSHigh(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetMode(Mode3); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if err := dev.SetCSHigh(true); err != nil {
+		t.Fatalf("SetCSHigh(true): %v", err)
+	}
+	if want := uint32(Mode3 | CSHigh); d.mode != want {
+		t.Errorf("mode=%#x, want %#x", d.mode, want)
+	}
+	if err := dev.SetCSHigh(false); err != nil {
+		t.Fatalf("SetCSHigh(false): %v", err)
+	}
+	if want := uint32(Mode3); d.mode != want {
+		t.Errorf("mode=%#x, want %#x", d.mode, want)
+	}
+	if err := dev.SetMode(Mode1 | CSHigh); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if want := uint32(Mode1 | CSHigh); d.mode != want {
+		t.Errorf("mode=%#x, want %#x", d.mode, want)
+	}
+}
+
+func TestSetBaseModes(t *testing.T) {
+	d := &fakeDev{mode: uint32(Mode3 | CSHigh)}
+	dev := &Device{conn: d.conn()}
+	tests := []struct {
+		name string
+		set  func() error
+		want Mode
+	}{
+		{"SetMode0", dev.SetMode0, Mode0 | CSHigh},
+		{"SetMode1", dev.SetMode1, Mode1 | CSHigh},
+		{"SetMode2", dev.SetMode2, Mode2 | CSHigh},
+		{"SetMode3", dev.SetMode3, Mode3 | CSHigh},
+		{"SetCPOL(false)", func() error { return dev.SetCPOL(false) }, Mode1 | CSHigh},
+		{"SetCPHA(false)", func() error { return dev.SetCPHA(false) }, Mode0 | CSHigh},
+		{"SetCPOL(true)", func() error { return dev.SetCPOL(true) }, Mode2 | CSHigh},
+		{"SetCPHA(true)", func() error { return dev.SetCPHA(true) }, Mode3 | CSHigh},
+	}
+	for _, test := range tests {
+		if err := test.set(); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if d.mode != uint32(test.want) {
+			t.Errorf("%s: mode=%#x, want %#x", test.name, d.mode, uint32(test.want))
+		}
+	}
+}
+
+func TestSetLSBFirst(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	tests := []struct {
+		lsb  bool
+		want Order
+	}{
+		{true, LSBFirst},
+		{false, MSBFirst},
+	}
+	for _, test := range tests {
+		if err := dev.SetLSBFirst(test.lsb); err != nil {
+			t.Fatalf("SetLSBFirst(%v): %v", test.lsb, err)
+		}
+		if got := d.mode&lsbFirst != 0; got != test.lsb {
+			t.Errorf("SetLSBFirst(%v) set SPI_LSB_FIRST=%v", test.lsb, got)
+		}
+		if o, err := dev.BitOrder(); err != nil || o != test.want {
+			t.Errorf("BitOrder()=%v, %v, want %v, nil", o, err, test.want)
+		}
+	}
+	if err := dev.SetBitOrder(Order(256)); err == nil {
+		t.Errorf("SetBitOrder(256) succeeded, want error")
+	}
+	if d.mode&lsbFirst != 0 {
+		t.Errorf("SetBitOrder(256) set SPI_LSB_FIRST")
+	}
+}
+
+func TestModeKeepsBitOrder(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetBitOrder(LSBFirst); err != nil {
+		t.Fatalf("SetBitOrder(LSBFirst): %v", err)
+	}
+	if m, err := dev.Mode(); err != nil || m != Mode0 {
+		t.Errorf("Mode()=%#x, %v, want %#x, nil", m, err, Mode0)
+	}
+	if err := dev.SetCSHigh(true); err != nil {
+		t.Fatalf("SetCSHigh(true): %v", err)
+	}
+	if err := dev.SetMode3(); err != nil {
+		t.Fatalf("SetMode3: %v", err)
+	}
+	if err := dev.SetMode(Mode3); err != nil {
+		t.Fatalf("SetMode(Mode3): %v", err)
+	}
+	if want := uint32(Mode3 | lsbFirst); d.mode != want {
+		t.Errorf("mode=%#x, want %#x", d.mode, want)
+	}
+	if o, err := dev.BitOrder(); err != nil || o != LSBFirst {
+		t.Errorf("BitOrder()=%v, %v, want %v, nil", o, err, LSBFirst)
+	}
+}
+
+func TestBitOrderIgnored(t *testing.T) {
+	d := &fakeDev{}
+	c := d.conn()
+	// The controller accepts the LSB-first request but keeps MSB-first.
+	c.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		if req == requestCode(devfs_WRITE, devfs_MAGIC, 2, 1) {
+			return 0
+		}
+		return d.ioctl(fd, req, arg)
+	})
+	dev := &Device{conn: c}
+	if err := dev.SetBitOrder(LSBFirst); err != nil {
+		t.Fatalf("SetBitOrder(LSBFirst): %v", err)
+	}
+	if o, err := dev.BitOrder(); err != nil || o != MSBFirst {
+		t.Errorf("BitOrder()=%v, %v, want %v, nil", o, err, MSBFirst)
+	}
+}
+
+func TestSetThreeWire(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetMode(Mode0 | CSHigh); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if err := dev.SetThreeWire(true); err != nil {
+		t.Fatalf("SetThreeWire(true): %v", err)
+	}
+	if want := uint32(Mode0 | CSHigh | ThreeWire); d.mode != want {
+		t.Errorf("mode=%#x, want %#x", d.mode, want)
+	}
+	if m, err := dev.Mode(); err != nil || m != Mode0|CSHigh|ThreeWire {
+		t.Errorf("Mode()=%v, %v, want %v, nil", m, err, Mode0|CSHigh|ThreeWire)
+	}
+	if err := dev.SetThreeWire(false); err != nil {
+		t.Fatalf("SetThreeWire(false): %v", err)
+	}
+	if want := uint32(Mode0 | CSHigh); d.mode != want {
+		t.Errorf("mode=%#x, want %#x", d.mode, want)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetMode(Mode2 | CSHigh); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if err := dev.SelfTest(); err != nil {
+		t.Errorf("SelfTest: %v", err)
+	}
+	if len(d.msgs) != 1 {
+		t.Errorf("SelfTest issued %d transfers, want 1", len(d.msgs))
+	}
+	if want := uint32(Mode2 | CSHigh); d.mode != want {
+		t.Errorf("mode after SelfTest=%#x, want %#x", d.mode, want)
+	}
+}
+
+func TestSelfTestFailure(t *testing.T) {
+	d := &fakeDev{}
+	c := d.conn()
+	c.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		// Ignore the loopback flag, as a controller without loopback support.
+		if req == requestCode(devfs_WRITE, devfs_MAGIC, 1, 1) {
+			*(*uint8)(arg) &^= uint8(Loop)
+		}
+		return d.ioctl(fd, req, arg)
+	})
+	dev := &Device{conn: c}
+	if err := dev.SetMode(Mode1); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if err := dev.SelfTest(); err == nil {
+		t.Errorf("SelfTest succeeded without loopback, want error")
+	}
+	if want := uint32(Mode1); d.mode != want {
+		t.Errorf("mode after SelfTest=%#x, want %#x", d.mode, want)
+	}
+}
+
+func TestSetNoCS(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetMode(Mode3); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if err := dev.SetNoCS(true); err != nil {
+		t.Fatalf("SetNoCS(true): %v", err)
+	}
+	if want := uint32(Mode3 | NoCS); d.mode != want {
+		t.Errorf("mode=%#x, want %#x", d.mode, want)
+	}
+	if err := dev.SetNoCS(false); err != nil {
+		t.Fatalf("SetNoCS(false): %v", err)
+	}
+	if want := uint32(Mode3); d.mode != want {
+		t.Errorf("mode=%#x, want %#x", d.mode, want)
+	}
+}
+
+func TestSetModeReady(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetMode(Ready | Mode0); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if d.mode != 0x80 {
+		t.Errorf("mode=%#x, want 0x80", d.mode)
+	}
+	if err := dev.SetMode(Ready | Mode3); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if d.mode != 0x83 {
+		t.Errorf("mode=%#x, want 0x83", d.mode)
+	}
+	if m, err := dev.Mode(); err != nil || m != Ready|Mode3 {
+		t.Errorf("Mode()=%v, %v, want %v, nil", m, err, Ready|Mode3)
+	}
+}
+
+func TestWordDelay(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetWordDelay(10 * time.Microsecond); err != nil {
+		t.Fatalf("SetWordDelay: %v", err)
+	}
+	if err := dev.Transfer([]byte{1, 2}, make([]byte, 2)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if wd := d.msgs[0][0].wordDelay; wd != 10 {
+		t.Errorf("word_delay_usecs=%d, want 10", wd)
+	}
+	if err := dev.SetWordDelay(255 * time.Microsecond); err != nil {
+		t.Errorf("SetWordDelay(255µs): %v", err)
+	}
+	if err := dev.SetWordDelay(256 * time.Microsecond); err == nil {
+		t.Errorf("SetWordDelay(256µs) succeeded, want error")
+	}
+}
+
+func TestDelayRange(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetDelay(100 * time.Millisecond); err == nil {
+		t.Errorf("SetDelay(100ms) succeeded, want error")
+	}
+	if err := dev.SetDelay(50 * time.Millisecond); err != nil {
+		t.Fatalf("SetDelay(50ms): %v", err)
+	}
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if delay := d.msgs[0][0].delay; delay != 50000 {
+		t.Errorf("delay_usecs=%d, want 50000", delay)
+	}
+
+	msgs := []Message{{Tx: []byte{1}, Rx: make([]byte, 1), Delay: 100 * time.Millisecond}}
+	if err := dev.TxMany(msgs); err == nil {
+		t.Errorf("TxMany with a 100ms delay succeeded, want error")
+	}
+	if len(d.msgs) != 1 {
+		t.Errorf("got %d transfers, want 1", len(d.msgs))
+	}
+}
+
+func TestTransferManyDelays(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetDelay(10 * time.Microsecond); err != nil {
+		t.Fatalf("SetDelay: %v", err)
+	}
+	// A command, a 100µs wait and a read, in a single request.
+	msgs := []Message{
+		{Tx: []byte{0x9f}, Delay: 100 * time.Microsecond},
+		{Rx: make([]byte, 3), Delay: 500 * time.Nanosecond},
+		{Tx: []byte{0x00}},
+	}
+	if err := dev.TxMany(msgs); err != nil {
+		t.Fatalf("TxMany: %v", err)
+	}
+	if len(d.msgs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(d.msgs))
+	}
+	for i, want := range []uint16{100, 1, 10} {
+		if got := d.msgs[0][i].delay; got != want {
+			t.Errorf("payload %d: delay_usecs=%d, want %d", i, got, want)
+		}
+	}
+
+	msgs[1].Delay = 70 * time.Millisecond
+	err := dev.TxMany(msgs)
+	if err == nil || !strings.HasPrefix(err.Error(), "message 1: ") {
+		t.Errorf("TxMany with a 70ms delay in message 1: %v, want a message 1 error", err)
+	}
+	if len(d.msgs) != 1 {
+		t.Errorf("got %d requests, want 1", len(d.msgs))
+	}
+}
+
+func TestDelayRounding(t *testing.T) {
+	// The same duration gives the same kernel delay with all the APIs.
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.SetDelay(1500 * time.Nanosecond); err != nil {
+		t.Fatalf("SetDelay: %v", err)
+	}
+	if err := dev.SetWordDelay(1500 * time.Nanosecond); err != nil {
+		t.Fatalf("SetWordDelay: %v", err)
+	}
+	if err := dev.TxMany([]Message{{Tx: []byte{1}}, {Tx: []byte{2}, Delay: 1500 * time.Nanosecond}}); err != nil {
+		t.Fatalf("TxMany: %v", err)
+	}
+	for i, p := range d.msgs[0] {
+		if p.delay != 2 || p.wordDelay != 2 {
+			t.Errorf("payload %d: delay_usecs=%d word_delay_usecs=%d, want 2, 2", i, p.delay, p.wordDelay)
+		}
+	}
+}
+
+func TestDeviceMaxSpeedClamped(t *testing.T) {
+	d := &fakeDev{maxSpeed: 10000000}
+	c := d.conn()
+	dev := &Device{conn: c}
+	if err := dev.SetMaxSpeed(50000000); err != nil {
+		t.Fatalf("SetMaxSpeed: %v", err)
+	}
+	speed, err := dev.MaxSpeed()
+	if err != nil {
+		t.Fatalf("MaxSpeed: %v", err)
+	}
+	if speed != 10000000 {
+		t.Errorf("MaxSpeed()=%d, want 10000000", speed)
+	}
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if s := d.msgs[0][0].speed; s != 10000000 {
+		t.Errorf("speed_hz=%d, want 10000000", s)
+	}
+}
+
+func TestDefaultSpeed(t *testing.T) {
+	d := &fakeDev{speed: 500000}
+	c := d.conn()
+	c.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		if req == requestCode(devfs_WRITE, devfs_MAGIC, 4, 4) && *(*uint32)(arg) == 0 {
+			return unix.EINVAL
+		}
+		return d.ioctl(fd, req, arg)
+	})
+	dev := &Device{conn: c}
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer without a speed: %v", err)
+	}
+	if s := d.msgs[0][0].speed; s != 0 {
+		t.Errorf("speed_hz=%d, want 0", s)
+	}
+	if err := dev.SetMaxSpeed(0); err != nil {
+		t.Fatalf("SetMaxSpeed(0): %v", err)
+	}
+	if s, err := dev.MaxSpeed(); err != nil || s != 500000 {
+		t.Errorf("MaxSpeed()=%d, %v, want 500000, nil", s, err)
+	}
+}
+
+func TestDevFSConfigure(t *testing.T) {
+	d := &fakeDev{bits: 8}
+	if err := (&DevFS{}).configure(d.conn()); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	if len(d.reqs) != 0 {
+		t.Errorf("zero settings issued %d ioctls, want 0", len(d.reqs))
+	}
+	if err := (&DevFS{BitsPerWord: 16, Order: LSBFirst}).configure(d.conn()); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	wantReqs := []uintptr{
+		requestCode(devfs_WRITE, devfs_MAGIC, 3, 1),
+		requestCode(devfs_WRITE, devfs_MAGIC, 2, 1),
+	}
+	if !reflect.DeepEqual(d.reqs, wantReqs) {
+		t.Errorf("ioctls=%#x, want %#x", d.reqs, wantReqs)
+	}
+	if d.bits != 16 || d.mode&lsbFirst == 0 {
+		t.Errorf("bits=%d mode=%#x, want 16 with SPI_LSB_FIRST", d.bits, d.mode)
+	}
+}
+
+func TestDevFSPathFmt(t *testing.T) {
+	d := &fakeDev{}
+	fs := fakeFiles{"/run/spi/bus2-cs1": d}
+	c, err := (&DevFS{BitsPerWord: 16, Files: fs, PathFmt: "/run/spi/bus%d-cs%d"}).Open(2, 1)
+	if err != nil {
+		t.Fatalf("Open(2, 1): %v", err)
+	}
+	c.Close()
+	if d.bits != 16 {
+		t.Errorf("bits=%d, want 16", d.bits)
+	}
+	if _, err := (&DevFS{Files: fs}).Open(2, 1); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open(2, 1) with the default format=%v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestDeviceCapabilities(t *testing.T) {
+	sys, err := os.MkdirTemp("", "spi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sys)
+	writeOFNode(t, sys, "spidev0.1", map[string]uint32{
+		"spi-max-frequency": 10000000,
+		"spi-tx-bus-width":  2,
+		"spi-rx-bus-width":  2,
+	})
+	defer func(p string) { spidevClassPath = p }(spidevClassPath)
+	spidevClassPath = sys
+
+	d := &fakeDev{}
+	c, err := (&DevFS{Files: fakeFiles{"/dev/spidev0.1": d}}).Open(0, 1)
+	if err != nil {
+		t.Fatalf("Open(0, 1): %v", err)
+	}
+	dev := &Device{conn: c}
+	caps, err := dev.Capabilities()
+	if err != nil {
+		t.Fatalf("Capabilities: %v", err)
+	}
+	want := Caps{MaxSpeed: 10000000, TxLanes: 2, RxLanes: 2, Mode32: true, MaxTransferSize: dev.MaxTransferSize()}
+	if caps != want {
+		t.Errorf("Capabilities()=%+v, want %+v", caps, want)
+	}
+
+	// A kernel without 32-bit mode support.
+	dc := d.conn()
+	dc.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		if req == requestCode(devfs_READ, devfs_MAGIC, 5, 4) {
+			return unix.ENOTTY
+		}
+		return d.ioctl(fd, req, arg)
+	})
+	if caps, err := (&Device{conn: dc}).Capabilities(); err != nil || caps.Mode32 || caps.MaxSpeed != 0 {
+		t.Errorf("Capabilities()=%+v, %v, want no Mode32 and no MaxSpeed, nil", caps, err)
+	}
+}
+
+func TestDeviceFd(t *testing.T) {
+	f, err := os.CreateTemp("", "spidev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	c, err := (&DevFSFile{File: f}).Open(0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	dev := &Device{conn: c}
+	defer dev.Close()
+	fd, err := dev.Fd()
+	if err != nil {
+		t.Fatalf("Fd: %v", err)
+	}
+	if fd != f.Fd() {
+		t.Errorf("Fd()=%d, want %d", fd, f.Fd())
+	}
+
+	// The fake devices have no file descriptor.
+	if _, err := (&Device{conn: (&fakeDev{}).conn()}).Fd(); err != errNoFd {
+		t.Errorf("Fd() of a fake device=%v, want %v", err, errNoFd)
+	}
+}
+
+// fakeFiles is a fake /dev tree of fake devices.
+type fakeFiles map[string]*fakeDev
+
+func (fs fakeFiles) Open(name string) (DevFile, error) {
+	d, ok := fs[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return d, nil
+}
+
+func TestDevFSFiles(t *testing.T) {
+	d := &fakeDev{mode: uint32(Loop)}
+	fs := fakeFiles{"/dev/spidev0.1": d}
+	c, err := (&DevFS{BitsPerWord: 16, Files: fs}).Open(0, 1)
+	if err != nil {
+		t.Fatalf("Open(0, 1): %v", err)
+	}
+	defer c.Close()
+	if d.bits != 16 {
+		t.Errorf("bits=%d, want 16", d.bits)
+	}
+	rx := make([]byte, 2)
+	if err := c.Transfer([]byte{1, 2}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if len(d.txs) != 1 || !bytes.Equal(d.txs[0], []byte{1, 2}) || !bytes.Equal(rx, []byte{1, 2}) {
+		t.Errorf("wrote %x and read %x, want [0102] and 0102", d.txs, rx)
+	}
+
+	if _, err := (&DevFS{Files: fs}).Open(1, 0); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open(1, 0)=%v, want %v", err, os.ErrNotExist)
+	}
+}
+
+// benchmarkTransfer measures the cost of the devfs transfers of n bytes
+// without the cost of the system call.
+func benchmarkTransfer(b *testing.B, n int) {
+	c := &devfsConn{f: ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		return 0
+	})}
+	tx := make([]byte, n)
+	rx := make([]byte, n)
+	b.SetBytes(int64(n))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.Transfer(tx, rx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTransfer64(b *testing.B)  { benchmarkTransfer(b, 64) }
+func BenchmarkTransfer4K(b *testing.B)  { benchmarkTransfer(b, 4096) }
+func BenchmarkTransfer64K(b *testing.B) { benchmarkTransfer(b, 65536) }
+
+func BenchmarkTransferMany8(b *testing.B) {
+	c := &devfsConn{f: ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		return 0
+	})}
+	msgs := make([]driver.Message, 8)
+	for i := range msgs {
+		msgs[i] = driver.Message{Tx: make([]byte, 16), Rx: make([]byte, 16)}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.TransferMany(msgs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTransferAllocs(t *testing.T) {
+	c := &devfsConn{f: ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		return 0
+	})}
+	dev := &Device{conn: c}
+	tx := make([]byte, 64)
+	rx := make([]byte, 64)
+	if n := testing.AllocsPerRun(100, func() {
+		if err := dev.Transfer(tx, rx); err != nil {
+			t.Fatal(err)
+		}
+	}); n != 0 {
+		t.Errorf("Transfer allocated %v times, want 0", n)
+	}
+	msgs := []Message{{Tx: tx}, {Rx: rx}}
+	if n := testing.AllocsPerRun(100, func() {
+		if err := dev.TxMany(msgs); err != nil {
+			t.Fatal(err)
+		}
+	}); n != 0 {
+		t.Errorf("TxMany allocated %v times, want 0", n)
+	}
+	rw := dev.ReadWriter()
+	if n := testing.AllocsPerRun(100, func() {
+		if _, err := rw.Write(tx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rw.Read(rx); err != nil {
+			t.Fatal(err)
+		}
+	}); n != 0 {
+		t.Errorf("ReadWriter allocated %v times, want 0", n)
+	}
+}
+
+func TestPayloadPool(t *testing.T) {
+	// Concurrent requests of several sizes on separate connections
+	// must not share their payloads.
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			n := g%4 + 1
+			msgs := make([]driver.Message, n)
+			for i := range msgs {
+				msgs[i] = driver.Message{Tx: []byte{byte(g), byte(i)}, Rx: make([]byte, 2)}
+			}
+			c := &devfsConn{f: ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+				ps := unsafe.Slice((*payload)(arg), n)
+				for i, p := range ps {
+					if p.tx != bufAddr(msgs[i].Tx) || p.length != 2 {
+						t.Errorf("goroutine %d: payload %d is not for its message", g, i)
+					}
+					// Simulate the kernel taking time.
+					runtime.Gosched()
+				}
+				return 0
+			})}
+			for j := 0; j < 100; j++ {
+				if err := c.TransferMany(msgs); err != nil {
+					t.Errorf("TransferMany: %v", err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// The pooled payloads are cleared.
+	ps := getPayloads(3)
+	(*ps)[0].tx = 1
+	putPayloads(ps)
+	for i := 0; i < 10; i++ {
+		ps := getPayloads(4)
+		for j, p := range *ps {
+			if p != (payload{}) {
+				t.Fatalf("pooled payload %d=%+v, want zero", j, p)
+			}
+		}
+		putPayloads(ps)
+	}
+}
+
+func TestTransferGC(t *testing.T) {
+	d := &fakeDev{mode: uint32(Loop)}
+	c := d.conn()
+	c.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		// The buffers are only referenced by the payload addresses.
+		runtime.GC()
+		return d.ioctl(fd, req, arg)
+	})
+	for i := 0; i < 10; i++ {
+		rx := make([]byte, 64)
+		if err := c.Transfer(bytes.Repeat([]byte{byte(i)}, 64), rx); err != nil {
+			t.Fatalf("Transfer: %v", err)
+		}
+		if want := bytes.Repeat([]byte{byte(i)}, 64); !bytes.Equal(rx, want) {
+			t.Errorf("rx=% x, want % x", rx, want)
+		}
+	}
+}
+
+func TestCloseAfterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c := &devfsConn{f: ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		<-release
+		return 0
+	})}
+	dev := &Device{conn: c}
+	dev.SetTimeout(10 * time.Millisecond)
+	if err := dev.Transfer([]byte{1}, nil); err != ErrTimeout {
+		t.Fatalf("Transfer with blocked ioctl=%v, want %v", err, ErrTimeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := dev.TransferContext(ctx, []byte{1}, nil); err != context.DeadlineExceeded {
+		t.Fatalf("TransferContext with blocked ioctl=%v, want %v", err, context.DeadlineExceeded)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- dev.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close blocked by the abandoned transfer")
+	}
+	if err := c.ioctl(msgRequestCode(1), nil); err != ErrClosed {
+		t.Errorf("ioctl after Close=%v, want %v", err, ErrClosed)
+	}
+}
+
+func TestTransactionDevFS(t *testing.T) {
+	// End deasserts the chip select whatever the default cs_change.
+	for _, csChange := range []bool{false, true} {
+		d := &fakeDev{}
+		dev := &Device{conn: d.conn()}
+		if err := dev.SetCSChange(csChange); err != nil {
+			t.Fatalf("SetCSChange(%v): %v", csChange, err)
+		}
+		tx, err := dev.Begin()
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := tx.Transfer([]byte{byte(i)}, make([]byte, 1)); err != nil {
+				t.Fatalf("Transfer: %v", err)
+			}
+		}
+		if err := tx.End(); err != nil {
+			t.Fatalf("End: %v", err)
+		}
+		// The transfers leave the chip select asserted with cs_change
+		// and End deasserts it with an empty message.
+		var got []payload
+		for _, ps := range d.msgs {
+			got = append(got, ps...)
+		}
+		if len(got) != 3 {
+			t.Fatalf("got %d messages, want 3", len(got))
+		}
+		for i, p := range got[:2] {
+			if p.csChange != 1 || p.length != 1 {
+				t.Errorf("SetCSChange(%v): transfer %d: cs_change=%d len=%d, want 1, 1", csChange, i, p.csChange, p.length)
+			}
+		}
+		if p := got[2]; p.csChange != 0 || p.length != 0 {
+			t.Errorf("SetCSChange(%v): end: cs_change=%d len=%d, want 0, 0", csChange, p.csChange, p.length)
+		}
+	}
+}
+
+func TestBeginTransactionDevFS(t *testing.T) {
+	d := &fakeDev{}
+	dev := &Device{conn: d.conn()}
+	if err := dev.BeginTransaction(); err != nil {
+		t.Fatalf("BeginTransaction: %v", err)
+	}
+	if err := dev.BeginTransaction(); err != errBegun {
+		t.Errorf("second BeginTransaction=%v, want %v", err, errBegun)
+	}
+	if err := dev.Transfer([]byte{0x03}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	// The messages but the last deassert the chip select with
+	// cs_change, and the last leaves it asserted.
+	msgs := []Message{{Tx: []byte{1}, CSChange: true}, {Tx: []byte{2}}}
+	if err := dev.TxMany(msgs); err != nil {
+		t.Fatalf("TxMany: %v", err)
+	}
+	if msgs[1].CSChange {
+		t.Errorf("TxMany modified the messages")
+	}
+	if err := dev.EndTransaction(); err != nil {
+		t.Fatalf("EndTransaction: %v", err)
+	}
+	if err := dev.EndTransaction(); err != errNotBegun {
+		t.Errorf("second EndTransaction=%v, want %v", err, errNotBegun)
+	}
+	if err := dev.Transfer([]byte{0x04}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+
+	var got [][]uint8
+	for _, ps := range d.msgs {
+		var cs []uint8
+		for _, p := range ps {
+			cs = append(cs, p.csChange)
+		}
+		got = append(got, cs)
+	}
+	// Transfer, TxMany, the empty message of EndTransaction
+	// and a Transfer after the transaction.
+	want := [][]uint8{{1}, {1, 1}, {0}, {0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cs_change of the requests=%v, want %v", got, want)
+	}
+}
+
+func TestTransferErrno(t *testing.T) {
+	c := (&fakeDev{}).conn()
+	c.f = ioctlFunc(func(fd, req uintptr, arg unsafe.Pointer) unix.Errno {
+		if req == requestCode(devfs_WRITE, devfs_MAGIC, 4, 4) {
+			return unix.EBUSY
+		}
+		return unix.EREMOTEIO
+	})
+	dev := &Device{conn: c}
+	dev.SetTracer(func(TraceEvent) {})
+	tests := []struct {
+		name string
+		f    func() error
+		want syscall.Errno
+	}{
+		{"Transfer", func() error { return dev.Transfer([]byte{1}, make([]byte, 1)) }, unix.EREMOTEIO},
+		{"TxMany", func() error { return dev.TxMany([]Message{{Tx: []byte{1}}, {Tx: []byte{2}}}) }, unix.EREMOTEIO},
+		{"TransferContext", func() error {
+			return dev.TransferContext(context.Background(), []byte{1}, make([]byte, 1))
+		}, unix.EREMOTEIO},
+		{"SetMaxSpeed", func() error { return dev.SetMaxSpeed(1000000) }, unix.EBUSY},
+	}
+	for _, test := range tests {
+		err := test.f()
+		var errno syscall.Errno
+		if !errors.As(err, &errno) || errno != test.want {
+			t.Errorf("%s()=%v, want an error with errno %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestBeginTransactionChunks(t *testing.T) {
+	d := &fakeDev{bufsiz: 4}
+	c := d.conn()
+	c.bufsiz = 4
+	dev := &Device{conn: c}
+	if err := dev.BeginTransaction(); err != nil {
+		t.Fatalf("BeginTransaction: %v", err)
+	}
+	// A transfer larger than bufsiz is split in requests
+	// that all leave the chip select asserted.
+	tx := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if err := dev.Transfer(tx, make([]byte, len(tx))); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := dev.EndTransaction(); err != nil {
+		t.Fatalf("EndTransaction: %v", err)
+	}
+	var lens []uint32
+	var cs []uint8
+	for _, ps := range d.msgs {
+		if len(ps) != 1 {
+			t.Fatalf("got a request of %d messages, want 1", len(ps))
+		}
+		lens = append(lens, ps[0].length)
+		cs = append(cs, ps[0].csChange)
+	}
+	if want := []uint32{4, 4, 2, 0}; !reflect.DeepEqual(lens, want) {
+		t.Errorf("lengths of the requests=%v, want %v", lens, want)
+	}
+	if want := []uint8{1, 1, 1, 0}; !reflect.DeepEqual(cs, want) {
+		t.Errorf("cs_change of the requests=%v, want %v", cs, want)
+	}
+}
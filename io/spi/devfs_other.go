@@ -0,0 +1,46 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package spi
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// DevFS is an SPI driver that works against the devfs.
+// It is only available on Linux.
+type DevFS struct {
+	BitsPerWord int
+	Order       Order
+	Files       DevFiles
+	PathFmt     string
+}
+
+// DefaultPathFmt is the default format of the path
+// of the device files of DevFS.
+const DefaultPathFmt = "/dev/spidev%d.%d"
+
+// Open returns an error wrapping ErrUnsupportedPlatform,
+// the devfs driver is only available on Linux.
+func (d *DevFS) Open(bus, chip int) (driver.Conn, error) {
+	return nil, fmt.Errorf("spi: devfs: %w %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
+
+// DevFSFile is an SPI driver that works against an already open
+// spidev device file. It is only available on Linux.
+type DevFSFile struct {
+	File *os.File
+}
+
+// Open returns an error wrapping ErrUnsupportedPlatform,
+// the devfs driver is only available on Linux.
+func (d *DevFSFile) Open(bus, chip int) (driver.Conn, error) {
+	return nil, fmt.Errorf("spi: devfs: %w %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
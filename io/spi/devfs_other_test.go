@@ -0,0 +1,27 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package spi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnsupportedPlatform(t *testing.T) {
+	if _, err := Open(nil, 0, 0, Mode0, 0); !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("Open with DevFS=%v, want %v", err, ErrUnsupportedPlatform)
+	}
+	if _, err := (&DevFSFile{}).Open(0, 0); !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("DevFSFile.Open=%v, want %v", err, ErrUnsupportedPlatform)
+	}
+	if _, err := (&BCM2835{}).Open(0, 0); !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("BCM2835.Open=%v, want %v", err, ErrUnsupportedPlatform)
+	}
+	if _, err := OpenString("spidev://0.0"); !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("OpenString(spidev://0.0)=%v, want %v", err, ErrUnsupportedPlatform)
+	}
+}
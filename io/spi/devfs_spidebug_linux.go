@@ -0,0 +1,17 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && spidebug
+
+package spi
+
+import "log"
+
+func init() {
+	debugPayloads = func(ps []payload) {
+		for i := range ps {
+			log.Printf("spi: message %d/%d: %v", i+1, len(ps), &ps[i])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DeviceInfo describes an SPI device available through the devfs.
+type DeviceInfo struct {
+	Bus, Chip int
+	Path      string // path of the device file, e.g. /dev/spidev0.1
+
+	// MaxSpeed is the maximum clock speed in Hz of the device
+	// as described by the device tree, or 0 if unknown.
+	MaxSpeed int
+}
+
+// Devices returns the SPI devices available through the devfs,
+// sorted by bus and chip number.
+func Devices() ([]DeviceInfo, error) {
+	return devices("/dev", spidevClassPath)
+}
+
+// spidevClassPath is the sysfs directory of the spidev devices.
+var spidevClassPath = "/sys/class/spidev"
+
+func devices(dev, sys string) ([]DeviceInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(dev, "spidev*"))
+	if err != nil {
+		return nil, err
+	}
+	var infos []DeviceInfo
+	for _, p := range paths {
+		name := filepath.Base(p)
+		var info DeviceInfo
+		if n, err := fmt.Sscanf(name, "spidev%d.%d", &info.Bus, &info.Chip); n != 2 || err != nil {
+			continue
+		}
+		if name != fmt.Sprintf("spidev%d.%d", info.Bus, info.Chip) {
+			continue
+		}
+		info.Path = p
+		info.MaxSpeed, _ = readOFProperty(sys, name, "spi-max-frequency")
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Bus != infos[j].Bus {
+			return infos[i].Bus < infos[j].Bus
+		}
+		return infos[i].Chip < infos[j].Chip
+	})
+	return infos, nil
+}
+
+// readOFProperty returns the value of the integer device tree property
+// prop of the spidev device name, read from the spidev class directory
+// sys of the sysfs, and whether it could be read.
+func readOFProperty(sys, name, prop string) (int, bool) {
+	b, err := os.ReadFile(filepath.Join(sys, name, "device", "of_node", prop))
+	if err != nil || len(b) != 4 {
+		return 0, false
+	}
+	// The device tree property is a big-endian 32-bit integer.
+	return int(binary.BigEndian.Uint32(b)), true
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDevices(t *testing.T) {
+	root, err := os.MkdirTemp("", "spi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dev := filepath.Join(root, "dev")
+	sys := filepath.Join(root, "sys")
+	if err := os.MkdirAll(dev, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"spidev1.0", "spidev0.10", "spidev0.2", "spidevx", "spidev0.1.old", "tty0"} {
+		if err := os.WriteFile(filepath.Join(dev, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	of := filepath.Join(sys, "spidev0.2", "device", "of_node")
+	if err := os.MkdirAll(of, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(of, "spi-max-frequency"), []byte{0x00, 0x7a, 0x12, 0x00}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := devices(dev, sys)
+	if err != nil {
+		t.Fatalf("devices: %v", err)
+	}
+	want := []DeviceInfo{
+		{Bus: 0, Chip: 2, Path: filepath.Join(dev, "spidev0.2"), MaxSpeed: 8000000},
+		{Bus: 0, Chip: 10, Path: filepath.Join(dev, "spidev0.10")},
+		{Bus: 1, Chip: 0, Path: filepath.Join(dev, "spidev1.0")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("devices()=%+v, want %+v", got, want)
+	}
+}
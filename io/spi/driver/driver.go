@@ -5,14 +5,67 @@
 // Package driver contains interfaces to be implemented by various SPI implementations.
 package driver // import "golang.org/x/exp/io/spi/driver"
 
+import "time"
+
 const (
 	Mode = iota
 	Bits
 	Speed
 	Order
 	Delay
+	Mode32
+	TxNBits
+	RxNBits
+	CSChange
+	WordDelay
 )
 
+// Message is a single transfer in a sequence of transfers
+// that are performed as one transaction.
+type Message struct {
+	// Tx is the data to write to the device. If nil,
+	// len(Rx) zero bytes are written instead.
+	Tx []byte
+	// Rx receives the data read from the device. If nil,
+	// the data read while writing Tx is discarded. Tx and Rx
+	// must have the same length unless one of them is nil.
+	Rx []byte
+
+	// Speed overrides the connection's max clock speed (in Hz)
+	// for this message. Zero value uses the connection's speed.
+	Speed int
+	// Bits overrides the connection's bits per word for this
+	// message. Zero value uses the connection's bits per word.
+	Bits int
+	// Delay overrides the connection's delay for this message.
+	// Zero value uses the connection's delay.
+	Delay time.Duration
+	// TxNBits and RxNBits override the connection's number of data
+	// lines used to write and read this message. Zero values use the
+	// connection's settings.
+	TxNBits, RxNBits int
+
+	// CSChange, if set, deasserts the chip select after this message
+	// before the next one starts. If the message is the last one of
+	// the transaction, the chip select is left asserted instead.
+	// If not set, the connection's CSChange setting is used.
+	CSChange bool
+	// NoCSChange, if set and CSChange isn't, clears the cs_change flag
+	// of this message even if the connection's CSChange setting is set,
+	// so that the chip select stays asserted until the next message.
+	NoCSChange bool
+}
+
+// MaxTransferSizer is an optional interface of the connections whose
+// driver limits the number of bytes of a request, such as the bufsiz
+// parameter of the spidev kernel driver, which limits the combined
+// length of the messages of each SPI_IOC_MESSAGE request.
+type MaxTransferSizer interface {
+	// MaxTransferSize returns the maximum number of bytes of the
+	// messages of a request together, or zero if there is no limit.
+	MaxTransferSize() int
+}
+
 // Opener is an interface to be implemented by the SPI driver to open
 // a connection an SPI device with the specified bus and chip number.
 type Opener interface {
@@ -20,27 +73,50 @@ type Opener interface {
 }
 
 // Conn is a connection to an SPI device.
-// TODO(jbd): Extend the interface to query configuration values.
 type Conn interface {
 	// Configure configures the SPI device.
 	//
 	// Available configuration keys are:
 	//  - Mode, the SPI mode (valid values are 0, 1, 2 and 3).
 	//  - Bits, bits per word (default is 8-bit per word).
-	//  - Speed, the max clock speed (in Hz).
+	//  - Speed, the max clock speed (in Hz). Zero uses the default
+	//    speed of the driver.
 	//  - Order, bit order to be used in transfers. Zero value represents
 	//    the MSB-first, non-zero values represent LSB-first encoding.
 	//  - Delay, the pause time between frames (in usecs).
 	//    Some SPI devices require a minimum amount of wait time after
 	//    each frame write. If set, Delay amount of usecs are inserted after
 	//    each write.
+	//  - Mode32, the SPI mode including the flags that do not fit
+	//    in 8 bits, such as the dual and quad transfer flags.
+	//  - TxNBits and RxNBits, the number of data lines used to write
+	//    and read (valid values are 0, 1, 2, 4 and 8; 0 is single line).
+	//  - CSChange, the default cs_change flag of transfers. Zero value
+	//    keeps the chip select asserted between the messages of a
+	//    transaction and deasserts it at the end. Non-zero values
+	//    deassert the chip select between messages and leave it
+	//    asserted after the last message.
+	//  - WordDelay, the pause time between the words of a transfer
+	//    (in usecs), for slow devices. Older kernels ignore it.
 	//
 	// SPI devices can override these values.
 	Configure(k, v int) error
 
+	// Query returns the current value of the configuration key k
+	// as applied by the SPI device, which may differ from the
+	// configured value.
+	Query(k int) (int, error)
+
 	// Transfer transfers tx and reads into rx.
+	// tx and rx must have the same length, unless one of them
+	// is nil: zeros are written for a nil tx and the data read
+	// is discarded for a nil rx.
 	Transfer(tx, rx []byte) error
 
+	// TransferMany performs the transfers of msgs in order
+	// as a single transaction.
+	TransferMany(msgs []Message) error
+
 	// Close frees the underlying resources and closes the connection.
 	Close() error
 }
@@ -0,0 +1,116 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// ErrUnknownKey is returned, possibly wrapped, by the drivers for
+// configuration keys they don't know about.
+var ErrUnknownKey = errors.New("unknown key")
+
+// ErrTimeout is returned by the transfers that take longer
+// than the timeout set with SetTimeout.
+var ErrTimeout = errors.New("spi: transfer timed out")
+
+// ErrUnsupportedPlatform is returned, wrapped, when opening a device
+// with a driver that is not available on the platform, such as DevFS
+// on other systems than Linux.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// ErrClosed is returned for the transfers submitted with Submit
+// after the device is closed, and by the DevFS driver for the
+// requests made after Close.
+var ErrClosed = errors.New("spi: device closed")
+
+// ErrCRCMismatch is returned, wrapped, by TxCRC when the CRC
+// of a frame read doesn't match its data.
+var ErrCRCMismatch = errors.New("spi: CRC mismatch")
+
+// ErrInvalidMode is returned, wrapped in a ConfigError, when setting
+// a mode with bits that are not SPI mode flags.
+var ErrInvalidMode = errors.New("invalid mode")
+
+// ErrUnsupported matches, with errors.Is, the UnsupportedErrors.
+var ErrUnsupported = errors.New("unsupported feature")
+
+// UnsupportedError is the error of a ConfigError when the kernel or
+// the controller don't support the setting, for instance a mode flag
+// the controller doesn't have, so that the callers can detect the
+// features available with errors.Is(err, ErrUnsupported). Err is the
+// underlying error, typically syscall.ENOTTY or syscall.EINVAL.
+type UnsupportedError struct {
+	Feature string // the setting, e.g. "mode"
+	Err     error
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s not supported: %v", e.Feature, e.Err)
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrUnsupported.
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// errUnsupported is the error of a ConfigError for a value
+// that is not supported by a driver.
+var errUnsupported = errors.New("unsupported value")
+
+// errBitsRange is the error of a ConfigError for a number of bits
+// per word the devfs driver doesn't accept.
+var errBitsRange = errors.New("not between 1 and 32")
+
+// ConfigError is the error returned by the drivers when they fail to
+// set a configuration key. Err is the underlying error, typically the
+// syscall.Errno returned by the kernel, possibly wrapped in an
+// UnsupportedError, so that errors.Is can be used to tell apart
+// errors such as syscall.EBUSY and syscall.EINVAL.
+type ConfigError struct {
+	Key   int // the driver configuration key, e.g. driver.Speed
+	Value int
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("error setting %s to %v: %v", keyName(e.Key), e.Value, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// keyName returns a description of the driver configuration key k.
+func keyName(k int) string {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		return "mode"
+	case driver.Bits:
+		return "bits per word"
+	case driver.Speed:
+		return "speed"
+	case driver.Order:
+		return "bit order"
+	case driver.Delay:
+		return "delay"
+	case driver.TxNBits:
+		return "number of tx lines"
+	case driver.RxNBits:
+		return "number of rx lines"
+	case driver.CSChange:
+		return "cs_change"
+	case driver.WordDelay:
+		return "word delay"
+	}
+	return fmt.Sprintf("key %d", k)
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+func TestConfigError(t *testing.T) {
+	var err error = &ConfigError{Key: driver.Speed, Value: 1000000, Err: syscall.EBUSY}
+	if got, want := err.Error(), "error setting speed to 1000000: "+syscall.EBUSY.Error(); got != want {
+		t.Errorf("Error()=%q, want %q", got, want)
+	}
+	if !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("errors.Is(%v, EBUSY)=false, want true", err)
+	}
+	if errors.Is(err, syscall.EINVAL) {
+		t.Errorf("errors.Is(%v, EINVAL)=true, want false", err)
+	}
+}
+
+func TestUnsupportedError(t *testing.T) {
+	var err error = &ConfigError{Key: driver.Mode32, Value: 0x800, Err: &UnsupportedError{Feature: "mode", Err: syscall.ENOTTY}}
+	if got, want := err.Error(), "error setting mode to 2048: mode not supported: "+syscall.ENOTTY.Error(); got != want {
+		t.Errorf("Error()=%q, want %q", got, want)
+	}
+	if !errors.Is(err, ErrUnsupported) || !errors.Is(err, syscall.ENOTTY) {
+		t.Errorf("errors.Is(%v, ErrUnsupported) and errors.Is(%v, ENOTTY) are not both true", err, err)
+	}
+	var uerr *UnsupportedError
+	if !errors.As(err, &uerr) || uerr.Feature != "mode" {
+		t.Errorf("errors.As(%v)=%v, want the mode UnsupportedError", err, uerr)
+	}
+}
+
+func TestUnknownKeyErrors(t *testing.T) {
+	conns := map[string]driver.Conn{
+		"gpio": newGPIOConn(nil, nil, nil, nil),
+		"ftdi": &ftdiConn{},
+	}
+	for name, c := range conns {
+		if err := c.Configure(-1, 0); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("%s: Configure(-1, 0)=%v, want %v", name, err, ErrUnknownKey)
+		}
+		if _, err := c.Query(-1); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("%s: Query(-1)=%v, want %v", name, err, ErrUnknownKey)
+		}
+		var cerr *ConfigError
+		if err := c.Configure(driver.Bits, 33); !errors.As(err, &cerr) || cerr.Key != driver.Bits || cerr.Value != 33 {
+			t.Errorf("%s: Configure(Bits, 33)=%v, want a ConfigError", name, err)
+		}
+	}
+}
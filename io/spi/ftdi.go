@@ -0,0 +1,359 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// MPSSE commands, see FTDI application note AN_108.
+const (
+	mpsseWriteNeg     = 0x01 // write on the falling clock edge
+	mpsseReadNeg      = 0x04 // read on the falling clock edge
+	mpsseLSB          = 0x08 // LSB first
+	mpsseWrite        = 0x10 // write data out
+	mpsseRead         = 0x20 // read data in
+	mpsseSetLow       = 0x80 // set value and direction of ADBUS0-7
+	mpsseLoopbackOff  = 0x85
+	mpsseDivisor      = 0x86 // set clock divisor
+	mpsseSendNow      = 0x87 // flush the read buffer to the host
+	mpsseDiv5Off      = 0x8a // use the 60MHz master clock
+	mpsse3PhaseOff    = 0x8d
+	mpsseAdaptiveOff  = 0x97
+	mpsseBadCommand   = 0xaa // an invalid command, used to sync
+	mpsseBadResponse  = 0xfa // response to an invalid command
+	mpsseMaxLen       = 65536
+	mpsseBaseClock    = 30000000 // master clock / 2, in Hz
+	mpsseDefaultSpeed = 1000000
+
+	// ADBUS lines of the SPI signals.
+	mpsseSCK = 0x01
+	mpsseDO  = 0x02
+	mpsseDI  = 0x04
+	mpsseCS0 = 0x08
+)
+
+// FTDI is an SPI driver for FTDI high speed USB chips with a
+// Multi-Protocol Synchronous Serial Engine (MPSSE), such as
+// the FT232H and the FT2232H. Configuration and transfers are
+// translated into MPSSE commands.
+//
+// Clock, data out and data in are ADBUS0, ADBUS1 and ADBUS2.
+// The chip number selects ADBUS3+chip as the active low chip select,
+// so chips 0 to 4 are available.
+//
+// MPSSE officially supports the SPI modes 0 and 2; modes 1 and 3 are
+// emulated by changing the clock edges and may not work with all devices.
+// Words must be a multiple of 8 bits.
+type FTDI struct {
+	// Transport opens the USB interface of the FTDI chip for bus,
+	// reset and in MPSSE bit mode (0x02), for instance through libftdi
+	// or FTDI's D2XX library. Reads must return the data bytes
+	// without the modem status bytes.
+	Transport func(bus int) (io.ReadWriteCloser, error)
+}
+
+// Open opens the FTDI chip of bus, initializes its MPSSE
+// and returns a connection to the chip.
+func (d *FTDI) Open(bus, chip int) (driver.Conn, error) {
+	if chip < 0 || chip > 4 {
+		return nil, fmt.Errorf("invalid chip select: %d", chip)
+	}
+	if d.Transport == nil {
+		return nil, fmt.Errorf("no FTDI transport")
+	}
+	rw, err := d.Transport(bus)
+	if err != nil {
+		return nil, err
+	}
+	c := &ftdiConn{
+		rw:    rw,
+		cs:    mpsseCS0 << uint(chip),
+		bits:  8,
+		speed: mpsseDefaultSpeed,
+	}
+	if err := c.init(); err != nil {
+		rw.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+type ftdiConn struct {
+	rw io.ReadWriteCloser
+	cs byte // the chip select line
+
+	mode     uint8
+	lsb      bool
+	bits     uint8
+	speed    uint32
+	delay    time.Duration
+	csChange bool
+}
+
+func (c *ftdiConn) init() error {
+	// Sync with the MPSSE by checking the echo of an invalid command.
+	if _, err := c.rw.Write([]byte{mpsseBadCommand, mpsseSendNow}); err != nil {
+		return err
+	}
+	var resp [2]byte
+	if _, err := io.ReadFull(c.rw, resp[:]); err != nil {
+		return err
+	}
+	if resp != [2]byte{mpsseBadResponse, mpsseBadCommand} {
+		return fmt.Errorf("error syncing with MPSSE: got % x", resp)
+	}
+	cmd := []byte{mpsseDiv5Off, mpsseAdaptiveOff, mpsse3PhaseOff, mpsseLoopbackOff}
+	cmd = append(cmd, c.divisorCmd(c.speed)...)
+	cmd = append(cmd, c.lowCmd(false)...)
+	_, err := c.rw.Write(cmd)
+	return err
+}
+
+// divisorCmd returns the command setting the clock to the highest
+// frequency not above speed Hz.
+func (c *ftdiConn) divisorCmd(speed uint32) []byte {
+	div := 0
+	if speed > 0 {
+		div = (mpsseBaseClock+int(speed)-1)/int(speed) - 1
+	}
+	if div < 0 {
+		div = 0
+	}
+	if div > 0xffff {
+		div = 0xffff
+	}
+	return []byte{mpsseDivisor, byte(div), byte(div >> 8)}
+}
+
+// lowCmd returns the command setting the ADBUS lines to
+// their idle state, with the chip select asserted if selected.
+func (c *ftdiConn) lowCmd(selected bool) []byte {
+	var v byte
+	if c.mode&2 != 0 {
+		v |= mpsseSCK // CPOL=1, the clock idles high.
+	}
+	if !selected {
+		v |= c.cs
+	}
+	return []byte{mpsseSetLow, v, mpsseSCK | mpsseDO | c.cs}
+}
+
+// shiftCmd returns the command to shift n bytes in and out.
+func (c *ftdiConn) shiftCmd(n int) []byte {
+	cmd := byte(mpsseWrite | mpsseRead)
+	// Data is sampled on the rising edge in the modes 0 and 3
+	// and on the falling edge in the modes 1 and 2. It is written
+	// on the opposite edge.
+	switch c.mode & 3 {
+	case 0, 3:
+		cmd |= mpsseWriteNeg
+	case 1, 2:
+		cmd |= mpsseReadNeg
+	}
+	if c.lsb {
+		cmd |= mpsseLSB
+	}
+	return []byte{cmd, byte(n - 1), byte((n - 1) >> 8)}
+}
+
+func (c *ftdiConn) Configure(k, v int) error {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		if v < 0 || v > 3 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.mode = uint8(v)
+		if _, err := c.rw.Write(c.lowCmd(false)); err != nil {
+			return &ConfigError{Key: k, Value: v, Err: err}
+		}
+	case driver.Bits:
+		if v <= 0 || v > 32 || v%8 != 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.bits = uint8(v)
+	case driver.Speed:
+		s := uint32(v)
+		if v <= 0 {
+			s = mpsseDefaultSpeed
+		}
+		if _, err := c.rw.Write(c.divisorCmd(s)); err != nil {
+			return &ConfigError{Key: k, Value: v, Err: err}
+		}
+		c.speed = s
+	case driver.Order:
+		c.lsb = v != 0
+	case driver.Delay:
+		if v < 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.delay = time.Duration(v) * time.Microsecond
+	case driver.TxNBits, driver.RxNBits:
+		if v != 0 && v != 1 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	case driver.CSChange:
+		c.csChange = v != 0
+	case driver.WordDelay:
+		if v != 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownKey, k)
+	}
+	return nil
+}
+
+func (c *ftdiConn) Query(k int) (int, error) {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		return int(c.mode), nil
+	case driver.Bits:
+		return int(c.bits), nil
+	case driver.Speed:
+		// Report the frequency actually generated by the divisor.
+		div := c.divisorCmd(c.speed)
+		return mpsseBaseClock / (1 + int(div[1]) + int(div[2])<<8), nil
+	case driver.Order:
+		if c.lsb {
+			return 1, nil
+		}
+		return 0, nil
+	case driver.Delay:
+		return int(c.delay / time.Microsecond), nil
+	case driver.TxNBits, driver.RxNBits:
+		return 1, nil
+	case driver.CSChange:
+		if c.csChange {
+			return 1, nil
+		}
+		return 0, nil
+	case driver.WordDelay:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrUnknownKey, k)
+	}
+}
+
+func (c *ftdiConn) Transfer(tx, rx []byte) error {
+	return c.TransferMany([]driver.Message{{Tx: tx, Rx: rx}})
+}
+
+func (c *ftdiConn) TransferMany(msgs []driver.Message) error {
+	msgs = allocBuffers(msgs)
+	for i, m := range msgs {
+		if len(m.Rx) != len(m.Tx) {
+			return fmt.Errorf("message %d: rx length (%d) does not match tx length (%d)", i, len(m.Rx), len(m.Tx))
+		}
+		if m.Bits != 0 && m.Bits != int(c.bits) {
+			return fmt.Errorf("message %d: per-message bits per word are not supported", i)
+		}
+		if n := wordSize(int(c.bits)); len(m.Tx)%n != 0 {
+			return fmt.Errorf("message %d: length %d is not a multiple of the %d-byte word size", i, len(m.Tx), n)
+		}
+		if m.TxNBits > 1 || m.RxNBits > 1 {
+			return fmt.Errorf("message %d: unsupported number of lines", i)
+		}
+	}
+	selected := false
+	for i, m := range msgs {
+		var cmd []byte
+		if !selected {
+			cmd = append(cmd, c.lowCmd(true)...)
+			selected = true
+		}
+		if m.Speed != 0 {
+			cmd = append(cmd, c.divisorCmd(uint32(m.Speed))...)
+		}
+		tx := c.toWire(m.Tx)
+		for b := tx; len(b) > 0; {
+			n := len(b)
+			if n > mpsseMaxLen {
+				n = mpsseMaxLen
+			}
+			cmd = append(cmd, c.shiftCmd(n)...)
+			cmd = append(cmd, b[:n]...)
+			b = b[n:]
+		}
+		if m.Speed != 0 {
+			cmd = append(cmd, c.divisorCmd(c.speed)...)
+		}
+		last := i == len(msgs)-1
+		csChange := m.CSChange || c.csChange && !m.NoCSChange
+		if last != csChange {
+			cmd = append(cmd, c.lowCmd(false)...)
+			selected = false
+		}
+		cmd = append(cmd, mpsseSendNow)
+		if _, err := c.rw.Write(cmd); err != nil {
+			return err
+		}
+		rx := m.Rx
+		if wordSize(int(c.bits)) > 1 {
+			rx = make([]byte, len(tx))
+		}
+		if _, err := io.ReadFull(c.rw, rx); err != nil {
+			return err
+		}
+		c.fromWire(m.Rx, rx)
+		delay := c.delay
+		if m.Delay != 0 {
+			delay = m.Delay
+		}
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+// toWire returns the bytes of the words of b in the order they are
+// shifted out, since MPSSE shifts bytes rather than words.
+func (c *ftdiConn) toWire(b []byte) []byte {
+	n := wordSize(int(c.bits))
+	if n == 1 {
+		return b
+	}
+	nw := int(c.bits) / 8
+	w := make([]byte, 0, len(b)/n*nw)
+	for i := 0; i+n <= len(b); i += n {
+		x := getWord(b[i : i+n])
+		for j := 0; j < nw; j++ {
+			w = append(w, byte(x>>c.wireShift(j, nw)))
+		}
+	}
+	return w
+}
+
+// fromWire stores the words shifted in as the bytes of w to b.
+func (c *ftdiConn) fromWire(b, w []byte) {
+	n := wordSize(int(c.bits))
+	if n == 1 {
+		copy(b, w)
+		return
+	}
+	nw := int(c.bits) / 8
+	for i := 0; i+n <= len(b); i += n {
+		var x uint32
+		for j := 0; j < nw; j++ {
+			x |= uint32(w[i/n*nw+j]) << c.wireShift(j, nw)
+		}
+		putWord(b[i:i+n], x)
+	}
+}
+
+// wireShift returns the shift of the jth of the nw bytes of a word.
+func (c *ftdiConn) wireShift(j, nw int) uint {
+	if c.lsb {
+		return uint(8 * j)
+	}
+	return uint(8 * (nw - 1 - j))
+}
+
+func (c *ftdiConn) Close() error {
+	return c.rw.Close()
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// fakeMPSSE emulates an MPSSE with its data out line tied
+// to its data in line.
+type fakeMPSSE struct {
+	resp     bytes.Buffer
+	low      []byte // values written to the ADBUS lines
+	divisors []int
+	shifts   []byte // shift commands
+	closed   bool
+}
+
+func (f *fakeMPSSE) Write(b []byte) (int, error) {
+	for i := 0; i < len(b); i++ {
+		switch cmd := b[i]; {
+		case cmd == mpsseSetLow:
+			f.low = append(f.low, b[i+1])
+			i += 2
+		case cmd == mpsseDivisor:
+			f.divisors = append(f.divisors, int(b[i+1])|int(b[i+2])<<8)
+			i += 2
+		case cmd == mpsseBadCommand:
+			f.resp.Write([]byte{mpsseBadResponse, mpsseBadCommand})
+		case cmd&(mpsseWrite|mpsseRead) == mpsseWrite|mpsseRead && cmd < 0x40:
+			n := int(b[i+1]) | int(b[i+2])<<8 + 1
+			f.shifts = append(f.shifts, cmd)
+			f.resp.Write(b[i+3 : i+3+n])
+			i += 2 + n
+		}
+	}
+	return len(b), nil
+}
+
+func (f *fakeMPSSE) Read(b []byte) (int, error) {
+	return f.resp.Read(b)
+}
+
+func (f *fakeMPSSE) Close() error {
+	f.closed = true
+	return nil
+}
+
+func openFakeFTDI(t *testing.T, chip int) (*fakeMPSSE, driver.Conn) {
+	f := &fakeMPSSE{}
+	d := &FTDI{Transport: func(bus int) (io.ReadWriteCloser, error) { return f, nil }}
+	c, err := d.Open(0, chip)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return f, c
+}
+
+func TestFTDIOpen(t *testing.T) {
+	f, c := openFakeFTDI(t, 1)
+	if len(f.divisors) != 1 || f.divisors[0] != 29 {
+		t.Errorf("divisors=%v, want [29]", f.divisors)
+	}
+	if len(f.low) != 1 || f.low[0] != mpsseCS0<<1 {
+		t.Errorf("low=% x, want [%x]", f.low, mpsseCS0<<1)
+	}
+	if speed, err := c.Query(driver.Speed); err != nil || speed != 1000000 {
+		t.Errorf("Query(Speed)=%d, %v, want 1000000, nil", speed, err)
+	}
+	if err := c.Configure(driver.Speed, 7000000); err != nil {
+		t.Fatalf("Configure(Speed): %v", err)
+	}
+	// 30MHz/(1+4) is the fastest clock not above 7MHz.
+	if speed, err := c.Query(driver.Speed); err != nil || speed != 6000000 {
+		t.Errorf("Query(Speed)=%d, %v, want 6000000, nil", speed, err)
+	}
+	if err := c.Close(); err != nil || !f.closed {
+		t.Errorf("Close()=%v, closed=%t, want nil, true", err, f.closed)
+	}
+	if _, err := (&FTDI{}).Open(0, 5); err == nil {
+		t.Errorf("Open(0, 5) succeeded, want error")
+	}
+}
+
+func TestFTDITransfer(t *testing.T) {
+	tests := []struct {
+		mode  int
+		order int
+		cmd   byte
+		idle  byte
+	}{
+		{mode: 0, order: 0, cmd: 0x31, idle: mpsseCS0},
+		{mode: 1, order: 0, cmd: 0x34, idle: mpsseCS0},
+		{mode: 2, order: 0, cmd: 0x34, idle: mpsseCS0 | mpsseSCK},
+		{mode: 3, order: 0, cmd: 0x31, idle: mpsseCS0 | mpsseSCK},
+		{mode: 0, order: 1, cmd: 0x39, idle: mpsseCS0},
+	}
+	for _, test := range tests {
+		f, c := openFakeFTDI(t, 0)
+		if err := c.Configure(driver.Mode, test.mode); err != nil {
+			t.Fatalf("Configure(Mode): %v", err)
+		}
+		if err := c.Configure(driver.Order, test.order); err != nil {
+			t.Fatalf("Configure(Order): %v", err)
+		}
+		f.low = nil
+		tx := []byte{1, 2, 3, 4}
+		rx := make([]byte, len(tx))
+		if err := c.Transfer(tx, rx); err != nil {
+			t.Fatalf("mode=%d order=%d: Transfer: %v", test.mode, test.order, err)
+		}
+		if !bytes.Equal(rx, tx) {
+			t.Errorf("mode=%d order=%d: rx=% x, want % x", test.mode, test.order, rx, tx)
+		}
+		if len(f.shifts) != 1 || f.shifts[0] != test.cmd {
+			t.Errorf("mode=%d order=%d: shift commands=% x, want [%x]", test.mode, test.order, f.shifts, test.cmd)
+		}
+		selected := test.idle &^ mpsseCS0
+		if want := []byte{selected, test.idle}; !bytes.Equal(f.low, want) {
+			t.Errorf("mode=%d order=%d: low=% x, want % x", test.mode, test.order, f.low, want)
+		}
+	}
+}
+
+func TestFTDITransferWords(t *testing.T) {
+	_, c := openFakeFTDI(t, 0)
+	if err := c.Configure(driver.Bits, 16); err != nil {
+		t.Fatalf("Configure(Bits): %v", err)
+	}
+	tx := make([]byte, 4)
+	putWord(tx[0:2], 0x1234)
+	putWord(tx[2:4], 0xabcd)
+	rx := make([]byte, len(tx))
+	if err := c.Transfer(tx, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !bytes.Equal(rx, tx) {
+		t.Errorf("rx=% x, want % x", rx, tx)
+	}
+	if err := c.Transfer(tx[:3], rx[:3]); err == nil {
+		t.Errorf("Transfer of 3 bytes with 16-bit words succeeded, want error")
+	}
+}
+
+func TestFTDIToWire(t *testing.T) {
+	c := &ftdiConn{bits: 16}
+	b := make([]byte, 2)
+	putWord(b, 0x1234)
+	if w := c.toWire(b); !bytes.Equal(w, []byte{0x12, 0x34}) {
+		t.Errorf("MSB-first toWire(0x1234)=% x, want 12 34", w)
+	}
+	c.lsb = true
+	if w := c.toWire(b); !bytes.Equal(w, []byte{0x34, 0x12}) {
+		t.Errorf("LSB-first toWire(0x1234)=% x, want 34 12", w)
+	}
+	c = &ftdiConn{bits: 24}
+	b = make([]byte, 4)
+	putWord(b, 0x123456)
+	w := c.toWire(b)
+	if !bytes.Equal(w, []byte{0x12, 0x34, 0x56}) {
+		t.Errorf("toWire(0x123456)=% x, want 12 34 56", w)
+	}
+	got := make([]byte, 4)
+	c.fromWire(got, w)
+	if !bytes.Equal(got, b) {
+		t.Errorf("fromWire(% x)=% x, want % x", w, got, b)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// GPIO is an SPI driver that bit-bangs the SPI protocol over
+// four GPIO lines, for boards without an SPI controller or
+// without spidev support. The lines are accessed through the
+// sysfs GPIO interface at /sys/class/gpio and are identified
+// by their kernel GPIO numbers.
+//
+// The clock speed is approximate and limited by the cost of
+// toggling the lines, which is much slower than an SPI controller.
+type GPIO struct {
+	SCLK int // clock
+	MOSI int // master output, slave input
+	MISO int // master input, slave output
+	CS   int // active low chip select
+}
+
+// Open exports the GPIO lines and returns a connection.
+// The bus and chip numbers are ignored; the device is
+// selected by the GPIO lines.
+func (g *GPIO) Open(bus, chip int) (driver.Conn, error) {
+	lines := []struct {
+		n   int
+		dir string
+	}{
+		{g.SCLK, "low"},
+		{g.MOSI, "low"},
+		{g.MISO, "in"},
+		{g.CS, "high"},
+	}
+	var pins []gpioPin
+	for _, l := range lines {
+		p, err := openSysfsPin(l.n, l.dir)
+		if err != nil {
+			for _, p := range pins {
+				p.close()
+			}
+			return nil, err
+		}
+		pins = append(pins, p)
+	}
+	return newGPIOConn(pins[0], pins[1], pins[2], pins[3]), nil
+}
+
+// gpioPin is a single GPIO line.
+type gpioPin interface {
+	set(high bool) error
+	get() (bool, error)
+	close() error
+}
+
+type gpioConn struct {
+	sclk, mosi, miso, cs gpioPin
+
+	mode      uint8
+	lsb       bool
+	bits      uint8
+	speed     uint32
+	delay     time.Duration
+	wordDelay time.Duration
+	csChange  bool
+
+	// err is the first error returned by a line during a transfer.
+	err error
+}
+
+func newGPIOConn(sclk, mosi, miso, cs gpioPin) *gpioConn {
+	return &gpioConn{
+		sclk: sclk,
+		mosi: mosi,
+		miso: miso,
+		cs:   cs,
+		bits: 8,
+	}
+}
+
+func (c *gpioConn) Configure(k, v int) error {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		if v < 0 || v > 3 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.mode = uint8(v)
+		// Move the clock to its idle level.
+		if err := c.sclk.set(c.cpol()); err != nil {
+			return &ConfigError{Key: k, Value: v, Err: err}
+		}
+	case driver.Bits:
+		if v < 1 || v > 32 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.bits = uint8(v)
+	case driver.Speed:
+		c.speed = uint32(v)
+	case driver.Order:
+		c.lsb = v != 0
+	case driver.Delay:
+		if v < 0 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		c.delay = time.Duration(v) * time.Microsecond
+	case driver.TxNBits, driver.RxNBits:
+		if v != 0 && v != 1 {
+			return &ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	case driver.CSChange:
+		c.csChange = v != 0
+	case driver.WordDelay:
+		c.wordDelay = time.Duration(v) * time.Microsecond
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownKey, k)
+	}
+	return nil
+}
+
+func (c *gpioConn) Query(k int) (int, error) {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		return int(c.mode), nil
+	case driver.Bits:
+		return int(c.bits), nil
+	case driver.Speed:
+		return int(c.speed), nil
+	case driver.Order:
+		if c.lsb {
+			return 1, nil
+		}
+		return 0, nil
+	case driver.Delay:
+		return int(c.delay / time.Microsecond), nil
+	case driver.TxNBits, driver.RxNBits:
+		return 1, nil
+	case driver.CSChange:
+		if c.csChange {
+			return 1, nil
+		}
+		return 0, nil
+	case driver.WordDelay:
+		return int(c.wordDelay / time.Microsecond), nil
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrUnknownKey, k)
+	}
+}
+
+func (c *gpioConn) Transfer(tx, rx []byte) error {
+	return c.TransferMany([]driver.Message{{Tx: tx, Rx: rx}})
+}
+
+func (c *gpioConn) TransferMany(msgs []driver.Message) error {
+	msgs = allocBuffers(msgs)
+	for i, m := range msgs {
+		if len(m.Rx) != len(m.Tx) {
+			return fmt.Errorf("message %d: rx length (%d) does not match tx length (%d)", i, len(m.Rx), len(m.Tx))
+		}
+		if m.TxNBits > 1 || m.RxNBits > 1 {
+			return fmt.Errorf("message %d: unsupported number of lines", i)
+		}
+	}
+	c.err = nil
+	c.set(c.cs, false)
+	for i, m := range msgs {
+		csChange := m.CSChange || c.csChange && !m.NoCSChange
+		if err := c.message(m); err != nil {
+			c.cs.set(true)
+			return err
+		}
+		if i < len(msgs)-1 && csChange {
+			c.set(c.cs, true)
+			c.set(c.cs, false)
+		}
+		if i == len(msgs)-1 && !csChange {
+			c.set(c.cs, true)
+		}
+	}
+	return c.err
+}
+
+// message clocks out the words of m.Tx while reading m.Rx.
+func (c *gpioConn) message(m driver.Message) error {
+	bits := int(c.bits)
+	if m.Bits != 0 {
+		bits = m.Bits
+	}
+	speed := int(c.speed)
+	if m.Speed != 0 {
+		speed = m.Speed
+	}
+	delay := c.delay
+	if m.Delay != 0 {
+		delay = m.Delay
+	}
+	var half time.Duration
+	if speed > 0 {
+		half = time.Second / time.Duration(2*speed)
+	}
+	n := wordSize(bits)
+	if len(m.Tx)%n != 0 {
+		return fmt.Errorf("length %d is not a multiple of the %d-byte word size", len(m.Tx), n)
+	}
+	for i := 0; i < len(m.Tx); i += n {
+		w := c.word(getWord(m.Tx[i:i+n]), bits, half)
+		if c.err != nil {
+			return c.err
+		}
+		putWord(m.Rx[i:i+n], w)
+		if i+n < len(m.Tx) {
+			wait(c.wordDelay)
+		}
+	}
+	time.Sleep(delay)
+	return c.err
+}
+
+// word clocks out the low bits of w while reading a word from the device.
+func (c *gpioConn) word(w uint32, bits int, half time.Duration) uint32 {
+	cpol, cpha := c.cpol(), c.mode&1 != 0
+	var r uint32
+	for i := 0; i < bits; i++ {
+		shift := uint(bits - 1 - i)
+		if c.lsb {
+			shift = uint(i)
+		}
+		out := w>>shift&1 != 0
+		var in bool
+		if !cpha {
+			// Data is shifted out before the leading edge
+			// and sampled on the leading edge.
+			c.set(c.mosi, out)
+			wait(half)
+			c.set(c.sclk, !cpol)
+			in = c.get(c.miso)
+			wait(half)
+			c.set(c.sclk, cpol)
+		} else {
+			// Data is shifted out on the leading edge
+			// and sampled on the trailing edge.
+			c.set(c.sclk, !cpol)
+			c.set(c.mosi, out)
+			wait(half)
+			c.set(c.sclk, cpol)
+			in = c.get(c.miso)
+			wait(half)
+		}
+		if in {
+			r |= 1 << shift
+		}
+	}
+	return r
+}
+
+func (c *gpioConn) cpol() bool {
+	return c.mode&2 != 0
+}
+
+func (c *gpioConn) set(p gpioPin, high bool) {
+	if c.err != nil {
+		return
+	}
+	c.err = p.set(high)
+}
+
+func (c *gpioConn) get(p gpioPin) bool {
+	if c.err != nil {
+		return false
+	}
+	v, err := p.get()
+	c.err = err
+	return v
+}
+
+func (c *gpioConn) Close() error {
+	var err error
+	for _, p := range []gpioPin{c.sclk, c.mosi, c.miso, c.cs} {
+		if e := p.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// wait busy-waits for d, since sleeping is too coarse for
+// the duration of a clock cycle.
+func wait(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	for t := time.Now(); time.Since(t) < d; {
+	}
+}
+
+// sysfsPin is a GPIO line accessed through /sys/class/gpio.
+type sysfsPin struct {
+	f *os.File
+}
+
+// openSysfsPin exports the GPIO line n if needed and sets its direction,
+// which is one of "in", "out", "low" or "high"; "low" and "high" set
+// the line as an output with the given initial value.
+func openSysfsPin(n int, dir string) (*sysfsPin, error) {
+	d := fmt.Sprintf("/sys/class/gpio/gpio%d", n)
+	if _, err := os.Stat(d); os.IsNotExist(err) {
+		if err := os.WriteFile("/sys/class/gpio/export", []byte(strconv.Itoa(n)), 0); err != nil {
+			return nil, fmt.Errorf("error exporting GPIO %d: %w", n, err)
+		}
+	}
+	if err := os.WriteFile(d+"/direction", []byte(dir), 0); err != nil {
+		return nil, fmt.Errorf("error setting GPIO %d direction: %w", n, err)
+	}
+	f, err := os.OpenFile(d+"/value", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &sysfsPin{f: f}, nil
+}
+
+func (p *sysfsPin) set(high bool) error {
+	v := []byte{'0'}
+	if high {
+		v[0] = '1'
+	}
+	_, err := p.f.WriteAt(v, 0)
+	return err
+}
+
+func (p *sysfsPin) get() (bool, error) {
+	var v [1]byte
+	if _, err := p.f.ReadAt(v[:], 0); err != nil {
+		return false, err
+	}
+	return v[0] == '1', nil
+}
+
+func (p *sysfsPin) close() error {
+	return p.f.Close()
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// fakeSlave is an SPI device on the fake GPIO lines. It samples
+// MOSI and shifts out the bits of out on the clock edges of the
+// configured mode, as a hardware device would.
+type fakeSlave struct {
+	cpol, cpha bool
+
+	sclk, mosi, cs bool
+	in             []bool // bits sampled from MOSI
+	out            []bool // bits to shift out on MISO
+	shifted        int    // number of shift edges since CS was asserted
+	selects        int    // number of times CS was asserted
+}
+
+type fakePin struct {
+	s    *fakeSlave
+	line string
+}
+
+func (p *fakePin) set(high bool) error {
+	s := p.s
+	switch p.line {
+	case "sclk":
+		if high == s.sclk {
+			return nil
+		}
+		s.sclk = high
+		if s.cs {
+			return nil
+		}
+		leading := high != s.cpol
+		if leading != s.cpha {
+			s.in = append(s.in, s.mosi)
+		} else {
+			s.shifted++
+		}
+	case "mosi":
+		s.mosi = high
+	case "cs":
+		if s.cs && !high {
+			s.selects++
+			s.shifted = 0
+		}
+		s.cs = high
+	}
+	return nil
+}
+
+func (p *fakePin) get() (bool, error) {
+	s := p.s
+	i := s.shifted
+	if s.cpha {
+		i--
+	}
+	if s.cs || i < 0 || i >= len(s.out) {
+		return false, nil
+	}
+	return s.out[i], nil
+}
+
+func (p *fakePin) close() error { return nil }
+
+func (s *fakeSlave) conn() *gpioConn {
+	s.cs = true
+	s.sclk = s.cpol
+	return newGPIOConn(&fakePin{s, "sclk"}, &fakePin{s, "mosi"}, &fakePin{s, "miso"}, &fakePin{s, "cs"})
+}
+
+func bitsOf(b []byte, lsb bool) []bool {
+	var bits []bool
+	for _, x := range b {
+		for i := uint(0); i < 8; i++ {
+			shift := 7 - i
+			if lsb {
+				shift = i
+			}
+			bits = append(bits, x>>shift&1 != 0)
+		}
+	}
+	return bits
+}
+
+func TestGPIOTransfer(t *testing.T) {
+	tx := []byte{0xa5, 0x01, 0x80}
+	resp := []byte{0x3c, 0xfe, 0x7f}
+	for mode := 0; mode < 4; mode++ {
+		for _, lsb := range []bool{false, true} {
+			s := &fakeSlave{cpol: mode&2 != 0, cpha: mode&1 != 0}
+			s.out = bitsOf(resp, lsb)
+			c := s.conn()
+			if err := c.Configure(driver.Mode, mode); err != nil {
+				t.Fatalf("Configure(Mode, %d): %v", mode, err)
+			}
+			order := 0
+			if lsb {
+				order = 1
+			}
+			if err := c.Configure(driver.Order, order); err != nil {
+				t.Fatalf("Configure(Order, %d): %v", order, err)
+			}
+			rx := make([]byte, len(tx))
+			if err := c.Transfer(tx, rx); err != nil {
+				t.Fatalf("mode=%d lsb=%t: Transfer: %v", mode, lsb, err)
+			}
+			if got, want := s.in, bitsOf(tx, lsb); !equalBits(got, want) {
+				t.Errorf("mode=%d lsb=%t: device got %v, want %v", mode, lsb, got, want)
+			}
+			if !bytes.Equal(rx, resp) {
+				t.Errorf("mode=%d lsb=%t: rx=% x, want % x", mode, lsb, rx, resp)
+			}
+			if !s.cs || s.selects != 1 {
+				t.Errorf("mode=%d lsb=%t: cs=%t selects=%d, want deasserted after 1 select", mode, lsb, s.cs, s.selects)
+			}
+		}
+	}
+}
+
+func TestGPIOTransferManyCSChange(t *testing.T) {
+	s := &fakeSlave{}
+	c := s.conn()
+	msgs := []driver.Message{
+		{Tx: []byte{1}, Rx: make([]byte, 1), CSChange: true},
+		{Tx: []byte{2}, Rx: make([]byte, 1)},
+		{Tx: []byte{3}, Rx: make([]byte, 1), CSChange: true},
+	}
+	if err := c.TransferMany(msgs); err != nil {
+		t.Fatalf("TransferMany: %v", err)
+	}
+	if s.selects != 2 {
+		t.Errorf("selects=%d, want 2", s.selects)
+	}
+	if s.cs {
+		t.Errorf("cs deasserted after last message with CSChange set, want asserted")
+	}
+}
+
+func TestGPIOTransferManyNoCSChange(t *testing.T) {
+	s := &fakeSlave{}
+	c := s.conn()
+	if err := c.Configure(driver.CSChange, 1); err != nil {
+		t.Fatalf("Configure(CSChange, 1): %v", err)
+	}
+	msgs := []driver.Message{
+		{Tx: []byte{1}, Rx: make([]byte, 1), NoCSChange: true},
+		{Tx: []byte{2}, Rx: make([]byte, 1), NoCSChange: true},
+	}
+	if err := c.TransferMany(msgs); err != nil {
+		t.Fatalf("TransferMany: %v", err)
+	}
+	if s.selects != 1 {
+		t.Errorf("selects=%d, want 1", s.selects)
+	}
+	if !s.cs {
+		t.Errorf("cs asserted after last message with NoCSChange set, want deasserted")
+	}
+}
+
+func TestGPIOConfigure(t *testing.T) {
+	c := (&fakeSlave{}).conn()
+	if err := c.Configure(driver.Mode, 4); err == nil {
+		t.Errorf("Configure(Mode, 4) succeeded, want error")
+	}
+	if err := c.Configure(driver.Bits, 33); err == nil {
+		t.Errorf("Configure(Bits, 33) succeeded, want error")
+	}
+	if err := c.Configure(driver.TxNBits, 4); err == nil {
+		t.Errorf("Configure(TxNBits, 4) succeeded, want error")
+	}
+	if err := c.Configure(driver.Bits, 12); err != nil {
+		t.Fatalf("Configure(Bits, 12): %v", err)
+	}
+	if err := c.Transfer([]byte{1, 2, 3}, make([]byte, 3)); err == nil {
+		t.Errorf("Transfer of 3 bytes with 12-bit words succeeded, want error")
+	}
+}
+
+func equalBits(a, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// errNoIoctl is returned by Ioctl for the drivers
+// that are not backed by a device file.
+var errNoIoctl = errors.New("spi: driver does not support ioctls")
+
+// Ioctl issues the ioctl request with the argument arg on the device
+// file of a device opened with the DevFS or DevFSFile driver, and
+// returns an error for the other drivers. The request is serialized
+// with the transfers; on Linux, RequestCode and MessageRequestCode
+// build the request codes.
+//
+// Ioctl is an escape hatch for the vendor specific requests of some
+// controllers that are not modeled by the package. The package doesn't
+// know about the effects of the request, which may leave the device in
+// a state that the other methods don't expect. arg is usually a pointer
+// to the argument of the request, which must stay valid until Ioctl
+// returns.
+func (d *Device) Ioctl(request uintptr, arg unsafe.Pointer) error {
+	c, ok := d.driverConn().(interface {
+		Ioctl(request uintptr, arg unsafe.Pointer) error
+	})
+	if !ok {
+		return errNoIoctl
+	}
+	return c.Ioctl(request, arg)
+}
+
+// errNoFd is returned by Fd for the drivers
+// that are not backed by a file descriptor.
+var errNoFd = errors.New("spi: driver has no file descriptor")
+
+// Fd returns the file descriptor of the device file of a device opened
+// with the DevFS or DevFSFile driver, for instance to wait for the
+// events of the device with poll or epoll, and returns an error for the
+// other drivers. The descriptor belongs to the device: it must not be
+// closed, and it is only valid until the device is closed.
+func (d *Device) Fd() (uintptr, error) {
+	c, ok := d.driverConn().(interface{ Fd() uintptr })
+	if !ok {
+		return 0, errNoFd
+	}
+	fd := c.Fd()
+	if fd == ^uintptr(0) {
+		return 0, errNoFd
+	}
+	return fd, nil
+}
+
+// Conn returns the connection of the driver the device was opened
+// with, for the driver specific methods that the package doesn't
+// expose. The device doesn't know about the changes made through the
+// connection: settings restored by the device, such as the speed set
+// by Reset, and the counters returned by Stats don't reflect them.
+// The tracer and the chip select set with SetChipSelect are bypassed.
+func (d *Device) Conn() driver.Conn {
+	return d.driverConn()
+}
+
+// driverConn returns the connection of the driver,
+// without the tracer and the chip select, if any.
+func (d *Device) driverConn() driver.Conn {
+	c := d.conn
+	for {
+		switch w := c.(type) {
+		case *tracingConn:
+			c = w.Conn
+		case *chipSelectConn:
+			c = w.Conn
+		default:
+			return c
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"testing"
+	"unsafe"
+
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// ioctlConn is a connection recording its ioctl requests.
+type ioctlConn struct {
+	spitest.Conn
+	reqs []uintptr
+}
+
+func (c *ioctlConn) Ioctl(request uintptr, arg unsafe.Pointer) error {
+	c.reqs = append(c.reqs, request)
+	*(*uint32)(arg) = 42
+	return nil
+}
+
+func TestDeviceIoctl(t *testing.T) {
+	c := &ioctlConn{}
+	dev := &Device{conn: c}
+	// The request reaches the driver below the tracer and the chip select.
+	dev.SetTracer(func(TraceEvent) {})
+	dev.SetChipSelect(func() error { return nil }, nil)
+	var v uint32
+	if err := dev.Ioctl(0x80046b10, unsafe.Pointer(&v)); err != nil {
+		t.Fatalf("Ioctl: %v", err)
+	}
+	if len(c.reqs) != 1 || c.reqs[0] != 0x80046b10 {
+		t.Errorf("requests=%#x, want [0x80046b10]", c.reqs)
+	}
+	if v != 42 {
+		t.Errorf("arg=%d, want 42", v)
+	}
+
+	dev = &Device{conn: &spitest.Conn{}}
+	if err := dev.Ioctl(0x80046b10, unsafe.Pointer(&v)); err != errNoIoctl {
+		t.Errorf("Ioctl on spitest.Conn=%v, want %v", err, errNoIoctl)
+	}
+}
+
+func TestDeviceConn(t *testing.T) {
+	c := &ioctlConn{}
+	dev := &Device{conn: c}
+	dev.SetTracer(func(TraceEvent) {})
+	dev.SetChipSelect(func() error { return nil }, nil)
+	ic, ok := dev.Conn().(*ioctlConn)
+	if !ok {
+		t.Fatalf("Conn()=%T, want *ioctlConn", dev.Conn())
+	}
+	if ic != c {
+		t.Errorf("Conn() returned another connection than the driver's")
+	}
+}
+
+func TestDeviceFdUnsupported(t *testing.T) {
+	dev := &Device{conn: &spitest.Conn{}}
+	if _, err := dev.Fd(); err != errNoFd {
+		t.Errorf("Fd() on spitest.Conn=%v, want %v", err, errNoFd)
+	}
+}
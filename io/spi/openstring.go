@@ -0,0 +1,100 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenString opens the device described by s, which has the form
+//
+//	scheme://bus.chip?key=value&...
+//
+// for instance spidev://0.1?mode=3&speed=1000000. The scheme selects
+// the driver registered with Register, e.g. spidev for DevFS.
+// The optional parameters are:
+//   - mode, the SPI mode as a number from 0 to 3 or parsed by ParseMode;
+//   - speed, the max clock speed in Hz;
+//   - bits, the number of bits per word;
+//   - order, the bit order parsed by ParseOrder.
+func OpenString(s string) (*Device, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection string %q: %v", s, err)
+	}
+	o, ok := lookup(u.Scheme)
+	if !ok {
+		return nil, fmt.Errorf("invalid connection string %q: unknown scheme %q", s, u.Scheme)
+	}
+	bus, chip, err := parseBusChip(u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection string %q: %v", s, err)
+	}
+	mode := Mode0
+	speed := 0
+	var opts []Option
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection string %q: %v", s, err)
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := q.Get(k)
+		switch k {
+		case "mode":
+			mode, err = parseModeParam(v)
+		case "speed":
+			speed, err = strconv.Atoi(v)
+		case "bits":
+			var bits int
+			bits, err = strconv.Atoi(v)
+			opts = append(opts, WithBits(bits))
+		case "order":
+			var o Order
+			o, err = ParseOrder(v)
+			opts = append(opts, WithBitOrder(o))
+		default:
+			err = fmt.Errorf("unknown parameter")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection string %q: %s=%s: %v", s, k, v, err)
+		}
+	}
+	return Open(o, bus, chip, mode, speed, opts...)
+}
+
+// parseBusChip parses the bus and chip numbers of "bus.chip".
+func parseBusChip(s string) (bus, chip int, err error) {
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid bus and chip %q, want bus.chip", s)
+	}
+	bus, err = strconv.Atoi(s[:i])
+	if err != nil || bus < 0 {
+		return 0, 0, fmt.Errorf("invalid bus %q", s[:i])
+	}
+	chip, err = strconv.Atoi(s[i+1:])
+	if err != nil || chip < 0 {
+		return 0, 0, fmt.Errorf("invalid chip %q", s[i+1:])
+	}
+	return bus, chip, nil
+}
+
+// parseModeParam parses a mode number from 0 to 3, or a mode
+// parsed by ParseMode.
+func parseModeParam(s string) (Mode, error) {
+	if len(s) == 1 && s[0] >= '0' && s[0] <= '3' {
+		return Mode(s[0] - '0'), nil
+	}
+	return ParseMode(s)
+}
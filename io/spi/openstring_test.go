@@ -0,0 +1,92 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestOpenString(t *testing.T) {
+	defer unregister("test")
+	tests := []struct {
+		s    string
+		bus  int
+		chip int
+		want []spitest.Config
+	}{
+		{
+			s: "test://0.1", bus: 0, chip: 1,
+			want: []spitest.Config{{Key: driver.Mode, Value: 0}, {Key: driver.Speed, Value: 0}},
+		},
+		{
+			s: "test://2.3?mode=3&speed=1000000&bits=16&order=lsb", bus: 2, chip: 3,
+			want: []spitest.Config{
+				{Key: driver.Mode, Value: 3},
+				{Key: driver.Speed, Value: 1000000},
+				{Key: driver.Bits, Value: 16},
+				{Key: driver.Order, Value: 1},
+			},
+		},
+		{
+			s: "test://0.0?mode=mode1,cshigh", bus: 0, chip: 0,
+			want: []spitest.Config{{Key: driver.Mode, Value: int(Mode1 | CSHigh)}, {Key: driver.Speed, Value: 0}},
+		},
+	}
+	for _, test := range tests {
+		c := &spitest.Conn{}
+		unregister("test")
+		Register("test", c)
+		dev, err := OpenString(test.s)
+		if err != nil {
+			t.Errorf("OpenString(%q): %v", test.s, err)
+			continue
+		}
+		if bus, chip := c.Bus(); bus != test.bus || chip != test.chip {
+			t.Errorf("OpenString(%q) opened %d.%d, want %d.%d", test.s, bus, chip, test.bus, test.chip)
+		}
+		if got := c.Configs(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("OpenString(%q) configs=%v, want %v", test.s, got, test.want)
+		}
+		dev.Close()
+	}
+}
+
+func TestOpenStringErrors(t *testing.T) {
+	Register("test", &spitest.Conn{})
+	defer unregister("test")
+
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"unknown://0.0", "unknown scheme"},
+		{"0.0", "unknown scheme"},
+		{"test://0", "invalid bus and chip"},
+		{"test://x.0", "invalid bus"},
+		{"test://0.y", "invalid chip"},
+		{"test://0.0?mode=4", "mode=4"},
+		{"test://0.0?speed=fast", "speed=fast"},
+		{"test://0.0?bits=", "bits="},
+		{"test://0.0?order=middle", "order=middle"},
+		{"test://0.0?parity=even", "unknown parameter"},
+		{"test://0.0?%zz", "invalid"},
+	}
+	for _, test := range tests {
+		dev, err := OpenString(test.s)
+		if err == nil {
+			dev.Close()
+			t.Errorf("OpenString(%q) succeeded, want error", test.s)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("OpenString(%q)=%v, want an error containing %q", test.s, err, test.want)
+		}
+	}
+}
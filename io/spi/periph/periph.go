@@ -0,0 +1,213 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package periph adapts the SPI ports of periph.io to the SPI
+// driver interface, so that the devices of package spi can be used
+// on the buses supported by periph.io.
+package periph // import "golang.org/x/exp/io/spi/periph"
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/exp/io/spi"
+	"golang.org/x/exp/io/spi/driver"
+	"periph.io/x/conn/v3/physic"
+	pspi "periph.io/x/conn/v3/spi"
+)
+
+var (
+	errUnsupported = errors.New("unsupported value")
+	errConnected   = errors.New("can't be changed after the first transfer")
+)
+
+// Opener is an SPI driver using periph.io SPI ports.
+type Opener struct {
+	// Port opens the periph.io port of bus and chip,
+	// for instance with spireg.Open.
+	Port func(bus, chip int) (pspi.PortCloser, error)
+}
+
+// Open opens the port of bus and chip and returns a connection.
+func (o *Opener) Open(bus, chip int) (driver.Conn, error) {
+	if o.Port == nil {
+		return nil, fmt.Errorf("no periph.io port")
+	}
+	p, err := o.Port(bus, chip)
+	if err != nil {
+		return nil, err
+	}
+	return New(p), nil
+}
+
+// New returns a connection using the port p, which is closed
+// when the connection is closed.
+//
+// periph.io ports are configured once, when they are connected.
+// The port is connected on the first transfer, after which the mode,
+// the bits per word and the bit order can't be changed. The speed
+// can be changed at any time.
+func New(p pspi.PortCloser) driver.Conn {
+	return &portConn{p: p, bits: 8}
+}
+
+type portConn struct {
+	p pspi.PortCloser
+	c pspi.Conn // nil until the first transfer
+
+	mode     int
+	bits     int
+	speed    int
+	lsb      bool
+	csChange bool
+}
+
+func (c *portConn) Configure(k, v int) error {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		if v < 0 || spi.Mode(v)&^(3|spi.ThreeWire|spi.NoCS) != 0 {
+			return &spi.ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		if c.c != nil {
+			return &spi.ConfigError{Key: k, Value: v, Err: errConnected}
+		}
+		c.mode = v
+	case driver.Bits:
+		if v <= 0 {
+			return &spi.ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		if c.c != nil {
+			return &spi.ConfigError{Key: k, Value: v, Err: errConnected}
+		}
+		c.bits = v
+	case driver.Speed:
+		if v < 0 {
+			return &spi.ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+		// Zero is not a valid limit; it leaves the speed of the port.
+		if v > 0 {
+			if err := c.p.LimitSpeed(physic.Frequency(v) * physic.Hertz); err != nil {
+				return &spi.ConfigError{Key: k, Value: v, Err: err}
+			}
+		}
+		c.speed = v
+	case driver.Order:
+		if c.c != nil {
+			return &spi.ConfigError{Key: k, Value: v, Err: errConnected}
+		}
+		c.lsb = v != 0
+	case driver.Delay, driver.WordDelay:
+		if v != 0 {
+			return &spi.ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	case driver.TxNBits, driver.RxNBits:
+		if v != 0 && v != 1 {
+			return &spi.ConfigError{Key: k, Value: v, Err: errUnsupported}
+		}
+	case driver.CSChange:
+		c.csChange = v != 0
+	default:
+		return fmt.Errorf("%w: %v", spi.ErrUnknownKey, k)
+	}
+	return nil
+}
+
+func (c *portConn) Query(k int) (int, error) {
+	switch k {
+	case driver.Mode, driver.Mode32:
+		return c.mode, nil
+	case driver.Bits:
+		return c.bits, nil
+	case driver.Speed:
+		return c.speed, nil
+	case driver.Order:
+		if c.lsb {
+			return 1, nil
+		}
+		return 0, nil
+	case driver.Delay, driver.WordDelay:
+		return 0, nil
+	case driver.TxNBits, driver.RxNBits:
+		return 1, nil
+	case driver.CSChange:
+		if c.csChange {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%w: %v", spi.ErrUnknownKey, k)
+	}
+}
+
+// connect connects the port with the configured settings
+// if it isn't connected yet.
+func (c *portConn) connect() error {
+	if c.c != nil {
+		return nil
+	}
+	m := pspi.Mode(c.mode & 3)
+	if spi.Mode(c.mode)&spi.ThreeWire != 0 {
+		m |= pspi.HalfDuplex
+	}
+	if spi.Mode(c.mode)&spi.NoCS != 0 {
+		m |= pspi.NoCS
+	}
+	if c.lsb {
+		m |= pspi.LSBFirst
+	}
+	pc, err := c.p.Connect(0, m, c.bits)
+	if err != nil {
+		return err
+	}
+	c.c = pc
+	return nil
+}
+
+func (c *portConn) Transfer(tx, rx []byte) error {
+	return c.TransferMany([]driver.Message{{Tx: tx, Rx: rx}})
+}
+
+// TransferMany performs the messages with a single Tx if there is only
+// one message to send with the connection defaults, and with TxPackets
+// otherwise.
+func (c *portConn) TransferMany(msgs []driver.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ps := make([]pspi.Packet, len(msgs))
+	for i, m := range msgs {
+		// Write zeros for a nil Tx and discard the data read for a nil Rx.
+		if m.Tx == nil {
+			m.Tx = make([]byte, len(m.Rx))
+		}
+		if m.Rx == nil {
+			m.Rx = make([]byte, len(m.Tx))
+		}
+		if len(m.Rx) != len(m.Tx) {
+			return fmt.Errorf("message %d: rx length (%d) does not match tx length (%d)", i, len(m.Rx), len(m.Tx))
+		}
+		if m.Speed != 0 || m.Delay != 0 || m.TxNBits > 1 || m.RxNBits > 1 {
+			return fmt.Errorf("message %d: per-message speed, delay and lines are not supported", i)
+		}
+		if m.Bits < 0 || m.Bits > 0xff {
+			return fmt.Errorf("message %d: unsupported bits per word: %d", i, m.Bits)
+		}
+		// KeepCS keeps the chip select asserted after the packet,
+		// which is the opposite of cs_change except after the last one.
+		last := i == len(msgs)-1
+		csChange := m.CSChange || c.csChange && !m.NoCSChange
+		ps[i] = pspi.Packet{W: m.Tx, R: m.Rx, BitsPerWord: uint8(m.Bits), KeepCS: last == csChange}
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	if len(ps) == 1 && ps[0].BitsPerWord == 0 && !ps[0].KeepCS {
+		return c.c.Tx(ps[0].W, ps[0].R)
+	}
+	return c.c.TxPackets(ps)
+}
+
+func (c *portConn) Close() error {
+	return c.p.Close()
+}
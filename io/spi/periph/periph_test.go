@@ -0,0 +1,178 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package periph
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi"
+	"golang.org/x/exp/io/spi/driver"
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/conntest"
+	"periph.io/x/conn/v3/physic"
+	pspi "periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spitest"
+)
+
+// fakePort is a periph.io SPI port recording its use.
+type fakePort struct {
+	connects int
+	mode     pspi.Mode
+	bits     int
+	limit    physic.Frequency
+	packets  [][]pspi.Packet
+	closed   bool
+}
+
+func (p *fakePort) String() string { return "fake" }
+
+func (p *fakePort) Connect(f physic.Frequency, mode pspi.Mode, bits int) (pspi.Conn, error) {
+	p.connects++
+	p.mode = mode
+	p.bits = bits
+	return &fakePortConn{p}, nil
+}
+
+func (p *fakePort) LimitSpeed(f physic.Frequency) error {
+	p.limit = f
+	return nil
+}
+
+func (p *fakePort) Close() error {
+	p.closed = true
+	return nil
+}
+
+type fakePortConn struct {
+	p *fakePort
+}
+
+func (c *fakePortConn) String() string { return "fake" }
+
+func (c *fakePortConn) Duplex() conn.Duplex { return conn.Full }
+
+func (c *fakePortConn) Tx(w, r []byte) error {
+	return c.TxPackets([]pspi.Packet{{W: w, R: r}})
+}
+
+func (c *fakePortConn) TxPackets(ps []pspi.Packet) error {
+	c.p.packets = append(c.p.packets, ps)
+	for _, p := range ps {
+		copy(p.R, p.W)
+	}
+	return nil
+}
+
+func TestPlayback(t *testing.T) {
+	p := &spitest.Playback{
+		Playback: conntest.Playback{
+			Ops: []conntest.IO{
+				{W: []byte{0x9f, 0, 0}, R: []byte{0, 0xef, 0x40}},
+			},
+		},
+	}
+	dev, err := spi.Open(&Opener{Port: func(bus, chip int) (pspi.PortCloser, error) { return p, nil }}, 0, 0, spi.Mode0, 1000000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	rx := make([]byte, 3)
+	if err := dev.Transfer([]byte{0x9f, 0, 0}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if want := []byte{0, 0xef, 0x40}; !bytes.Equal(rx, want) {
+		t.Errorf("rx=% x, want % x", rx, want)
+	}
+	if err := dev.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	p := &fakePort{}
+	c := New(p)
+	configs := []struct{ k, v int }{
+		{driver.Mode, int(spi.Mode3 | spi.ThreeWire | spi.NoCS)},
+		{driver.Bits, 16},
+		{driver.Order, 1},
+		{driver.Speed, 2000000},
+	}
+	for _, cfg := range configs {
+		if err := c.Configure(cfg.k, cfg.v); err != nil {
+			t.Fatalf("Configure(%d, %d): %v", cfg.k, cfg.v, err)
+		}
+	}
+	if p.connects != 0 {
+		t.Errorf("port connected before the first transfer")
+	}
+	if p.limit != 2*physic.MegaHertz {
+		t.Errorf("speed limit=%v, want %v", p.limit, 2*physic.MegaHertz)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.Transfer([]byte{1, 2}, make([]byte, 2)); err != nil {
+			t.Fatalf("Transfer: %v", err)
+		}
+	}
+	if p.connects != 1 {
+		t.Errorf("port connected %d times, want 1", p.connects)
+	}
+	if want := pspi.Mode3 | pspi.HalfDuplex | pspi.NoCS | pspi.LSBFirst; p.mode != want {
+		t.Errorf("mode=%#x, want %#x", p.mode, want)
+	}
+	if p.bits != 16 {
+		t.Errorf("bits=%d, want 16", p.bits)
+	}
+
+	err := c.Configure(driver.Bits, 8)
+	var cerr *spi.ConfigError
+	if !errors.As(err, &cerr) || cerr.Err != errConnected {
+		t.Errorf("Configure(Bits) after connecting=%v, want %v", err, errConnected)
+	}
+	if err := c.Configure(driver.Speed, 1000000); err != nil {
+		t.Errorf("Configure(Speed) after connecting: %v", err)
+	}
+	if err := c.Configure(-1, 0); !errors.Is(err, spi.ErrUnknownKey) {
+		t.Errorf("Configure(-1, 0)=%v, want %v", err, spi.ErrUnknownKey)
+	}
+	if err := c.Close(); err != nil || !p.closed {
+		t.Errorf("Close()=%v, closed=%t, want nil, true", err, p.closed)
+	}
+}
+
+func TestTransferMany(t *testing.T) {
+	p := &fakePort{}
+	c := New(p)
+	msgs := []driver.Message{
+		{Tx: []byte{1}, Rx: make([]byte, 1), Bits: 9},
+		{Tx: []byte{2}, Rx: make([]byte, 1), CSChange: true},
+		{Tx: []byte{3}, Rx: make([]byte, 1)},
+	}
+	if err := c.TransferMany(msgs); err != nil {
+		t.Fatalf("TransferMany: %v", err)
+	}
+	if len(p.packets) != 1 {
+		t.Fatalf("got %d TxPackets calls, want 1", len(p.packets))
+	}
+	var keepCS []bool
+	for _, pk := range p.packets[0] {
+		keepCS = append(keepCS, pk.KeepCS)
+	}
+	if want := []bool{true, false, false}; !reflect.DeepEqual(keepCS, want) {
+		t.Errorf("KeepCS=%v, want %v", keepCS, want)
+	}
+	if bits := p.packets[0][0].BitsPerWord; bits != 9 {
+		t.Errorf("BitsPerWord=%d, want 9", bits)
+	}
+	for i, m := range msgs {
+		if !bytes.Equal(m.Rx, m.Tx) {
+			t.Errorf("message %d: rx=% x, want % x", i, m.Rx, m.Tx)
+		}
+	}
+	if err := c.TransferMany([]driver.Message{{Tx: []byte{1}, Rx: make([]byte, 1), Speed: 1000}}); err == nil {
+		t.Errorf("TransferMany with a message speed succeeded, want error")
+	}
+}
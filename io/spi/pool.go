@@ -0,0 +1,87 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool shares a device between goroutines. Each call to Do has the
+// exclusive use of the device while its function runs, and the calls
+// waiting for the device get it in the order they called Do, so that
+// a goroutine can't be overtaken indefinitely on a busy bus.
+type Pool struct {
+	d *Device
+
+	mu      sync.Mutex
+	busy    bool
+	waiters []chan struct{} // closed to hand the device over, in FIFO order
+}
+
+// NewPool returns a pool sharing d.
+func NewPool(d *Device) *Pool {
+	return &Pool{d: d}
+}
+
+// Do waits for the device to be free and calls f with it, returning
+// what f returns. The device must not be used after f returns. If ctx
+// is done before the device is free, Do returns ctx.Err() without
+// calling f.
+func (p *Pool) Do(ctx context.Context, f func(d *Device) error) error {
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	defer p.release()
+	return f(p.d)
+}
+
+func (p *Pool) acquire(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.busy {
+		p.busy = true
+		p.mu.Unlock()
+		return nil
+	}
+	c := make(chan struct{})
+	p.waiters = append(p.waiters, c)
+	p.mu.Unlock()
+
+	select {
+	case <-c:
+		return nil
+	case <-ctx.Done():
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, w := range p.waiters {
+		if w == c {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// The device was handed over while ctx was done;
+	// hand it over to the next one.
+	p.handOver()
+	return ctx.Err()
+}
+
+func (p *Pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handOver()
+}
+
+// handOver gives the device to the first waiter, if any,
+// or marks it free. p.mu must be held.
+func (p *Pool) handOver() {
+	if len(p.waiters) == 0 {
+		p.busy = false
+		return
+	}
+	c := p.waiters[0]
+	p.waiters = p.waiters[1:]
+	close(c)
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// waitWaiters waits for n calls of p.Do to be waiting.
+func waitWaiters(p *Pool, n int) {
+	for {
+		p.mu.Lock()
+		l := len(p.waiters)
+		p.mu.Unlock()
+		if l == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolExclusive(t *testing.T) {
+	c := &spitest.Conn{}
+	p := NewPool(&Device{conn: c})
+	var inUse int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := p.Do(context.Background(), func(d *Device) error {
+				if atomic.AddInt32(&inUse, 1) != 1 {
+					t.Errorf("device used by several goroutines")
+				}
+				defer atomic.AddInt32(&inUse, -1)
+				// Both transfers must be adjacent.
+				if err := d.Transfer([]byte{byte(i)}, nil); err != nil {
+					return err
+				}
+				return d.Transfer([]byte{byte(i)}, nil)
+			})
+			if err != nil {
+				t.Errorf("Do: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	ts := c.Transfers()
+	if len(ts) != 100 {
+		t.Fatalf("got %d transfers, want 100", len(ts))
+	}
+	for i := 0; i < len(ts); i += 2 {
+		if ts[i].Tx[0] != ts[i+1].Tx[0] {
+			t.Errorf("transfers %d and %d interleaved: %d, %d", i, i+1, ts[i].Tx[0], ts[i+1].Tx[0])
+		}
+	}
+}
+
+func TestPoolFIFO(t *testing.T) {
+	p := NewPool(&Device{conn: &spitest.Conn{}})
+	release := make(chan struct{})
+	held := make(chan struct{})
+	go p.Do(context.Background(), func(*Device) error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p.Do(context.Background(), func(*Device) error {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+				return nil
+			})
+		}(i)
+		waitWaiters(p, i+1)
+	}
+	close(release)
+	wg.Wait()
+	want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order=%v, want %v", order, want)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	p := NewPool(&Device{conn: &spitest.Conn{}})
+	release := make(chan struct{})
+	held := make(chan struct{})
+	go p.Do(context.Background(), func(*Device) error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.Do(ctx, func(*Device) error {
+			t.Errorf("canceled Do called f")
+			return nil
+		})
+	}()
+	waitWaiters(p, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Do=%v, want %v", err, context.Canceled)
+	}
+	waitWaiters(p, 0)
+
+	close(release)
+	if err := p.Do(context.Background(), func(*Device) error { return nil }); err != nil {
+		t.Errorf("Do after a cancellation: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReadWriter returns an io.ReadWriteCloser that transfers data with d.
+// Write performs a transfer of its data and discards the bytes read.
+// Read performs a transfer of zeros and returns the bytes read.
+// Closing the returned value closes d.
+//
+// SPI is a full-duplex bus: the device sends data while it receives
+// data, so reads and writes are not independent. Data sent by the
+// device during a Write is lost, and a Read writes zeros to the device.
+//
+// The returned value also implements io.ReaderFrom and io.WriterTo,
+// which io.Copy uses to transfer data by chunks of MaxTransferSize
+// bytes, or 4096 for the drivers without a limit. Since the device
+// never ends its data, WriteTo only returns when the writer fails.
+func (d *Device) ReadWriter() io.ReadWriteCloser {
+	return &readWriter{d: d}
+}
+
+type readWriter struct {
+	d *Device
+}
+
+func (rw *readWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := rw.d.Transfer(p, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (rw *readWriter) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := rw.d.Transfer(nil, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReadFrom writes the data of r to the device until io.EOF,
+// see WriteFrom.
+func (rw *readWriter) ReadFrom(r io.Reader) (int64, error) {
+	return rw.d.WriteFrom(r, rw.d.streamChunk())
+}
+
+// WriteTo writes the data read from the device to w until w fails.
+func (rw *readWriter) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, rw.d.streamChunk())
+	var written int64
+	for {
+		if err := rw.d.Transfer(nil, buf); err != nil {
+			return written, err
+		}
+		n, err := w.Write(buf)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+func (rw *readWriter) Close() error {
+	return rw.d.Close()
+}
+
+// WriteFrom writes the data of r to d until io.EOF, with write-only
+// transfers of pageSize bytes, for instance to program the pages of
+// a flash memory. The reads of r are retried until they fill a page,
+// and the last page may be shorter. It returns the number of bytes
+// written and the first error of r, other than io.EOF, or of the
+// transfers.
+func (d *Device) WriteFrom(r io.Reader, pageSize int) (int64, error) {
+	if pageSize <= 0 {
+		return 0, fmt.Errorf("invalid page size: %d", pageSize)
+	}
+	page := make([]byte, pageSize)
+	var written int64
+	for {
+		n, err := io.ReadFull(r, page)
+		if n > 0 {
+			if err := d.Transfer(page[:n], nil); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return written, nil
+		default:
+			return written, err
+		}
+	}
+}
+
+// BufReader returns an io.Reader reading the bytes sent by d, for the
+// devices streaming data. Each transfer writes chunk zeros and reads
+// chunk bytes, which are buffered for the next Reads, so that small
+// Reads don't cost a transfer each. Reads of at least chunk bytes with
+// an empty buffer read chunk bytes directly into p. If chunk is not
+// positive, it is the value of MaxTransferSize, or 4096 for the
+// drivers without a limit.
+//
+// The reader never returns io.EOF; it only returns the errors of the
+// transfers. A Read of zero bytes returns 0, nil without a transfer.
+func (d *Device) BufReader(chunk int) io.Reader {
+	if chunk <= 0 {
+		chunk = d.streamChunk()
+	}
+	return &bufReader{d: d, buf: make([]byte, chunk)}
+}
+
+type bufReader struct {
+	d    *Device
+	buf  []byte
+	r, w int // buf[r:w] is the buffered data
+}
+
+func (br *bufReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if br.r == br.w {
+		if len(p) >= len(br.buf) {
+			if err := br.d.Transfer(nil, p[:len(br.buf)]); err != nil {
+				return 0, err
+			}
+			return len(br.buf), nil
+		}
+		if err := br.d.Transfer(nil, br.buf); err != nil {
+			return 0, err
+		}
+		br.r, br.w = 0, len(br.buf)
+	}
+	n := copy(p, br.buf[br.r:br.w])
+	br.r += n
+	return n, nil
+}
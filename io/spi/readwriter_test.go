@@ -0,0 +1,186 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestReadWriter(t *testing.T) {
+	c := &spitest.Conn{}
+	rw := (&Device{conn: c}).ReadWriter()
+
+	if n, err := rw.Write([]byte("hello")); n != 5 || err != nil {
+		t.Fatalf("Write()=%d, %v, want 5, nil", n, err)
+	}
+	c.Respond([]byte("world"))
+	p := make([]byte, 5)
+	if n, err := rw.Read(p); n != 5 || err != nil {
+		t.Fatalf("Read()=%d, %v, want 5, nil", n, err)
+	}
+	if string(p) != "world" {
+		t.Errorf("Read got %q, want %q", p, "world")
+	}
+	if n, err := rw.Write(nil); n != 0 || err != nil {
+		t.Errorf("Write(nil)=%d, %v, want 0, nil", n, err)
+	}
+	if n, err := rw.Read(nil); n != 0 || err != nil {
+		t.Errorf("Read(nil)=%d, %v, want 0, nil", n, err)
+	}
+
+	ts := c.Transfers()
+	if len(ts) != 2 {
+		t.Fatalf("got %d transfers, want 2", len(ts))
+	}
+	if string(ts[0].Tx) != "hello" {
+		t.Errorf("Write transferred %q, want %q", ts[0].Tx, "hello")
+	}
+	if ts[0].Rx != nil {
+		t.Errorf("Write read to % x, want nil", ts[0].Rx)
+	}
+	// A nil Tx writes zeros.
+	if ts[1].Tx != nil {
+		t.Errorf("Read transferred % x, want nil", ts[1].Tx)
+	}
+
+	if err := rw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !c.Closed() {
+		t.Errorf("device not closed after Close")
+	}
+}
+
+func TestBufReader(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Respond([]byte("abcdefgh"), []byte("ijklmnop"))
+	r := (&Device{conn: c}).BufReader(8)
+	var got []byte
+	p := make([]byte, 4)
+	for len(got) < 12 {
+		n, err := r.Read(p)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		got = append(got, p[:n]...)
+	}
+	if string(got) != "abcdefghijkl" {
+		t.Errorf("read %q, want %q", got, "abcdefghijkl")
+	}
+	ts := c.Transfers()
+	if len(ts) != 2 {
+		t.Fatalf("got %d transfers for 12 bytes, want 2", len(ts))
+	}
+	for i, m := range ts {
+		if m.Tx != nil || len(m.Rx) != 8 {
+			t.Errorf("transfer %d: tx=% x, %d bytes read, want nil, 8", i, m.Tx, len(m.Rx))
+		}
+	}
+	if n, err := r.Read(nil); n != 0 || err != nil {
+		t.Errorf("Read(nil)=%d, %v, want 0, nil", n, err)
+	}
+
+	// The buffered "mnop" is returned before reading again.
+	c.Respond([]byte("qrstuvwx"))
+	big := make([]byte, 16)
+	if n, err := r.Read(big); n != 4 || err != nil || string(big[:n]) != "mnop" {
+		t.Errorf("Read()=%q, %v, want %q, nil", big[:n], err, "mnop")
+	}
+	if n, err := r.Read(big); n != 8 || err != nil || string(big[:n]) != "qrstuvwx" {
+		t.Errorf("Read()=%q, %v, want %q, nil", big[:n], err, "qrstuvwx")
+	}
+	if n := len(c.Transfers()); n != 3 {
+		t.Errorf("got %d transfers, want 3", n)
+	}
+}
+
+func TestWriteFrom(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	data := []byte("0123456789")
+	n, err := dev.WriteFrom(iotest.OneByteReader(bytes.NewReader(data)), 4)
+	if n != 10 || err != nil {
+		t.Fatalf("WriteFrom()=%d, %v, want 10, nil", n, err)
+	}
+	var got []string
+	for _, m := range c.Transfers() {
+		if m.Rx != nil {
+			t.Errorf("transfer of %q reads, want write-only", m.Tx)
+		}
+		got = append(got, string(m.Tx))
+	}
+	if want := []string{"0123", "4567", "89"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pages=%q, want %q", got, want)
+	}
+
+	errRead := errors.New("read error")
+	r := io.MultiReader(bytes.NewReader(data[:6]), iotest.ErrReader(errRead))
+	if n, err := dev.WriteFrom(r, 4); n != 6 || err != errRead {
+		t.Errorf("WriteFrom() with a read error=%d, %v, want 6, %v", n, err, errRead)
+	}
+	if _, err := dev.WriteFrom(bytes.NewReader(data), 0); err == nil {
+		t.Errorf("WriteFrom() with a zero page size succeeded, want error")
+	}
+}
+
+// stopWriter is a writer failing with errStop once it has n bytes.
+type stopWriter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+var errStop = errors.New("stop")
+
+func (w *stopWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	if w.buf.Len() >= w.n {
+		return len(p), errStop
+	}
+	return len(p), nil
+}
+
+func TestReadWriterCopy(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: sizedConn{c, 1000}}
+	rw := dev.ReadWriter()
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	// Hide the WriterTo of bytes.Reader, so that io.Copy uses ReadFrom.
+	n, err := io.Copy(rw, struct{ io.Reader }{bytes.NewReader(data)})
+	if n != int64(len(data)) || err != nil {
+		t.Fatalf("io.Copy(rw, data)=%d, %v, want %d, nil", n, err, len(data))
+	}
+	var got []byte
+	for _, m := range c.Transfers() {
+		got = append(got, m.Tx...)
+	}
+	if n := len(c.Transfers()); n != 10 {
+		t.Errorf("got %d transfers, want 10", n)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("io.Copy wrote other data than the source")
+	}
+
+	c = &spitest.Conn{}
+	dev.conn = sizedConn{c, 1000}
+	c.Respond(data[:1000], data[1000:2000], data[2000:3000])
+	w := &stopWriter{n: 2500}
+	if n, err := io.Copy(w, rw); n != 3000 || err != errStop {
+		t.Errorf("io.Copy(w, rw)=%d, %v, want 3000, %v", n, err, errStop)
+	}
+	if n := len(c.Transfers()); n != 3 {
+		t.Errorf("got %d transfers, want 3", n)
+	}
+	if !bytes.Equal(w.buf.Bytes(), data[:3000]) {
+		t.Errorf("io.Copy read other data than the device sent")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+// SetRegReadMask sets the bits ORed into the register address by ReadReg,
+// for the devices that tell reads from writes by a bit of the address,
+// e.g. 0x80 for the devices setting the MSB of the address to read.
+// The default is zero. It must not be called concurrently with the
+// register methods.
+func (d *Device) SetRegReadMask(mask byte) {
+	d.regReadMask = mask
+}
+
+// ReadReg reads n bytes from the register at addr by writing addr,
+// ORed with the mask set by SetRegReadMask, and then reading n bytes in
+// the same transaction, see WriteThenRead.
+func (d *Device) ReadReg(addr byte, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if err := d.WriteThenRead([]byte{addr | d.regReadMask}, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SetRegAutoIncrement sets the bits ORed into the register address by
+// ReadRegBurst to make the device increment the address after each byte,
+// e.g. 0x40 for many ST sensors. The default is zero, for the devices
+// that always increment the address. It must not be called concurrently
+// with the register methods.
+func (d *Device) SetRegAutoIncrement(flag byte) {
+	d.regAutoInc = flag
+}
+
+// ReadRegBurst reads the n registers starting at start with a single
+// transaction, by writing start ORed with the masks set by
+// SetRegReadMask and SetRegAutoIncrement and then reading n bytes.
+func (d *Device) ReadRegBurst(start byte, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if err := d.WriteThenRead([]byte{start | d.regReadMask | d.regAutoInc}, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WriteReg writes data to the register at addr by writing addr and
+// then data in the same transaction. The bytes read are discarded.
+func (d *Device) WriteReg(addr byte, data []byte) error {
+	return d.TxMany([]Message{{Tx: []byte{addr}, NoCSChange: true}, {Tx: data}})
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// fakeRegs emulates a device with 128 one byte registers, which are
+// read when the MSB of the address is set and written otherwise.
+// Transactions are made of an address message and a data message.
+type fakeRegs struct {
+	regs [128]byte
+	addr int // address of the transaction, or -1 between them
+
+	// autoInc, if non-zero, is the address flag incrementing the address
+	// after each byte read; reads without it repeat the same register.
+	// If zero, the address is always incremented.
+	autoInc int
+}
+
+func (f *fakeRegs) conn() *spitest.Conn {
+	f.addr = -1
+	return &spitest.Conn{Reply: f.reply}
+}
+
+func (f *fakeRegs) reply(tx []byte) []byte {
+	if f.addr < 0 {
+		f.addr = int(tx[0])
+		return nil
+	}
+	addr := f.addr &^ (0x80 | f.autoInc)
+	read := f.addr&0x80 != 0
+	inc := f.autoInc == 0 || f.addr&f.autoInc != 0
+	f.addr = -1
+	if read {
+		r := make([]byte, len(tx))
+		for i := range r {
+			r[i] = f.regs[addr]
+			if inc {
+				addr++
+			}
+		}
+		return r
+	}
+	copy(f.regs[addr:], tx)
+	return nil
+}
+
+func TestReadReg(t *testing.T) {
+	f := &fakeRegs{}
+	f.regs[0x0f] = 0x33
+	f.regs[0x10] = 0x44
+	dev := &Device{conn: f.conn()}
+	dev.SetRegReadMask(0x80)
+	b, err := dev.ReadReg(0x0f, 2)
+	if err != nil {
+		t.Fatalf("ReadReg: %v", err)
+	}
+	if want := []byte{0x33, 0x44}; !bytes.Equal(b, want) {
+		t.Errorf("ReadReg(0x0f, 2)=% x, want % x", b, want)
+	}
+}
+
+func TestWriteReg(t *testing.T) {
+	f := &fakeRegs{}
+	c := f.conn()
+	dev := &Device{conn: c}
+	dev.SetRegReadMask(0x80)
+	if err := dev.WriteReg(0x20, []byte{0x01, 0x02}); err != nil {
+		t.Fatalf("WriteReg: %v", err)
+	}
+	if got, want := f.regs[0x20:0x22], []byte{0x01, 0x02}; !bytes.Equal(got, want) {
+		t.Errorf("registers 0x20..0x21=% x, want % x", got, want)
+	}
+	for i, m := range c.Transfers() {
+		if m.CSChange {
+			t.Errorf("message %d has CSChange set, want the chip select held", i)
+		}
+	}
+	b, err := dev.ReadReg(0x20, 2)
+	if err != nil {
+		t.Fatalf("ReadReg: %v", err)
+	}
+	if want := []byte{0x01, 0x02}; !bytes.Equal(b, want) {
+		t.Errorf("ReadReg(0x20, 2) after WriteReg=% x, want % x", b, want)
+	}
+}
+
+func TestReadRegBurst(t *testing.T) {
+	f := &fakeRegs{autoInc: 0x40}
+	for i := range f.regs {
+		f.regs[i] = byte(i)
+	}
+	c := f.conn()
+	dev := &Device{conn: c}
+	dev.SetRegReadMask(0x80)
+	dev.SetRegAutoIncrement(0x40)
+	b, err := dev.ReadRegBurst(0x28, 6)
+	if err != nil {
+		t.Fatalf("ReadRegBurst: %v", err)
+	}
+	if want := []byte{0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d}; !bytes.Equal(b, want) {
+		t.Errorf("ReadRegBurst(0x28, 6)=% x, want % x", b, want)
+	}
+	ts := c.Transfers()
+	if len(ts) != 2 {
+		t.Fatalf("got %d messages, want 2", len(ts))
+	}
+	if want := []byte{0x28 | 0x80 | 0x40}; !bytes.Equal(ts[0].Tx, want) {
+		t.Errorf("address message Tx=% x, want % x", ts[0].Tx, want)
+	}
+
+	// Without the flag, the device repeats the register.
+	b, err = dev.ReadReg(0x28, 2)
+	if err != nil {
+		t.Fatalf("ReadReg: %v", err)
+	}
+	if want := []byte{0x28, 0x28}; !bytes.Equal(b, want) {
+		t.Errorf("ReadReg(0x28, 2)=% x, want % x", b, want)
+	}
+}
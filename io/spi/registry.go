@@ -0,0 +1,44 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"sync"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = make(map[string]driver.Opener)
+)
+
+func init() {
+	Register("spidev", &DevFS{})
+}
+
+// Register makes the driver o available under the scheme of the
+// connection strings of OpenString. It is meant to be called from the
+// init function of the packages providing drivers. Register panics if
+// it is called twice with the same scheme or if o is nil.
+func Register(scheme string, o driver.Opener) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	if o == nil {
+		panic("spi: Register driver is nil")
+	}
+	if _, dup := schemes[scheme]; dup {
+		panic("spi: Register called twice for scheme " + scheme)
+	}
+	schemes[scheme] = o
+}
+
+// lookup returns the driver registered under scheme.
+func lookup(scheme string) (driver.Opener, bool) {
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+	o, ok := schemes[scheme]
+	return o, ok
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// unregister removes the driver registered under scheme, if any.
+func unregister(scheme string) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	delete(schemes, scheme)
+}
+
+func TestRegister(t *testing.T) {
+	if o, ok := lookup("spidev"); !ok {
+		t.Errorf("spidev is not registered")
+	} else if _, ok := o.(*DevFS); !ok {
+		t.Errorf("spidev driver=%T, want *DevFS", o)
+	}
+
+	c := &spitest.Conn{}
+	Register("test", c)
+	defer unregister("test")
+	if o, ok := lookup("test"); !ok || o != c {
+		t.Errorf("lookup(test)=%v, %t, want the registered driver", o, ok)
+	}
+	if o, ok := lookup("unregistered"); ok {
+		t.Errorf("lookup(unregistered)=%v, %t, want nil, false", o, ok)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	Register("test", &spitest.Conn{})
+	defer unregister("test")
+
+	tests := []struct {
+		name   string
+		scheme string
+		o      driver.Opener
+	}{
+		{"duplicate scheme", "test", &spitest.Conn{}},
+		{"nil driver", "other", nil},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register with a %s did not panic", test.name)
+				}
+			}()
+			Register(test.scheme, test.o)
+		}()
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// Opener is an SPI driver opening the devices of a server.
+// Each device uses its own network connection.
+type Opener struct {
+	// Addr is the TCP address of the server, e.g. "raspberrypi:7070".
+	Addr string
+
+	// Dial, if non-nil, connects to the server instead of
+	// dialing Addr with TCP.
+	Dial func() (io.ReadWriteCloser, error)
+}
+
+// Open connects to the server, which opens the device of bus and chip.
+func (o *Opener) Open(bus, chip int) (driver.Conn, error) {
+	var rwc io.ReadWriteCloser
+	var err error
+	if o.Dial != nil {
+		rwc, err = o.Dial()
+	} else {
+		rwc, err = net.Dial("tcp", o.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{rwc: rwc}
+	var e encoder
+	e.byte(opOpen)
+	e.int(bus)
+	e.int(chip)
+	if _, err := c.call(e.b); err != nil {
+		rwc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+type conn struct {
+	// mu serializes the requests.
+	mu  sync.Mutex
+	rwc io.ReadWriteCloser
+}
+
+// call sends the request req and returns the decoder of the results
+// of the response, or the error of the response.
+func (c *conn) call(req []byte) (*decoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := writeFrame(c.rwc, req); err != nil {
+		return nil, err
+	}
+	resp, err := readFrame(c.rwc)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{b: resp}
+	err = d.error()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (c *conn) Configure(k, v int) error {
+	var e encoder
+	e.byte(opConfigure)
+	e.int(k)
+	e.int(v)
+	d, err := c.call(e.b)
+	if err != nil {
+		return err
+	}
+	return d.done()
+}
+
+func (c *conn) Query(k int) (int, error) {
+	var e encoder
+	e.byte(opQuery)
+	e.int(k)
+	d, err := c.call(e.b)
+	if err != nil {
+		return 0, err
+	}
+	v := d.int()
+	if err := d.done(); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// Transfer sends tx to the server, which performs the transfer with
+// Transfer, so that its driver can split large transfers, and copies
+// the data read to rx.
+func (c *conn) Transfer(tx, rx []byte) error {
+	var e encoder
+	e.byte(opTransfer)
+	e.bytes(tx)
+	e.rx(rx)
+	d, err := c.call(e.b)
+	if err != nil {
+		return err
+	}
+	got := d.bytes()
+	if d.err == nil && len(got) != len(rx) {
+		return fmt.Errorf("got %d bytes, want %d", len(got), len(rx))
+	}
+	copy(rx, got)
+	return d.done()
+}
+
+// TransferMany sends the messages to the server, which performs them
+// as a single transaction, and copies the data read to their Rx.
+func (c *conn) TransferMany(msgs []driver.Message) error {
+	var e encoder
+	e.byte(opTransferMany)
+	e.int(len(msgs))
+	for _, m := range msgs {
+		e.message(m)
+	}
+	d, err := c.call(e.b)
+	if err != nil {
+		return err
+	}
+	for i, m := range msgs {
+		rx := d.bytes()
+		if d.err == nil && len(rx) != len(m.Rx) {
+			return fmt.Errorf("message %d: got %d bytes, want %d", i, len(rx), len(m.Rx))
+		}
+		copy(m.Rx, rx)
+	}
+	return d.done()
+}
+
+// Close closes the device and the connection to the server.
+func (c *conn) Close() error {
+	var e encoder
+	e.byte(opClose)
+	_, err := c.call(e.b)
+	if cerr := c.rwc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,368 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package remote provides an SPI driver forwarding the configuration
+// and the transfers of the devices over a network connection to a
+// server, which performs them with another driver, typically DevFS
+// on the board the devices are attached to.
+//
+// The client and the server exchange frames made of a 32-bit big-endian
+// length followed by that many bytes. A request frame starts with an
+// operation byte followed by its arguments; the response frame starts
+// with an error, empty if the request succeeded, followed by the
+// results. An error is its message followed by its kind, so that the
+// client rebuilds the errors of package spi and the common errnos,
+// which errors.Is and errors.As match as on the server. Integers are
+// 64-bit big-endian and byte slices are encoded as their length, -1 for
+// nil, followed by their bytes.
+package remote // import "golang.org/x/exp/io/spi/remote"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/io/spi"
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// Operations of the requests.
+const (
+	opOpen         = 1 // bus, chip
+	opConfigure    = 2 // key, value
+	opQuery        = 3 // key; returns the value
+	opTransferMany = 4 // messages; returns the rx of each message
+	opClose        = 5
+	opTransfer     = 6 // tx, length of rx; returns rx
+)
+
+// maxFrame is the maximum length of a frame.
+const maxFrame = 1 << 24
+
+var errFrameTooLarge = errors.New("frame too large")
+
+// readFrame reads a frame from r.
+func readFrame(r io.Reader) ([]byte, error) {
+	var h [4]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(h[:])
+	if n > maxFrame {
+		return nil, errFrameTooLarge
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeFrame writes b to w as a frame.
+func writeFrame(w io.Writer, b []byte) error {
+	if len(b) > maxFrame {
+		return errFrameTooLarge
+	}
+	f := make([]byte, 4+len(b))
+	binary.BigEndian.PutUint32(f, uint32(len(b)))
+	copy(f[4:], b)
+	_, err := w.Write(f)
+	return err
+}
+
+// encoder appends the fields of a frame to b.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) byte(v byte) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) int(v int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.b = append(e.b, b[:]...)
+}
+
+func (e *encoder) bytes(v []byte) {
+	if v == nil {
+		e.int(-1)
+		return
+	}
+	e.int(len(v))
+	e.b = append(e.b, v...)
+}
+
+// Kinds of the errors.
+const (
+	errText        = 0 // only the message
+	errConfig      = 1 // key, value, error; a *spi.ConfigError
+	errUnsupported = 2 // feature, error; a *spi.UnsupportedError
+	errErrno       = 3 // index in errnos
+	errSentinel    = 4 // index in sentinels
+)
+
+// errnos and sentinels are the errors sent by their index, since the
+// numbers of the errnos depend on the system. The errors matching them
+// with errors.Is are rebuilt wrapping them.
+var (
+	errnos = []syscall.Errno{
+		syscall.EAGAIN,
+		syscall.EBUSY,
+		syscall.EINVAL,
+		syscall.ENOTTY,
+		syscall.EMSGSIZE,
+		syscall.EIO,
+		syscall.ENODEV,
+		syscall.ENOENT,
+		syscall.ENXIO,
+		syscall.EPERM,
+		syscall.EACCES,
+		syscall.ETIMEDOUT,
+		syscall.EINTR,
+		syscall.ENOMEM,
+	}
+	sentinels = []error{
+		spi.ErrUnknownKey,
+		spi.ErrTimeout,
+		spi.ErrUnsupportedPlatform,
+		spi.ErrClosed,
+		spi.ErrCRCMismatch,
+		spi.ErrInvalidMode,
+		spi.ErrUnsupported,
+	}
+)
+
+func (e *encoder) error(err error) {
+	if err == nil {
+		e.bytes(nil)
+		return
+	}
+	e.bytes([]byte(err.Error()))
+	switch err := err.(type) {
+	case *spi.ConfigError:
+		e.byte(errConfig)
+		e.int(err.Key)
+		e.int(err.Value)
+		e.error(err.Err)
+		return
+	case *spi.UnsupportedError:
+		e.byte(errUnsupported)
+		e.bytes([]byte(err.Feature))
+		e.error(err.Err)
+		return
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		for i, n := range errnos {
+			if n == errno {
+				e.byte(errErrno)
+				e.int(i)
+				return
+			}
+		}
+	}
+	for i, s := range sentinels {
+		if errors.Is(err, s) {
+			e.byte(errSentinel)
+			e.int(i)
+			return
+		}
+	}
+	e.byte(errText)
+}
+
+// rx appends the length of rx, -1 if it is nil,
+// since only the length of an rx buffer is sent.
+func (e *encoder) rx(rx []byte) {
+	if rx == nil {
+		e.int(-1)
+		return
+	}
+	e.int(len(rx))
+}
+
+func (e *encoder) message(m driver.Message) {
+	e.bytes(m.Tx)
+	e.rx(m.Rx)
+	e.int(m.Speed)
+	e.int(m.Bits)
+	e.int(int(m.Delay))
+	e.int(m.TxNBits)
+	e.int(m.RxNBits)
+	var flags byte
+	if m.CSChange {
+		flags |= 1
+	}
+	if m.NoCSChange {
+		flags |= 2
+	}
+	e.byte(flags)
+}
+
+// decoder reads the fields of a frame from b.
+// After an error, all fields are zero.
+type decoder struct {
+	b   []byte
+	err error
+
+	// rxTotal is the total length of the rx buffers of the frame
+	// in the response, with their lengths, which must fit in it.
+	rxTotal int
+}
+
+var errShortFrame = errors.New("short frame")
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errShortFrame
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) int() int {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int(int64(binary.BigEndian.Uint64(b)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int()
+	if n < 0 {
+		return nil
+	}
+	b := d.next(n)
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+var errUnknownError = errors.New("unknown error")
+
+func (d *decoder) error() error {
+	b := d.bytes()
+	if b == nil {
+		return nil
+	}
+	msg := string(b)
+	var target error
+	switch d.byte() {
+	case errText:
+		return errors.New(msg)
+	case errConfig:
+		k, v := d.int(), d.int()
+		return &spi.ConfigError{Key: k, Value: v, Err: d.error()}
+	case errUnsupported:
+		f := string(d.bytes())
+		return &spi.UnsupportedError{Feature: f, Err: d.error()}
+	case errErrno:
+		if i := d.int(); i >= 0 && i < len(errnos) {
+			target = errnos[i]
+		}
+	case errSentinel:
+		if i := d.int(); i >= 0 && i < len(sentinels) {
+			target = sentinels[i]
+		}
+	}
+	if d.err != nil {
+		return nil
+	}
+	if target == nil {
+		d.err = errUnknownError
+		return nil
+	}
+	if target.Error() == msg {
+		return target
+	}
+	return &remoteError{msg: msg, err: target}
+}
+
+// remoteError is an error of the server with the message msg,
+// wrapping the error err that it matched on the server.
+type remoteError struct {
+	msg string
+	err error
+}
+
+func (e *remoteError) Error() string {
+	return e.msg
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
+
+// rx returns a buffer of the length decoded by the rx of the encoder,
+// or nil. The frame is too large if the response, its empty error and
+// the rx buffers of all its messages with their lengths, doesn't fit
+// in a frame, so that a small request can't allocate more and the
+// server can send the response.
+func (d *decoder) rx() []byte {
+	n := d.int()
+	if d.err != nil {
+		return nil
+	}
+	if n > maxFrame-emptyErrorLen-d.rxTotal-lenLen {
+		d.err = errFrameTooLarge
+		return nil
+	}
+	d.rxTotal += lenLen
+	if n < 0 {
+		return nil
+	}
+	d.rxTotal += n
+	return make([]byte, n)
+}
+
+// lenLen is the length of the length of a byte slice, and emptyErrorLen
+// the length of a nil error, which are both encoded as an integer.
+const (
+	lenLen        = 8
+	emptyErrorLen = lenLen
+)
+
+func (d *decoder) message() driver.Message {
+	var m driver.Message
+	m.Tx = d.bytes()
+	m.Rx = d.rx()
+	m.Speed = d.int()
+	m.Bits = d.int()
+	m.Delay = time.Duration(d.int())
+	m.TxNBits = d.int()
+	m.RxNBits = d.int()
+	flags := d.byte()
+	m.CSChange = flags&1 != 0
+	m.NoCSChange = flags&2 != 0
+	return m
+}
+
+// done returns the decoding error, if any, or
+// an error if there are bytes left in the frame.
+func (d *decoder) done() error {
+	if d.err == nil && len(d.b) > 0 {
+		d.err = fmt.Errorf("%d unexpected bytes at the end of the frame", len(d.b))
+	}
+	return d.err
+}
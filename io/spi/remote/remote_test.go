@@ -0,0 +1,353 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/io/spi"
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// pipeOpener returns an Opener connected to a server of backend
+// over an in-process pipe, and a channel receiving the result
+// of ServeConn.
+func pipeOpener(backend driver.Opener) (*Opener, <-chan error) {
+	done := make(chan error, 1)
+	o := &Opener{
+		Dial: func() (io.ReadWriteCloser, error) {
+			cc, sc := net.Pipe()
+			s := &Server{Opener: backend}
+			go func() { done <- s.ServeConn(sc) }()
+			return cc, nil
+		},
+	}
+	return o, done
+}
+
+func TestRemote(t *testing.T) {
+	backend := &spitest.Conn{}
+	backend.Respond([]byte{0xef, 0x40}, []byte{1}, nil)
+	o, done := pipeOpener(backend)
+	dev, err := spi.Open(o, 1, 2, spi.Mode3, 1000000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if bus, chip := backend.Bus(); bus != 1 || chip != 2 {
+		t.Errorf("server opened %d.%d, want 1.2", bus, chip)
+	}
+	if err := dev.SetBitsPerWord(16); err != nil {
+		t.Fatalf("SetBitsPerWord: %v", err)
+	}
+	if m, err := dev.Mode(); err != nil || m != spi.Mode3 {
+		t.Errorf("Mode()=%v, %v, want %v, nil", m, err, spi.Mode3)
+	}
+	want := []spitest.Config{
+		{Key: driver.Mode, Value: 3},
+		{Key: driver.Speed, Value: 1000000},
+		{Key: driver.Bits, Value: 16},
+	}
+	if got := backend.Configs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("server configs=%v, want %v", got, want)
+	}
+
+	rx := make([]byte, 2)
+	if err := dev.Transfer([]byte{0x9f, 0}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if want := []byte{0xef, 0x40}; !bytes.Equal(rx, want) {
+		t.Errorf("rx=% x, want % x", rx, want)
+	}
+	msgs := []spi.Message{
+		{Rx: make([]byte, 1), Speed: 500000, Delay: time.Millisecond, CSChange: true},
+		{Tx: []byte{3, 4}, NoCSChange: true},
+	}
+	if err := dev.TxMany(msgs); err != nil {
+		t.Fatalf("TxMany: %v", err)
+	}
+	if want := []byte{1}; !bytes.Equal(msgs[0].Rx, want) {
+		t.Errorf("message 0 rx=% x, want % x", msgs[0].Rx, want)
+	}
+	ts := backend.Transfers()
+	if len(ts) != 3 {
+		t.Fatalf("server got %d messages, want 3", len(ts))
+	}
+	if m := ts[1]; m.Tx != nil || m.Speed != 500000 || m.Delay != time.Millisecond || !m.CSChange {
+		t.Errorf("server message 1=%+v, want the fields of the message", m)
+	}
+	if m := ts[2]; !bytes.Equal(m.Tx, []byte{3, 4}) || m.Rx != nil || !m.NoCSChange {
+		t.Errorf("server message 2=%+v, want Tx 03 04, a nil Rx and NoCSChange", m)
+	}
+
+	if err := dev.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if !backend.Closed() {
+		t.Errorf("server device not closed")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ServeConn: %v", err)
+	}
+}
+
+func TestRemoteErrors(t *testing.T) {
+	errBits := errors.New("bits rejected")
+	backend := &spitest.Conn{
+		ConfigureError: func(k, v int) error {
+			if k == driver.Bits {
+				return errBits
+			}
+			return nil
+		},
+		TransferError: func(driver.Message) error { return errors.New("bus error") },
+	}
+	o, done := pipeOpener(backend)
+	c, err := o.Open(0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := c.Configure(driver.Bits, 9); err == nil || err.Error() != errBits.Error() {
+		t.Errorf("Configure(Bits, 9)=%v, want %v", err, errBits)
+	}
+	if err := c.Transfer([]byte{1}, make([]byte, 1)); err == nil || err.Error() != "bus error" {
+		t.Errorf("Transfer()=%v, want bus error", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ServeConn: %v", err)
+	}
+
+	// A failed open on the server fails Open and closes the connection.
+	errOpen := errors.New("no such device")
+	o, done = pipeOpener(failOpener{errOpen})
+	if _, err := o.Open(0, 0); err == nil || err.Error() != errOpen.Error() {
+		t.Errorf("Open()=%v, want %v", err, errOpen)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ServeConn: %v", err)
+	}
+}
+
+// transferOnlyConn is a connection whose TransferMany fails, like the
+// drivers that can only perform large transfers with Transfer.
+type transferOnlyConn struct {
+	*spitest.Conn
+}
+
+func (c transferOnlyConn) Open(bus, chip int) (driver.Conn, error) {
+	if _, err := c.Conn.Open(bus, chip); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c transferOnlyConn) TransferMany(msgs []driver.Message) error {
+	return errors.New("TransferMany called")
+}
+
+func TestRemoteTransfer(t *testing.T) {
+	backend := transferOnlyConn{&spitest.Conn{}}
+	backend.Respond([]byte{1, 2, 3}, nil)
+	o, done := pipeOpener(backend)
+	c, err := o.Open(0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	rx := make([]byte, 3)
+	if err := c.Transfer([]byte{4, 5, 6}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if want := []byte{1, 2, 3}; !bytes.Equal(rx, want) {
+		t.Errorf("rx=% x, want % x", rx, want)
+	}
+	if err := c.Transfer(nil, make([]byte, 2)); err != nil {
+		t.Fatalf("Transfer with a nil tx: %v", err)
+	}
+	if err := c.Transfer([]byte{7}, nil); err != nil {
+		t.Fatalf("Transfer with a nil rx: %v", err)
+	}
+	ts := backend.Transfers()
+	if len(ts) != 3 || ts[1].Tx != nil || len(ts[1].Rx) != 2 || ts[2].Rx != nil {
+		t.Errorf("server transfers=%+v, want the nil buffers of the transfers", ts)
+	}
+	// The response of the largest transfer is a full frame.
+	if err := c.Transfer(nil, make([]byte, maxFrame-2*8)); err != nil {
+		t.Fatalf("Transfer of a full frame: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ServeConn: %v", err)
+	}
+}
+
+func TestErrorEncoding(t *testing.T) {
+	tests := []struct {
+		err  error
+		is   []error
+		same bool // whether the decoded error is err itself
+	}{
+		{err: syscall.EBUSY, is: []error{syscall.EBUSY}, same: true},
+		{err: fmt.Errorf("message 1: %w", syscall.EAGAIN), is: []error{syscall.EAGAIN}},
+		{err: fmt.Errorf("%w: 99", spi.ErrUnknownKey), is: []error{spi.ErrUnknownKey}},
+		{err: spi.ErrClosed, is: []error{spi.ErrClosed}, same: true},
+		{
+			err: &spi.ConfigError{Key: driver.Mode, Value: 0x20, Err: &spi.UnsupportedError{Feature: "mode", Err: syscall.ENOTTY}},
+			is:  []error{spi.ErrUnsupported, syscall.ENOTTY},
+		},
+		{err: &spi.ConfigError{Key: driver.Mode, Value: 0x100, Err: spi.ErrInvalidMode}, is: []error{spi.ErrInvalidMode}},
+		{err: errors.New("bus error")},
+	}
+	for _, test := range tests {
+		var e encoder
+		e.error(test.err)
+		d := &decoder{b: e.b}
+		got := d.error()
+		if err := d.done(); err != nil {
+			t.Errorf("decoding %v: %v", test.err, err)
+			continue
+		}
+		if got == nil || got.Error() != test.err.Error() {
+			t.Errorf("decoded %v, want %v", got, test.err)
+			continue
+		}
+		for _, target := range test.is {
+			if !errors.Is(got, target) {
+				t.Errorf("decoded %v doesn't match %v", got, target)
+			}
+		}
+		if test.same && got != test.err {
+			t.Errorf("decoded %#v, want %#v", got, test.err)
+		}
+		var ce *spi.ConfigError
+		if errors.As(test.err, &ce) {
+			var gce *spi.ConfigError
+			if !errors.As(got, &gce) || gce.Key != ce.Key || gce.Value != ce.Value {
+				t.Errorf("decoded %#v, want a ConfigError of key %d and value %d", got, ce.Key, ce.Value)
+			}
+		}
+	}
+
+	var e encoder
+	e.bytes([]byte("x"))
+	e.byte(errSentinel)
+	e.int(99)
+	d := &decoder{b: e.b}
+	if err := d.error(); err != nil || d.err != errUnknownError {
+		t.Errorf("decoding an unknown sentinel=%v, %v, want nil, %v", err, d.err, errUnknownError)
+	}
+}
+
+func TestRemoteRetry(t *testing.T) {
+	// The errnos of the server match on the client, so SetRetry works.
+	busy := 1
+	backend := &spitest.Conn{
+		TransferError: func(driver.Message) error {
+			if busy > 0 {
+				busy--
+				return syscall.EBUSY
+			}
+			return nil
+		},
+	}
+	o, done := pipeOpener(backend)
+	dev, err := spi.Open(o, 0, 0, spi.Mode0, 1000000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	dev.SetRetry(1, time.Microsecond)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Errorf("Transfer: %v", err)
+	}
+	if s := dev.Stats(); s.Retries != 1 {
+		t.Errorf("Stats().Retries=%d, want 1", s.Retries)
+	}
+	if err := dev.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ServeConn: %v", err)
+	}
+}
+
+type failOpener struct {
+	err error
+}
+
+func (o failOpener) Open(bus, chip int) (driver.Conn, error) {
+	return nil, o.err
+}
+
+func TestServeConnNotOpen(t *testing.T) {
+	cc, sc := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- (&Server{Opener: &spitest.Conn{}}).ServeConn(sc) }()
+	c := &conn{rwc: cc}
+	if err := c.Configure(driver.Mode, 0); err == nil || err.Error() != errNotOpen.Error() {
+		t.Errorf("Configure before Open=%v, want %v", err, errNotOpen)
+	}
+	cc.Close()
+	if err := <-done; err != nil {
+		t.Errorf("ServeConn: %v", err)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	var e encoder
+	e.int(5)
+	e.byte(1)
+	d := &decoder{b: e.b}
+	if b := d.bytes(); b != nil || d.err != errShortFrame {
+		t.Errorf("bytes() of a short frame=% x, %v, want nil, %v", b, d.err, errShortFrame)
+	}
+	// The rx buffers of a frame must fit in a frame together.
+	e = encoder{}
+	e.int(maxFrame / 2)
+	e.int(maxFrame/2 + 1)
+	d = &decoder{b: e.b}
+	if rx := d.rx(); len(rx) != maxFrame/2 || d.err != nil {
+		t.Errorf("rx() of half a frame=%d bytes, %v, want %d bytes", len(rx), d.err, maxFrame/2)
+	}
+	if rx := d.rx(); rx != nil || d.err != errFrameTooLarge {
+		t.Errorf("rx() past a frame=%d bytes, %v, want nil, %v", len(rx), d.err, errFrameTooLarge)
+	}
+	// The response holds an empty error and the length of each buffer,
+	// even a nil one.
+	const most = maxFrame - 2*8
+	e = encoder{}
+	e.int(most)
+	e.int(-1)
+	d = &decoder{b: e.b}
+	if rx := d.rx(); len(rx) != most || d.err != nil {
+		t.Errorf("rx() of a full response=%d bytes, %v, want %d bytes", len(rx), d.err, most)
+	}
+	if rx := d.rx(); rx != nil || d.err != errFrameTooLarge {
+		t.Errorf("nil rx() past a full response=%v, want %v", d.err, errFrameTooLarge)
+	}
+	e = encoder{}
+	e.int(most + 1)
+	d = &decoder{b: e.b}
+	if rx := d.rx(); rx != nil || d.err != errFrameTooLarge {
+		t.Errorf("rx() past a response=%d bytes, %v, want nil, %v", len(rx), d.err, errFrameTooLarge)
+	}
+
+	d = &decoder{b: []byte{1, 2}}
+	d.byte()
+	if err := d.done(); err == nil {
+		t.Errorf("done() with bytes left succeeded, want error")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/exp/io/spi"
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// Server serves the devices of a driver to the clients using Opener.
+type Server struct {
+	// Opener opens the devices requested by the clients.
+	// If nil, DevFS is used.
+	Opener driver.Opener
+}
+
+// Serve accepts the connections of l and serves each of them on its
+// own goroutine with ServeConn. It returns the error of Accept.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+var errNotOpen = errors.New("device not open")
+
+// ServeConn serves the requests of a client over rwc until the client
+// closes the device or the connection, and then closes rwc. The device
+// is closed if the client didn't close it.
+func (s *Server) ServeConn(rwc io.ReadWriteCloser) error {
+	defer rwc.Close()
+	o := s.Opener
+	if o == nil {
+		o = &spi.DevFS{}
+	}
+	var c driver.Conn
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+	for {
+		req, err := readFrame(rwc)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		d := &decoder{b: req}
+		op := d.byte()
+		var resp encoder
+		switch {
+		case op == opOpen:
+			bus, chip := d.int(), d.int()
+			if err := d.done(); err != nil {
+				return err
+			}
+			if c != nil {
+				resp.error(errors.New("device already open"))
+				break
+			}
+			c, err = o.Open(bus, chip)
+			resp.error(err)
+		case c == nil:
+			resp.error(errNotOpen)
+		case op == opConfigure:
+			k, v := d.int(), d.int()
+			if err := d.done(); err != nil {
+				return err
+			}
+			resp.error(c.Configure(k, v))
+		case op == opQuery:
+			k := d.int()
+			if err := d.done(); err != nil {
+				return err
+			}
+			v, err := c.Query(k)
+			resp.error(err)
+			resp.int(v)
+		case op == opTransfer:
+			tx, rx := d.bytes(), d.rx()
+			if err := d.done(); err != nil {
+				return err
+			}
+			if err := c.Transfer(tx, rx); err != nil {
+				resp.error(err)
+				break
+			}
+			resp.error(nil)
+			resp.bytes(rx)
+		case op == opTransferMany:
+			n := d.int()
+			if n < 0 || n > len(d.b) {
+				return errShortFrame
+			}
+			msgs := make([]driver.Message, n)
+			for i := range msgs {
+				msgs[i] = d.message()
+			}
+			if err := d.done(); err != nil {
+				return err
+			}
+			if err := c.TransferMany(msgs); err != nil {
+				resp.error(err)
+				break
+			}
+			resp.error(nil)
+			for _, m := range msgs {
+				resp.bytes(m.Rx)
+			}
+		case op == opClose:
+			err := c.Close()
+			c = nil
+			resp.error(err)
+			if err := writeFrame(rwc, resp.b); err != nil {
+				return err
+			}
+			return nil
+		default:
+			return fmt.Errorf("unknown operation %d", op)
+		}
+		if err := writeFrame(rwc, resp.b); err != nil {
+			return err
+		}
+	}
+}
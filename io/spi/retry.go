@@ -0,0 +1,46 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// SetRetry sets the number of times n a transfer that failed with
+// syscall.EAGAIN or syscall.EBUSY is retried, for instance when another
+// process briefly holds the bus. The first retry waits for backoff,
+// and each following one waits twice as long as the previous one. The
+// error of the last attempt is returned if they all fail. Zero, the
+// default, disables the retries. It must not be called concurrently
+// with transfers.
+//
+// A transfer is retried as a whole, so with DevFS a Transfer larger
+// than the bufsiz limit of the kernel driver may write its first
+// parts again.
+func (d *Device) SetRetry(n int, backoff time.Duration) {
+	d.retries = n
+	d.retryBackoff = backoff
+}
+
+// retry calls f until it succeeds, fails with an error other than
+// EAGAIN and EBUSY, or the retries set with SetRetry are exhausted.
+func (d *Device) retry(f func() error) error {
+	err := f()
+	wait := d.retryBackoff
+	for i := 0; i < d.retries && retryable(err); i++ {
+		time.Sleep(wait)
+		wait *= 2
+		d.stats.retries.Add(1)
+		err = f()
+	}
+	return err
+}
+
+// retryable reports whether err is a transient error of the bus.
+func retryable(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EBUSY)
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// failingConn returns a connection whose first n transfers fail with err.
+func failingConn(n int, err error) (*spitest.Conn, *int) {
+	calls := 0
+	c := &spitest.Conn{
+		TransferError: func(driver.Message) error {
+			calls++
+			if calls <= n {
+				return err
+			}
+			return nil
+		},
+	}
+	return c, &calls
+}
+
+func TestSetRetry(t *testing.T) {
+	c, calls := failingConn(2, syscall.EBUSY)
+	dev := &Device{conn: c}
+	dev.SetRetry(3, time.Microsecond)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("got %d attempts, want 3", *calls)
+	}
+	if s := dev.Stats(); s.Retries != 2 || s.Transfers != 1 || s.Errors != 0 {
+		t.Errorf("Stats()=%+v, want 2 retries of 1 successful transfer", s)
+	}
+
+	// TxMany is retried as well.
+	c, calls = failingConn(1, syscall.EAGAIN)
+	dev = &Device{conn: c}
+	dev.SetRetry(1, time.Microsecond)
+	if err := dev.TxMany([]Message{{Tx: []byte{1}}}); err != nil {
+		t.Fatalf("TxMany: %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("got %d TxMany attempts, want 2", *calls)
+	}
+}
+
+func TestSetRetryExhausted(t *testing.T) {
+	c, calls := failingConn(10, syscall.EBUSY)
+	dev := &Device{conn: c}
+	dev.SetRetry(2, time.Microsecond)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != syscall.EBUSY {
+		t.Errorf("Transfer()=%v, want %v", err, syscall.EBUSY)
+	}
+	if *calls != 3 {
+		t.Errorf("got %d attempts, want 3", *calls)
+	}
+}
+
+func TestSetRetryOff(t *testing.T) {
+	// Retries are off by default and other errors aren't retried.
+	c, calls := failingConn(1, syscall.EBUSY)
+	dev := &Device{conn: c}
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != syscall.EBUSY {
+		t.Errorf("Transfer()=%v, want %v", err, syscall.EBUSY)
+	}
+	if *calls != 1 {
+		t.Errorf("got %d attempts, want 1", *calls)
+	}
+
+	c, calls = failingConn(1, syscall.EINVAL)
+	dev = &Device{conn: c}
+	dev.SetRetry(3, time.Microsecond)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != syscall.EINVAL {
+		t.Errorf("Transfer()=%v, want %v", err, syscall.EINVAL)
+	}
+	if *calls != 1 {
+		t.Errorf("got %d attempts, want 1", *calls)
+	}
+}
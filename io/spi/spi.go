@@ -3,9 +3,23 @@
 // license that can be found in the LICENSE file.
 
 // Package spi allows users to read from and write to an SPI device.
+//
+// The DevFS and BCM2835 drivers are only available on Linux.
+// macOS doesn't expose SPI controllers to user space; there, devices can
+// be driven through a USB bridge with the FTDI driver, or through a Linux
+// host with the drivers of package golang.org/x/exp/io/spi/remote.
 package spi // import "golang.org/x/exp/io/spi"
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/exp/io/spi/driver"
@@ -22,56 +36,699 @@ const (
 	Mode3 = Mode(3)
 )
 
+// Mode flags, which can be combined with the modes above,
+// e.g. Mode3 | CSHigh.
+const (
+	// CSHigh makes the chip select active high.
+	CSHigh = Mode(0x04)
+	// ThreeWire shares a single bidirectional data line
+	// between the master and the slave.
+	ThreeWire = Mode(0x10)
+	// Loop connects the data output of the controller to its input,
+	// so that transfers read the bytes they write.
+	Loop = Mode(0x20)
+	// NoCS disables the chip select of the controller,
+	// for buses with an externally managed chip select.
+	NoCS = Mode(0x40)
+	// Ready lets the slave pause the transfers with a READY line.
+	Ready = Mode(0x80)
+)
+
 // Order is the bit justification to be used while transfering
 // words to the SPI device. MSB-first encoding is more popular
 // than LSB-first.
 type Order int
 
 const (
+	// MSBFirst transfers the most significant bit of the words first.
+	// It is the default.
 	MSBFirst = Order(0)
+	// LSBFirst transfers the least significant bit of the words first,
+	// the SPI_LSB_FIRST mode flag of the kernel.
 	LSBFirst = Order(1)
 )
 
+// modeFlags are the names of the kernel mode flags.
+var modeFlags = []struct {
+	m    Mode
+	name string
+}{
+	{CSHigh, "CSHigh"},
+	{ThreeWire, "ThreeWire"},
+	{Loop, "Loop"},
+	{NoCS, "NoCS"},
+	{Ready, "Ready"},
+}
+
+// String returns the name of the mode, followed by the names
+// of its flags, e.g. "Mode3|CSHigh". Unknown flags are
+// printed in hexadecimal.
+func (m Mode) String() string {
+	s := []string{fmt.Sprintf("Mode%d", m&3)}
+	rest := m &^ 3
+	for _, f := range modeFlags {
+		if rest&f.m != 0 {
+			s = append(s, f.name)
+			rest &^= f.m
+		}
+	}
+	if rest != 0 {
+		s = append(s, fmt.Sprintf("%#x", int(rest)))
+	}
+	return strings.Join(s, "|")
+}
+
+func (o Order) String() string {
+	switch o {
+	case MSBFirst:
+		return "MSBFirst"
+	case LSBFirst:
+		return "LSBFirst"
+	}
+	return fmt.Sprintf("Order(%d)", int(o))
+}
+
+// ParseMode parses a mode formatted by Mode.String, or a comma
+// separated list such as "mode3,cshigh,3wire". Names are case
+// insensitive and the default mode is Mode0.
+func ParseMode(s string) (Mode, error) {
+	var m Mode
+	base := false
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '|' }) {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if len(f) == 5 && strings.HasPrefix(f, "mode") && f[4] >= '0' && f[4] <= '3' {
+			if base {
+				return 0, fmt.Errorf("invalid mode %q: more than one mode", s)
+			}
+			m |= Mode(f[4] - '0')
+			base = true
+			continue
+		}
+		if f == "3wire" {
+			m |= ThreeWire
+			continue
+		}
+		if strings.HasPrefix(f, "0x") {
+			// Flags without a name are formatted in hexadecimal.
+			v, err := strconv.ParseUint(f[2:], 16, 32)
+			if err != nil {
+				return 0, fmt.Errorf("invalid mode %q: invalid flag %q", s, f)
+			}
+			m |= Mode(v)
+			continue
+		}
+		known := false
+		for _, mf := range modeFlags {
+			if f == strings.ToLower(mf.name) {
+				m |= mf.m
+				known = true
+			}
+		}
+		if !known {
+			return 0, fmt.Errorf("invalid mode %q: unknown flag %q", s, f)
+		}
+	}
+	if !base {
+		return 0, fmt.Errorf("invalid mode %q: no mode", s)
+	}
+	return m, nil
+}
+
+// ParseOrder parses a bit order: "msb" or "msbfirst" for MSBFirst and
+// "lsb" or "lsbfirst" for LSBFirst. Names are case insensitive.
+func ParseOrder(s string) (Order, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "msb", "msbfirst":
+		return MSBFirst, nil
+	case "lsb", "lsbfirst":
+		return LSBFirst, nil
+	}
+	return 0, fmt.Errorf("invalid bit order %q", s)
+}
+
+// Message is a single transfer in a sequence of transfers
+// performed by TxMany. Zero valued Speed, Bits and Delay fields
+// use the device's configuration. The devfs driver rounds Delay up
+// to a whole number of microseconds, like SetDelay, and supports
+// delays up to 65.535ms.
+type Message = driver.Message
+
+// Device is an open SPI device.
+//
+// A Device opened with the DevFS driver is safe for concurrent use
+// by multiple goroutines: its transfers are serialized and configuration
+// changes take effect between transfers, never during one. Other drivers
+// may require the calls to be serialized by the user.
 type Device struct {
 	conn driver.Conn
+
+	// speed is the speed passed to Open, restored by Reset.
+	speed int
+	// timeout is the timeout of Transfer and TxMany, or 0 for none.
+	timeout time.Duration
+	// retries and retryBackoff are set by SetRetry.
+	retries      int
+	retryBackoff time.Duration
+
+	stats deviceStats
+
+	// regReadMask is ORed into the address by ReadReg and ReadRegBurst,
+	// and regAutoInc by ReadRegBurst.
+	regReadMask byte
+	regAutoInc  byte
+
+	// queueMu guards queue, the transfers submitted with Submit.
+	queueMu sync.Mutex
+	queue   queue
+
+	// held is the transaction begun with BeginTransaction, if any.
+	held atomic.Pointer[Transaction]
 }
 
 // SetMode sets the SPI mode. SPI mode is a combination of polarity and phases.
 // CPOL is the high order bit, CPHA is the low order. Pre-computed mode
-// values are Mode0, Mode1, Mode2 and Mode3.
-// The value can be changed by SPI device's driver.
+// values are Mode0, Mode1, Mode2 and Mode3. They can be combined
+// with the mode flags, such as CSHigh.
+// The value can be changed by SPI device's driver. Values with other
+// bits than the mode flags are rejected with an error wrapping
+// ErrInvalidMode.
 func (d *Device) SetMode(mode Mode) error {
-	return d.conn.Configure(driver.Mode, int(mode))
+	return d.configure(driver.Mode, int(mode))
+}
+
+// SetMode0 sets SPI mode 0, CPOL=0 and CPHA=0: the clock idles low
+// and the data is sampled on its rising edge. The mode flags, such as
+// CSHigh, are unchanged.
+func (d *Device) SetMode0() error {
+	return d.setBaseMode(Mode0)
+}
+
+// SetMode1 sets SPI mode 1, CPOL=0 and CPHA=1: the clock idles low
+// and the data is sampled on its falling edge. The mode flags, such
+// as CSHigh, are unchanged.
+func (d *Device) SetMode1() error {
+	return d.setBaseMode(Mode1)
+}
+
+// SetMode2 sets SPI mode 2, CPOL=1 and CPHA=0: the clock idles high
+// and the data is sampled on its falling edge. The mode flags, such
+// as CSHigh, are unchanged.
+func (d *Device) SetMode2() error {
+	return d.setBaseMode(Mode2)
+}
+
+// SetMode3 sets SPI mode 3, CPOL=1 and CPHA=1: the clock idles high
+// and the data is sampled on its rising edge. The mode flags, such
+// as CSHigh, are unchanged.
+func (d *Device) SetMode3() error {
+	return d.setBaseMode(Mode3)
+}
+
+// SetCPOL sets the clock polarity, keeping the rest of the mode
+// unchanged: if high, the clock idles high.
+func (d *Device) SetCPOL(high bool) error {
+	return d.setModeFlag(cpol, high)
+}
+
+// SetCPHA sets the clock phase, keeping the rest of the mode
+// unchanged: if set, the data is sampled on the second edge of
+// the clock, and otherwise on the first one.
+func (d *Device) SetCPHA(second bool) error {
+	return d.setModeFlag(cpha, second)
+}
+
+// The bits of the clock polarity and phase of a Mode.
+const (
+	cpha = Mode(0x01)
+	cpol = Mode(0x02)
+)
+
+// setBaseMode sets the mode number m, keeping the mode flags.
+func (d *Device) setBaseMode(m Mode) error {
+	cur, err := d.Mode()
+	if err != nil {
+		return err
+	}
+	return d.SetMode(cur&^(cpol|cpha) | m)
+}
+
+// SetCSHigh sets whether the chip select is active high,
+// keeping the rest of the mode unchanged.
+func (d *Device) SetCSHigh(on bool) error {
+	return d.setModeFlag(CSHigh, on)
+}
+
+// SetThreeWire sets whether the device uses a single bidirectional
+// data line, keeping the rest of the mode unchanged. A 3-wire bus
+// is half duplex: the messages of a Transfer or TxMany must either
+// write or read, see Write3Wire and Read3Wire, so that the master
+// and the slave don't drive the line at the same time.
+func (d *Device) SetThreeWire(on bool) error {
+	return d.setModeFlag(ThreeWire, on)
+}
+
+// SetLoopback sets whether the controller is in loopback mode,
+// keeping the rest of the mode unchanged. In loopback mode, the
+// controller connects its data output to its input, so Transfer
+// reads tx to rx. Not all controllers support it.
+func (d *Device) SetLoopback(on bool) error {
+	return d.setModeFlag(Loop, on)
+}
+
+// SetNoCS sets whether the controller leaves its chip select line
+// alone, keeping the rest of the mode unchanged. When set, the caller
+// is responsible for asserting the chip select of the device around
+// the transfers, for instance with a GPIO line, see SetChipSelect.
+func (d *Device) SetNoCS(on bool) error {
+	return d.setModeFlag(NoCS, on)
+}
+
+// SelfTest checks that the controller and its driver transfer data
+// correctly by transferring a pseudorandom pattern in loopback mode.
+// The mode is restored to its previous value afterwards.
+func (d *Device) SelfTest() error {
+	m, err := d.Mode()
+	if err != nil {
+		return err
+	}
+	if err := d.SetMode(m | Loop); err != nil {
+		return err
+	}
+	tx := make([]byte, 64)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(tx)
+	rx := make([]byte, len(tx))
+	err = d.Transfer(tx, rx)
+	if rerr := d.SetMode(m); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(rx, tx) {
+		return fmt.Errorf("loopback self-test failed: wrote % x, read % x", tx, rx)
+	}
+	return nil
+}
+
+// setModeFlag sets or clears the mode flag f.
+func (d *Device) setModeFlag(f Mode, on bool) error {
+	m, err := d.Mode()
+	if err != nil {
+		return err
+	}
+	if on {
+		m |= f
+	} else {
+		m &^= f
+	}
+	return d.SetMode(m)
+}
+
+// SetMode32 sets the 32-bit SPI mode word, which in addition to the
+// mode can carry the flags that do not fit in 8 bits, such as the dual
+// and quad transfer flags. Values that fit in 8 bits are set the same
+// way as SetMode, for older kernels without 32-bit mode support.
+// Unlike the mode of SetMode, the mode word of the devfs driver
+// includes SPI_LSB_FIRST (0x08), so it also sets the bit order.
+func (d *Device) SetMode32(m uint32) error {
+	return d.configure(driver.Mode32, int(m))
+}
+
+// Mode32 returns the 32-bit SPI mode word in effect. Controllers may
+// drop the flags they don't support, such as quad transfers on a
+// controller with dual transfers only, which Mode32 tells.
+func (d *Device) Mode32() (uint32, error) {
+	m, err := d.conn.Query(driver.Mode32)
+	return uint32(m), err
+}
+
+// Mode returns the SPI mode in effect.
+func (d *Device) Mode() (Mode, error) {
+	m, err := d.conn.Query(driver.Mode)
+	return Mode(m), err
 }
 
 // SetMaxSpeed sets the maximum clock speed in Hz.
-// The value can be overriden by SPI device's driver.
+// The value can be overriden by SPI device's driver: a speed above the
+// maximum of the controller is clamped without an error, and MaxSpeed
+// reports the speed in effect.
+// Zero uses the default speed of the driver: with devfs, the speed
+// of the device is left unchanged, which is initially the maximum
+// speed of its device tree description.
 func (d *Device) SetMaxSpeed(speed int) error {
-	return d.conn.Configure(driver.Speed, speed)
+	return d.configure(driver.Speed, speed)
+}
+
+// SwapMaxSpeed sets the maximum clock speed in Hz like SetMaxSpeed
+// and returns the speed in effect before, for instance to restore the
+// speed after an operation at another speed:
+//
+//	prev, err := dev.SwapMaxSpeed(20000000)
+//	if err != nil {
+//		return err
+//	}
+//	defer dev.SetMaxSpeed(prev)
+func (d *Device) SwapMaxSpeed(speed int) (prev int, err error) {
+	prev, err = d.MaxSpeed()
+	if err != nil {
+		return 0, err
+	}
+	if err := d.SetMaxSpeed(speed); err != nil {
+		return 0, err
+	}
+	return prev, nil
+}
+
+// MaxSpeed returns the maximum clock speed in Hz in effect,
+// which may be lower than the speed set by SetMaxSpeed.
+func (d *Device) MaxSpeed() (int, error) {
+	return d.conn.Query(driver.Speed)
 }
 
 // SetBitsPerWord sets how many bits it takes to represent a word, e.g. 8 represents 8-bit words.
-// The default is 8 bits per word.
+// The default is 8 bits per word, which zero also sets. The devfs
+// driver accepts 1 to 32 bits per word, although the controllers
+// may support fewer.
 func (d *Device) SetBitsPerWord(bits int) error {
-	return d.conn.Configure(driver.Bits, bits)
+	return d.configure(driver.Bits, bits)
+}
+
+// BitsPerWord returns the number of bits per word in effect.
+func (d *Device) BitsPerWord() (int, error) {
+	return d.conn.Query(driver.Bits)
 }
 
 // SetBitOrder sets the bit justification used to transfer SPI words.
 // Valid values are MSBFirst and LSBFirst.
 func (d *Device) SetBitOrder(o Order) error {
-	return d.conn.Configure(driver.Order, int(o))
+	return d.configure(driver.Order, int(o))
+}
+
+// SetLSBFirst sets whether the words are transferred least significant
+// bit first, see SetBitOrder.
+func (d *Device) SetLSBFirst(on bool) error {
+	if on {
+		return d.SetBitOrder(LSBFirst)
+	}
+	return d.SetBitOrder(MSBFirst)
+}
+
+// BitOrder returns the bit justification in effect, as reported by the
+// driver: with devfs, it is read back from the kernel, so that the
+// controllers ignoring LSBFirst can be detected.
+func (d *Device) BitOrder() (Order, error) {
+	o, err := d.conn.Query(driver.Order)
+	if err != nil {
+		return MSBFirst, err
+	}
+	if o != 0 {
+		return LSBFirst, nil
+	}
+	return MSBFirst, nil
+}
+
+// SetLanes sets the number of data lines used to write and read,
+// e.g. 2 for dual and 4 for quad SPI. Valid values are 0, 1, 2, 4 and 8,
+// where 0 and 1 both mean a single line. Multi-line transfers also
+// require the matching mode flags to be set with SetMode32.
+func (d *Device) SetLanes(tx, rx int) error {
+	if err := d.configure(driver.TxNBits, tx); err != nil {
+		return err
+	}
+	return d.configure(driver.RxNBits, rx)
+}
+
+// SetCSChange sets the default cs_change flag of the kernel transfers.
+// If leaveAsserted is true, the chip select is left asserted after
+// Transfer returns, so the next transfer continues the same transaction;
+// within TxMany, it deasserts the chip select between the messages.
+// If false, which is the default, the chip select is held asserted
+// during a transaction and deasserted at its end.
+// Messages with CSChange or NoCSChange set override the default.
+// WriteThenRead, TxPairs and the register methods set NoCSChange
+// between their messages, so that they hold the chip select asserted
+// whatever the default.
+func (d *Device) SetCSChange(leaveAsserted bool) error {
+	v := 0
+	if leaveAsserted {
+		v = 1
+	}
+	return d.configure(driver.CSChange, v)
 }
 
 // SetDelay sets the amount of pause will be added after each frame write.
+// It is rounded up to a whole number of microseconds. The devfs driver
+// supports delays up to 65.535ms and returns an error for longer ones.
 func (d *Device) SetDelay(t time.Duration) error {
-	return d.conn.Configure(driver.Delay, int(t.Nanoseconds()/1000))
+	return d.configure(driver.Delay, microseconds(t))
+}
+
+// SetWordDelay sets the pause between the words of each transfer,
+// rounded up to a whole number of microseconds, for devices that need
+// time between the words. Linux kernels older than 5.3 ignore it.
+// The devfs driver supports word delays up to 255µs, the limit of the
+// kernel's word_delay_usecs field, and returns an error for longer ones.
+func (d *Device) SetWordDelay(t time.Duration) error {
+	return d.configure(driver.WordDelay, microseconds(t))
+}
+
+// microseconds returns t in microseconds, rounded up so that a short
+// pause isn't dropped, and clamped to math.MaxInt32 so that a long one
+// isn't truncated to a valid value.
+func microseconds(t time.Duration) int {
+	us := t / time.Microsecond
+	if t%time.Microsecond > 0 {
+		us++
+	}
+	if us > math.MaxInt32 {
+		us = math.MaxInt32
+	}
+	return int(us)
 }
 
 // Transfer performs a duplex transmission to write to the SPI device
-// and read len(rx) bytes to rx.
+// and read len(tx) bytes to rx. tx and rx must have the same length.
+// If tx is nil, zeros are written while reading len(rx) bytes, which
+// saves allocating a buffer of zeros for read-only transactions.
+// Likewise, if rx is nil, the bytes read while writing tx are discarded.
 // User should not mutate the tx and rx until this call returns.
+// With the DevFS driver and no timeout, Transfer doesn't allocate,
+// so it can be called at high rates without pressure on the garbage
+// collector.
+//
+// The errors of the DevFS driver for a failed request are the
+// syscall.Errno returned by the kernel, e.g. syscall.EREMOTEIO or
+// syscall.EMSGSIZE, which errors.As extracts from the errors of
+// Transfer, TxMany and the other methods of the device.
 func (d *Device) Transfer(tx, rx []byte) error {
-	return d.conn.Transfer(tx, rx)
+	if d.timeout > 0 {
+		return d.withTimeout(func() error { return d.transfer(tx, rx) })
+	}
+	return d.transfer(tx, rx)
+}
+
+// transferLen returns the number of bytes of a transfer of tx and rx,
+// either of which may be nil.
+func transferLen(tx, rx []byte) (int, error) {
+	switch {
+	case tx == nil:
+		return len(rx), nil
+	case rx == nil || len(rx) == len(tx):
+		return len(tx), nil
+	}
+	return 0, fmt.Errorf("rx length (%d) does not match tx length (%d)", len(rx), len(tx))
+}
+
+// head returns the first n bytes of b, or nil if b is nil.
+func head(b []byte, n int) []byte {
+	if b == nil {
+		return nil
+	}
+	return b[:n]
+}
+
+// tail returns the bytes of b after the first n, or nil if b is nil.
+func tail(b []byte, n int) []byte {
+	if b == nil {
+		return nil
+	}
+	return b[n:]
+}
+
+// Exchange performs a duplex transmission of tx like Transfer and
+// returns the len(tx) bytes read. It allocates the returned slice on
+// every call; Transfer with a reused rx doesn't allocate.
+func (d *Device) Exchange(tx []byte) ([]byte, error) {
+	rx := make([]byte, len(tx))
+	if err := d.Transfer(tx, rx); err != nil {
+		return nil, err
+	}
+	return rx, nil
+}
+
+// SetTimeout sets the time after which Transfer and TxMany give up
+// and return ErrTimeout. Zero, the default, means no timeout.
+// It must not be called concurrently with transfers.
+//
+// The timeout also covers the methods built on them, such as
+// TransferAt, TransferBits, Txv, WriteThenRead, TxPairs, ReadReg,
+// WriteReg and TransferWords16, and the ones of ReadWriter. It doesn't
+// cover TransferContext, whose ctx bounds it instead, or the transfers
+// queued by Submit.
+//
+// The timeout is implemented like TransferContext: the underlying
+// system call can't be interrupted and keeps running in the background,
+// so the buffers must not be used until it completes, and the other
+// transfers of the device wait for it. With DevFS, Close doesn't wait:
+// it closes the device file, which the kernel releases when the system
+// call returns, and the later transfers fail with ErrClosed.
+func (d *Device) SetTimeout(t time.Duration) {
+	d.timeout = t
+}
+
+// withTimeout runs f on another goroutine and
+// returns ErrTimeout if it doesn't return in time.
+func (d *Device) withTimeout(f func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	t := time.NewTimer(d.timeout)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-t.C:
+		return ErrTimeout
+	}
+}
+
+// TransferContext is like Transfer but returns ctx.Err() if ctx is
+// done before the transfer completes.
+//
+// The transfer is performed on another goroutine, since the underlying
+// system calls can't be interrupted. If ctx is done first, the transfer
+// keeps running in the background: tx and rx must not be used until it
+// completes, and the other transfers and the configuration of the device
+// wait for it. Like after a timeout set with SetTimeout, Close doesn't
+// wait with DevFS, so closing the device releases it.
+func (d *Device) TransferContext(ctx context.Context, tx, rx []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- d.transfer(tx, rx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TransferAt is like Transfer but clocks the transfer at speed Hz
+// instead of the device's max speed, which is left unchanged.
+func (d *Device) TransferAt(tx, rx []byte, speed int) error {
+	return d.TxMany([]Message{{Tx: tx, Rx: rx, Speed: speed}})
+}
+
+// TransferBits is like Transfer but uses bits per word for the
+// transfer instead of the device's setting, which is left unchanged.
+func (d *Device) TransferBits(tx, rx []byte, bits int) error {
+	return d.TxMany([]Message{{Tx: tx, Rx: rx, Bits: bits}})
+}
+
+// Txv performs a duplex transmission of the concatenation of parts,
+// for instance an opcode, an address and data, reading the response
+// to dst, which must be as long as all the parts together. A nil dst
+// discards the bytes read. The parts are copied to a single buffer, so
+// they are sent as one transfer with no gap between them.
+func (d *Device) Txv(dst []byte, parts ...[]byte) error {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	if dst != nil && len(dst) != n {
+		return fmt.Errorf("rx length (%d) does not match tx length (%d)", len(dst), n)
+	}
+	tx := make([]byte, 0, n)
+	for _, p := range parts {
+		tx = append(tx, p...)
+	}
+	return d.Transfer(tx, dst)
+}
+
+// WriteThenRead writes w to the device and then reads len(r) bytes
+// to r in a single transaction, keeping the chip select asserted
+// between the two. The bytes read while writing w are discarded
+// and zeros are clocked out while reading r.
+func (d *Device) WriteThenRead(w, r []byte) error {
+	return d.TxMany([]Message{
+		{Tx: w, NoCSChange: true},
+		{Rx: r},
+	})
+}
+
+// TxPairs performs the transfers of pairs in order as a single
+// transaction, keeping the chip select asserted between them.
+// The first buffer of each pair is written to the device while
+// len(pair[0]) bytes are read to the second, so the buffers of
+// a pair must have the same length.
+func (d *Device) TxPairs(pairs [][2][]byte) error {
+	msgs := make([]Message, len(pairs))
+	for i, p := range pairs {
+		if len(p[0]) != len(p[1]) {
+			return fmt.Errorf("pair %d: rx length (%d) does not match tx length (%d)", i, len(p[1]), len(p[0]))
+		}
+		msgs[i] = Message{Tx: p[0], Rx: p[1], NoCSChange: i < len(pairs)-1}
+	}
+	return d.TxMany(msgs)
+}
+
+// TxMany performs the transfers of msgs in order as a single transaction.
+// Each message's Rx is filled with len(Tx) bytes read from the device.
+// User should not mutate the messages until this call returns.
+//
+// The cs_change flag of each message's transfer is set by its CSChange
+// field, cleared by its NoCSChange field, and otherwise the setting of
+// SetCSChange. The flag pulses the chip select between a message and
+// the next one, so that it can be held asserted between some messages
+// only. The flag of the last message controls the chip select after
+// the transaction: if set, the chip select is left asserted until the
+// next transfer. In a transaction begun with BeginTransaction, the last
+// message is sent with CSChange set.
+func (d *Device) TxMany(msgs []Message) error {
+	if d.timeout > 0 {
+		return d.withTimeout(func() error { return d.transferMany(msgs) })
+	}
+	return d.transferMany(msgs)
+}
+
+// allocBuffers returns msgs with the nil Tx buffers replaced by
+// buffers of zeros and the nil Rx buffers replaced by buffers whose
+// data is discarded, for the drivers that need both. msgs is not
+// modified.
+func allocBuffers(msgs []driver.Message) []driver.Message {
+	var out []driver.Message
+	for i, m := range msgs {
+		if (m.Tx == nil) == (m.Rx == nil) {
+			continue
+		}
+		if out == nil {
+			out = append([]driver.Message(nil), msgs...)
+		}
+		if m.Tx == nil {
+			out[i].Tx = make([]byte, len(m.Rx))
+		} else {
+			out[i].Rx = make([]byte, len(m.Tx))
+		}
+	}
+	if out == nil {
+		return msgs
+	}
+	return out
 }
 
 // Open opens a device with the specified bus and chip select
@@ -82,7 +739,10 @@ func (d *Device) Transfer(tx, rx []byte) error {
 // values are Mode0, Mode1, Mode2 and Mode3. The value of the mode argument
 // can be overriden by the device's driver.
 // Speed is the max clock speed (Hz) and can be overriden by the device's driver.
-func Open(o driver.Opener, bus, cs int, mode Mode, speed int) (*Device, error) {
+//
+// The options are applied in order after the mode and the speed.
+// If any of them fails, the device is closed and the error is returned.
+func Open(o driver.Opener, bus, cs int, mode Mode, speed int, opts ...Option) (*Device, error) {
 	if o == nil {
 		o = &DevFS{}
 	}
@@ -91,8 +751,50 @@ func Open(o driver.Opener, bus, cs int, mode Mode, speed int) (*Device, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newDevice(conn, mode, speed, opts)
+}
 
-	dev := &Device{conn: conn}
+// The bounds of the interval between the attempts of OpenContext,
+// which doubles after each attempt.
+const (
+	minOpenRetry = 10 * time.Millisecond
+	maxOpenRetry = time.Second
+)
+
+// OpenContext is like Open, but it retries opening the device until it
+// succeeds or ctx is done, for instance for the services starting
+// before the devices are ready at boot. Only the errors of the driver
+// opening the device are retried: if the mode, the speed or the
+// options fail, the error is returned right away. If ctx is done
+// first, the returned error wraps ctx.Err() and describes the last
+// error of the driver.
+func OpenContext(ctx context.Context, o driver.Opener, bus, cs int, mode Mode, speed int, opts ...Option) (*Device, error) {
+	if o == nil {
+		o = &DevFS{}
+	}
+	retry := minOpenRetry
+	for {
+		conn, err := o.Open(bus, cs)
+		if err == nil {
+			return newDevice(conn, mode, speed, opts)
+		}
+		t := time.NewTimer(retry)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("%w: %v", ctx.Err(), err)
+		}
+		if retry *= 2; retry > maxOpenRetry {
+			retry = maxOpenRetry
+		}
+	}
+}
+
+// newDevice returns a device using conn, with the mode, the speed
+// and the options of Open. conn is closed if any of them fails.
+func newDevice(conn driver.Conn, mode Mode, speed int, opts []Option) (*Device, error) {
+	dev := &Device{conn: conn, speed: speed}
 	if err := dev.SetMode(mode); err != nil {
 		dev.Close()
 		return nil, err
@@ -101,10 +803,102 @@ func Open(o driver.Opener, bus, cs int, mode Mode, speed int) (*Device, error) {
 		dev.Close()
 		return nil, err
 	}
+	for _, opt := range opts {
+		if err := opt(dev); err != nil {
+			dev.Close()
+			return nil, err
+		}
+	}
 	return dev, nil
 }
 
-// Close closes the SPI device and releases the related resources.
+// Option is an option of Open configuring the device.
+type Option func(*Device) error
+
+// WithMode returns an option setting the SPI mode, see SetMode.
+func WithMode(mode Mode) Option {
+	return func(d *Device) error { return d.SetMode(mode) }
+}
+
+// WithMaxSpeed returns an option setting the maximum clock speed
+// in Hz, see SetMaxSpeed.
+func WithMaxSpeed(speed int) Option {
+	return func(d *Device) error { return d.SetMaxSpeed(speed) }
+}
+
+// WithBits returns an option setting the number of bits per word,
+// see SetBitsPerWord.
+func WithBits(bits int) Option {
+	return func(d *Device) error { return d.SetBitsPerWord(bits) }
+}
+
+// WithBitOrder returns an option setting the bit justification,
+// see SetBitOrder.
+func WithBitOrder(o Order) Option {
+	return func(d *Device) error { return d.SetBitOrder(o) }
+}
+
+// WithDelay returns an option setting the pause after each transfer,
+// see SetDelay.
+func WithDelay(t time.Duration) Option {
+	return func(d *Device) error { return d.SetDelay(t) }
+}
+
+// Reset restores the default configuration of the device: Mode0,
+// MSBFirst, 8 bits per word and the max speed passed to Open.
+// It stops at the first setting that fails and returns its error.
+func (d *Device) Reset() error {
+	if err := d.SetMode(Mode0); err != nil {
+		return err
+	}
+	if err := d.SetBitOrder(MSBFirst); err != nil {
+		return err
+	}
+	if err := d.SetBitsPerWord(8); err != nil {
+		return err
+	}
+	return d.SetMaxSpeed(d.speed)
+}
+
+// Config is a configuration of a device applied by Configure.
+// Zero valued fields leave the settings unchanged.
+type Config struct {
+	Mode  Mode
+	Order Order
+	Bits  int // bits per word
+	Speed int // max clock speed in Hz
+}
+
+// Configure applies the non-zero settings of cfg in the order of the
+// fields of Config. It stops at the first setting that fails and
+// returns its error, wrapped with the name of the field.
+func (d *Device) Configure(cfg Config) error {
+	if cfg.Mode != 0 {
+		if err := d.SetMode(cfg.Mode); err != nil {
+			return fmt.Errorf("Mode: %w", err)
+		}
+	}
+	if cfg.Order != 0 {
+		if err := d.SetBitOrder(cfg.Order); err != nil {
+			return fmt.Errorf("Order: %w", err)
+		}
+	}
+	if cfg.Bits != 0 {
+		if err := d.SetBitsPerWord(cfg.Bits); err != nil {
+			return fmt.Errorf("Bits: %w", err)
+		}
+	}
+	if cfg.Speed != 0 {
+		if err := d.SetMaxSpeed(cfg.Speed); err != nil {
+			return fmt.Errorf("Speed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the SPI device and releases the related resources,
+// after the transfers submitted with Submit complete.
 func (d *Device) Close() error {
+	d.closeQueue()
 	return d.conn.Close()
 }
@@ -0,0 +1,614 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestDeviceGetters(t *testing.T) {
+	dev := &Device{conn: &spitest.Conn{}}
+	if err := dev.SetMode(Mode2); err != nil {
+		t.Fatalf("SetMode: %v", err)
+	}
+	if err := dev.SetBitsPerWord(16); err != nil {
+		t.Fatalf("SetBitsPerWord: %v", err)
+	}
+	if err := dev.SetBitOrder(LSBFirst); err != nil {
+		t.Fatalf("SetBitOrder: %v", err)
+	}
+	if err := dev.SetMaxSpeed(1000000); err != nil {
+		t.Fatalf("SetMaxSpeed: %v", err)
+	}
+	if m, err := dev.Mode(); err != nil || m != Mode2 {
+		t.Errorf("Mode()=%v, %v, want %v, nil", m, err, Mode2)
+	}
+	if b, err := dev.BitsPerWord(); err != nil || b != 16 {
+		t.Errorf("BitsPerWord()=%v, %v, want 16, nil", b, err)
+	}
+	if o, err := dev.BitOrder(); err != nil || o != LSBFirst {
+		t.Errorf("BitOrder()=%v, %v, want %v, nil", o, err, LSBFirst)
+	}
+	if s, err := dev.MaxSpeed(); err != nil || s != 1000000 {
+		t.Errorf("MaxSpeed()=%v, %v, want 1000000, nil", s, err)
+	}
+}
+
+func TestDeviceSwapMaxSpeed(t *testing.T) {
+	dev := &Device{conn: &spitest.Conn{}}
+	if err := dev.SetMaxSpeed(1000000); err != nil {
+		t.Fatalf("SetMaxSpeed: %v", err)
+	}
+	if prev, err := dev.SwapMaxSpeed(2000000); err != nil || prev != 1000000 {
+		t.Errorf("SwapMaxSpeed(2000000)=%v, %v, want 1000000, nil", prev, err)
+	}
+	if prev, err := dev.SwapMaxSpeed(3000000); err != nil || prev != 2000000 {
+		t.Errorf("SwapMaxSpeed(3000000)=%v, %v, want 2000000, nil", prev, err)
+	}
+	if s, err := dev.MaxSpeed(); err != nil || s != 3000000 {
+		t.Errorf("MaxSpeed()=%v, %v, want 3000000, nil", s, err)
+	}
+}
+
+func TestDeviceTransferAt(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	if err := dev.TransferAt([]byte{1, 2}, make([]byte, 2), 100000); err != nil {
+		t.Fatalf("TransferAt: %v", err)
+	}
+	if err := dev.Transfer([]byte{1, 2}, make([]byte, 2)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	ts := c.Transfers()
+	if ts[0].Speed != 100000 {
+		t.Errorf("TransferAt message speed=%d, want 100000", ts[0].Speed)
+	}
+	if ts[1].Speed != 0 {
+		t.Errorf("Transfer message speed=%d, want 0", ts[1].Speed)
+	}
+}
+
+func TestDeviceTransferBits(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	if err := dev.TransferBits([]byte{1, 2}, make([]byte, 2), 9); err != nil {
+		t.Fatalf("TransferBits: %v", err)
+	}
+	if got := c.Transfers()[0].Bits; got != 9 {
+		t.Errorf("TransferBits(9) message bits=%d, want 9", got)
+	}
+}
+
+func TestDeviceSetCSChange(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	if err := dev.SetCSChange(true); err != nil {
+		t.Fatalf("SetCSChange: %v", err)
+	}
+	if err := dev.SetCSChange(false); err != nil {
+		t.Fatalf("SetCSChange: %v", err)
+	}
+	want := []spitest.Config{{Key: driver.CSChange, Value: 1}, {Key: driver.CSChange, Value: 0}}
+	if got := c.Configs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Configs()=%v, want %v", got, want)
+	}
+}
+
+func TestDeviceTransferContext(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := dev.TransferContext(ctx, []byte{1}, make([]byte, 1)); err != context.Canceled {
+		t.Errorf("TransferContext with canceled context=%v, want %v", err, context.Canceled)
+	}
+	if n := len(c.Transfers()); n != 0 {
+		t.Errorf("got %d transfers with canceled context, want 0", n)
+	}
+
+	if err := dev.TransferContext(context.Background(), []byte{1}, make([]byte, 1)); err != nil {
+		t.Errorf("TransferContext: %v", err)
+	}
+
+	release := make(chan struct{})
+	c.TransferError = func(driver.Message) error {
+		<-release
+		return nil
+	}
+	defer close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := dev.TransferContext(ctx, []byte{1}, make([]byte, 1)); err != context.DeadlineExceeded {
+		t.Errorf("TransferContext with blocked transfer=%v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDeviceSetTimeout(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	dev.SetTimeout(time.Second)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Errorf("Transfer: %v", err)
+	}
+
+	release := make(chan struct{})
+	c.TransferError = func(driver.Message) error {
+		<-release
+		return nil
+	}
+	defer close(release)
+	dev.SetTimeout(10 * time.Millisecond)
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != ErrTimeout {
+		t.Errorf("Transfer with blocked transfer=%v, want %v", err, ErrTimeout)
+	}
+	for name, f := range map[string]func() error{
+		"TransferAt":    func() error { return dev.TransferAt([]byte{1}, nil, 1000) },
+		"TransferBits":  func() error { return dev.TransferBits([]byte{1}, nil, 8) },
+		"Txv":           func() error { return dev.Txv(nil, []byte{1}, []byte{2}) },
+		"WriteThenRead": func() error { return dev.WriteThenRead([]byte{1}, make([]byte, 1)) },
+		"TxPairs":       func() error { return dev.TxPairs([][2][]byte{{{1}, {0}}}) },
+		"WriteReg":      func() error { return dev.WriteReg(1, []byte{2}) },
+	} {
+		if err := f(); err != ErrTimeout {
+			t.Errorf("%s with blocked transfer=%v, want %v", name, err, ErrTimeout)
+		}
+	}
+}
+
+func TestDeviceTransferNilTx(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Respond([]byte{1, 2, 3})
+	dev := &Device{conn: c}
+	rx := make([]byte, 3)
+	if err := dev.Transfer(nil, rx); err != nil {
+		t.Fatalf("Transfer(nil, rx): %v", err)
+	}
+	if want := []byte{1, 2, 3}; !reflect.DeepEqual(rx, want) {
+		t.Errorf("read % x, want % x", rx, want)
+	}
+}
+
+func TestDeviceTransferNilRx(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Respond([]byte{1, 2, 3})
+	dev := &Device{conn: c}
+	if err := dev.Transfer([]byte{4, 5, 6}, nil); err != nil {
+		t.Fatalf("Transfer(tx, nil): %v", err)
+	}
+	ts := c.Transfers()
+	if len(ts) != 1 {
+		t.Fatalf("got %d messages, want 1", len(ts))
+	}
+	if ts[0].Rx != nil {
+		t.Errorf("message Rx=% x, want nil", ts[0].Rx)
+	}
+}
+
+func TestDeviceExchange(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Respond([]byte{1, 2, 3})
+	dev := &Device{conn: c}
+	rx, err := dev.Exchange([]byte{4, 5, 6, 7})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if want := []byte{1, 2, 3, 0}; !reflect.DeepEqual(rx, want) {
+		t.Errorf("Exchange()=% x, want % x", rx, want)
+	}
+	ts := c.Transfers()
+	if len(ts) != 1 || !reflect.DeepEqual(ts[0].Tx, []byte{4, 5, 6, 7}) {
+		t.Errorf("transfers=%v, want a single write of 04 05 06 07", ts)
+	}
+
+	c.TransferError = func(driver.Message) error { return errors.New("boom") }
+	if rx, err := dev.Exchange([]byte{1}); err == nil || rx != nil {
+		t.Errorf("Exchange()=% x, %v, want nil, error", rx, err)
+	}
+}
+
+func TestMicroseconds(t *testing.T) {
+	tests := []struct {
+		t    time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Nanosecond, 1},
+		{time.Microsecond, 1},
+		{1001 * time.Nanosecond, 2},
+		{65535 * time.Microsecond, 65535},
+		{-time.Microsecond, -1},
+		{time.Duration(math.MaxInt64), math.MaxInt32},
+	}
+	for _, test := range tests {
+		if got := microseconds(test.t); got != test.want {
+			t.Errorf("microseconds(%v)=%d, want %d", test.t, got, test.want)
+		}
+	}
+}
+
+func TestDeviceTxv(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Respond([]byte{0, 0, 0, 0xaa, 0xbb})
+	dev := &Device{conn: c}
+	dst := make([]byte, 5)
+	if err := dev.Txv(dst, []byte{0x0b}, []byte{0x12, 0x34}, nil, []byte{0, 0}); err != nil {
+		t.Fatalf("Txv: %v", err)
+	}
+	ts := c.Transfers()
+	if len(ts) != 1 || !reflect.DeepEqual(ts[0].Tx, []byte{0x0b, 0x12, 0x34, 0, 0}) {
+		t.Errorf("transfers=%v, want a single write of 0b 12 34 00 00", ts)
+	}
+	if want := []byte{0, 0, 0, 0xaa, 0xbb}; !reflect.DeepEqual(dst, want) {
+		t.Errorf("dst=% x, want % x", dst, want)
+	}
+
+	if err := dev.Txv(nil, []byte{1}, []byte{2}); err != nil {
+		t.Errorf("Txv with a nil dst: %v", err)
+	}
+	if err := dev.Txv(make([]byte, 2), []byte{1, 2, 3}); err == nil {
+		t.Errorf("Txv with a short dst succeeded, want error")
+	}
+	if n := len(c.Transfers()); n != 2 {
+		t.Errorf("got %d transfers, want 2", n)
+	}
+}
+
+func TestDeviceWriteThenRead(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Respond([]byte{0xff}, []byte{1, 2, 3, 4})
+	dev := &Device{conn: c}
+	r := make([]byte, 4)
+	if err := dev.WriteThenRead([]byte{0x9f}, r); err != nil {
+		t.Fatalf("WriteThenRead: %v", err)
+	}
+	if want := []byte{1, 2, 3, 4}; !reflect.DeepEqual(r, want) {
+		t.Errorf("read % x, want % x", r, want)
+	}
+	ts := c.Transfers()
+	if len(ts) != 2 {
+		t.Fatalf("got %d messages, want 2", len(ts))
+	}
+	if want := []byte{0x9f}; !reflect.DeepEqual(ts[0].Tx, want) {
+		t.Errorf("command message Tx=% x, want % x", ts[0].Tx, want)
+	}
+	// The nil buffers discard the bytes read and write zeros.
+	if ts[0].Rx != nil {
+		t.Errorf("command message Rx=% x, want nil", ts[0].Rx)
+	}
+	if ts[1].Tx != nil {
+		t.Errorf("read message Tx=% x, want nil", ts[1].Tx)
+	}
+	for i, m := range ts {
+		if m.CSChange {
+			t.Errorf("message %d has CSChange set, want the chip select held", i)
+		}
+	}
+}
+
+func TestDeviceTxPairs(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Respond([]byte{1, 2}, []byte{3, 4, 5})
+	dev := &Device{conn: c}
+	rx0, rx1 := make([]byte, 2), make([]byte, 3)
+	pairs := [][2][]byte{
+		{[]byte{0xa, 0xb}, rx0},
+		{[]byte{0xc, 0xd, 0xe}, rx1},
+	}
+	if err := dev.TxPairs(pairs); err != nil {
+		t.Fatalf("TxPairs: %v", err)
+	}
+	if want := []byte{1, 2}; !reflect.DeepEqual(rx0, want) {
+		t.Errorf("pair 0 read % x, want % x", rx0, want)
+	}
+	if want := []byte{3, 4, 5}; !reflect.DeepEqual(rx1, want) {
+		t.Errorf("pair 1 read % x, want % x", rx1, want)
+	}
+	ts := c.Transfers()
+	if len(ts) != 2 {
+		t.Fatalf("got %d messages, want 2", len(ts))
+	}
+	for i, m := range ts {
+		if !reflect.DeepEqual(m.Tx, pairs[i][0]) {
+			t.Errorf("message %d Tx=% x, want % x", i, m.Tx, pairs[i][0])
+		}
+		if m.CSChange {
+			t.Errorf("message %d has CSChange set, want the chip select held", i)
+		}
+	}
+
+	if err := dev.TxPairs([][2][]byte{{[]byte{1}, make([]byte, 2)}}); err == nil {
+		t.Errorf("TxPairs with mismatched lengths succeeded, want error")
+	}
+	if n := len(c.Transfers()); n != 2 {
+		t.Errorf("got %d messages after the failed TxPairs, want 2", n)
+	}
+}
+
+// flakyOpener fails to open the device the first fails times.
+type flakyOpener struct {
+	c     *spitest.Conn
+	fails int
+	opens int
+}
+
+func (o *flakyOpener) Open(bus, chip int) (driver.Conn, error) {
+	o.opens++
+	if o.opens <= o.fails {
+		return nil, errors.New("no such device")
+	}
+	return o.c.Open(bus, chip)
+}
+
+func TestOpenContext(t *testing.T) {
+	o := &flakyOpener{c: &spitest.Conn{}, fails: 2}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dev, err := OpenContext(ctx, o, 0, 1, Mode3, 500000)
+	if err != nil {
+		t.Fatalf("OpenContext: %v", err)
+	}
+	defer dev.Close()
+	if o.opens != 3 {
+		t.Errorf("got %d attempts, want 3", o.opens)
+	}
+	if m, err := dev.Mode(); err != nil || m != Mode3 {
+		t.Errorf("Mode()=%v, %v, want %v, nil", m, err, Mode3)
+	}
+
+	o = &flakyOpener{c: &spitest.Conn{}, fails: 1 << 30}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := OpenContext(ctx, o, 0, 1, Mode0, 500000); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("OpenContext()=%v, want %v", err, context.DeadlineExceeded)
+	}
+	if o.opens < 2 {
+		t.Errorf("got %d attempts before the deadline, want several", o.opens)
+	}
+}
+
+func TestOpenOptions(t *testing.T) {
+	c := &spitest.Conn{}
+	dev, err := Open(c, 0, 1, Mode0, 500000, WithBits(16), WithBitOrder(LSBFirst), WithMode(Mode3))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	want := []spitest.Config{
+		{Key: driver.Mode, Value: 0},
+		{Key: driver.Speed, Value: 500000},
+		{Key: driver.Bits, Value: 16},
+		{Key: driver.Order, Value: 1},
+		{Key: driver.Mode, Value: 3},
+	}
+	if got := c.Configs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Configs()=%v, want %v", got, want)
+	}
+	if err := dev.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestOpenOptionsError(t *testing.T) {
+	errBits := errors.New("bits rejected")
+	c := &spitest.Conn{
+		ConfigureError: func(k, v int) error {
+			if k == driver.Bits {
+				return errBits
+			}
+			return nil
+		},
+	}
+	dev, err := Open(c, 0, 1, Mode0, 500000, WithMaxSpeed(1000000), WithBits(12), WithDelay(time.Millisecond))
+	if err != errBits {
+		t.Errorf("Open=%v, %v, want nil, %v", dev, err, errBits)
+	}
+	if !c.Closed() {
+		t.Errorf("device not closed after a failed option")
+	}
+	for _, cfg := range c.Configs() {
+		if cfg.Key == driver.Delay {
+			t.Errorf("option after the failed option was applied")
+		}
+	}
+}
+
+func TestModeString(t *testing.T) {
+	tests := []struct {
+		m    Mode
+		want string
+	}{
+		{Mode0, "Mode0"},
+		{Mode1, "Mode1"},
+		{Mode2, "Mode2"},
+		{Mode3, "Mode3"},
+		{Mode3 | CSHigh, "Mode3|CSHigh"},
+		{Mode0 | ThreeWire | Loop, "Mode0|ThreeWire|Loop"},
+		{Mode1 | NoCS, "Mode1|NoCS"},
+		{Mode0 | Ready, "Mode0|Ready"},
+		{Mode2 | CSHigh | 0x100, "Mode2|CSHigh|0x100"},
+	}
+	for _, test := range tests {
+		if got := test.m.String(); got != test.want {
+			t.Errorf("Mode(%#x).String()=%q, want %q", int(test.m), got, test.want)
+		}
+	}
+}
+
+func TestOrderString(t *testing.T) {
+	tests := []struct {
+		o    Order
+		want string
+	}{
+		{MSBFirst, "MSBFirst"},
+		{LSBFirst, "LSBFirst"},
+		{Order(2), "Order(2)"},
+	}
+	for _, test := range tests {
+		if got := test.o.String(); got != test.want {
+			t.Errorf("Order(%d).String()=%q, want %q", int(test.o), got, test.want)
+		}
+	}
+}
+
+func TestDeviceReset(t *testing.T) {
+	c := &spitest.Conn{}
+	dev, err := Open(c, 0, 0, Mode0, 1000000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := dev.SetMode(Mode3 | CSHigh); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.SetBitOrder(LSBFirst); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.SetBitsPerWord(16); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.SetMaxSpeed(20000000); err != nil {
+		t.Fatal(err)
+	}
+	n := len(c.Configs())
+	if err := dev.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	want := []spitest.Config{
+		{Key: driver.Mode, Value: 0},
+		{Key: driver.Order, Value: 0},
+		{Key: driver.Bits, Value: 8},
+		{Key: driver.Speed, Value: 1000000},
+	}
+	if got := c.Configs()[n:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Reset configured %v, want %v", got, want)
+	}
+}
+
+func TestDeviceResetError(t *testing.T) {
+	errOrder := errors.New("order rejected")
+	c := &spitest.Conn{
+		ConfigureError: func(k, v int) error {
+			if k == driver.Order {
+				return errOrder
+			}
+			return nil
+		},
+	}
+	dev := &Device{conn: c}
+	if err := dev.Reset(); err != errOrder {
+		t.Errorf("Reset()=%v, want %v", err, errOrder)
+	}
+	for _, cfg := range c.Configs() {
+		if cfg.Key == driver.Bits || cfg.Key == driver.Speed {
+			t.Errorf("Reset configured %v after the failure", cfg)
+		}
+	}
+}
+
+func TestDeviceConfigure(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	if err := dev.Configure(Config{Mode: Mode3, Bits: 16}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	want := []spitest.Config{
+		{Key: driver.Mode, Value: 3},
+		{Key: driver.Bits, Value: 16},
+	}
+	if got := c.Configs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Configs()=%v, want %v", got, want)
+	}
+}
+
+func TestDeviceConfigureError(t *testing.T) {
+	errBits := errors.New("bits rejected")
+	c := &spitest.Conn{
+		ConfigureError: func(k, v int) error {
+			if k == driver.Bits {
+				return errBits
+			}
+			return nil
+		},
+	}
+	dev := &Device{conn: c}
+	err := dev.Configure(Config{Mode: Mode1, Order: LSBFirst, Bits: 12, Speed: 1000000})
+	if !errors.Is(err, errBits) {
+		t.Fatalf("Configure=%v, want %v", err, errBits)
+	}
+	if want := "Bits: " + errBits.Error(); err.Error() != want {
+		t.Errorf("Configure error=%q, want %q", err, want)
+	}
+	for _, cfg := range c.Configs() {
+		if cfg.Key == driver.Speed {
+			t.Errorf("Configure set the speed after the failure")
+		}
+	}
+	if m, err := dev.Mode(); err != nil || m != Mode1 {
+		t.Errorf("Mode()=%v, %v, want %v, nil", m, err, Mode1)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Mode
+	}{
+		{"mode0", Mode0},
+		{"Mode3", Mode3},
+		{"mode3,cshigh,3wire", Mode3 | CSHigh | ThreeWire},
+		{"mode1, loop, nocs, ready", Mode1 | Loop | NoCS | Ready},
+		{"Mode2|CSHigh|ThreeWire", Mode2 | CSHigh | ThreeWire},
+		{"Mode0|0x100", Mode0 | 0x100},
+	}
+	for _, test := range tests {
+		m, err := ParseMode(test.s)
+		if err != nil || m != test.want {
+			t.Errorf("ParseMode(%q)=%v, %v, want %v, nil", test.s, m, err, test.want)
+		}
+	}
+	for _, m := range []Mode{Mode0, Mode3 | CSHigh, Mode1 | ThreeWire | Loop | NoCS | Ready, Mode2 | 0x800} {
+		if got, err := ParseMode(m.String()); err != nil || got != m {
+			t.Errorf("ParseMode(%q)=%v, %v, want %v, nil", m.String(), got, err, m)
+		}
+	}
+	for _, s := range []string{"", "mode4", "mode0,mode1", "cshigh", "mode0,fast", "mode0,100"} {
+		if m, err := ParseMode(s); err == nil {
+			t.Errorf("ParseMode(%q)=%v, nil, want error", s, m)
+		}
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Order
+	}{
+		{"msb", MSBFirst},
+		{"LSB", LSBFirst},
+		{"MSBFirst", MSBFirst},
+		{"lsbfirst", LSBFirst},
+	}
+	for _, test := range tests {
+		o, err := ParseOrder(test.s)
+		if err != nil || o != test.want {
+			t.Errorf("ParseOrder(%q)=%v, %v, want %v, nil", test.s, o, err, test.want)
+		}
+	}
+	for _, o := range []Order{MSBFirst, LSBFirst} {
+		if got, err := ParseOrder(o.String()); err != nil || got != o {
+			t.Errorf("ParseOrder(%q)=%v, %v, want %v, nil", o.String(), got, err, o)
+		}
+	}
+	if o, err := ParseOrder("middle"); err == nil {
+		t.Errorf("ParseOrder(\"middle\")=%v, nil, want error", o)
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// event is a recorded call, one JSON object per line in a recording.
+type event struct {
+	Op        string    `json:"op"` // open, configure, query, transfer or close
+	Bus, Chip int       `json:",omitempty"`
+	Key       int       `json:",omitempty"`
+	Value     int       `json:",omitempty"` // configured or queried value
+	Msgs      []message `json:",omitempty"`
+	Err       string    `json:",omitempty"`
+}
+
+// message is a recorded message, with the data read in Rx.
+type message struct {
+	Tx, Rx           []byte
+	Speed, Bits      int           `json:",omitempty"`
+	Delay            time.Duration `json:",omitempty"`
+	TxNBits, RxNBits int           `json:",omitempty"`
+	CSChange         bool          `json:",omitempty"`
+	NoCSChange       bool          `json:",omitempty"`
+}
+
+func messages(msgs []driver.Message) []message {
+	ms := make([]message, len(msgs))
+	for i, m := range msgs {
+		ms[i] = message{
+			Tx:         m.Tx,
+			Rx:         m.Rx,
+			Speed:      m.Speed,
+			Bits:       m.Bits,
+			Delay:      m.Delay,
+			TxNBits:    m.TxNBits,
+			RxNBits:    m.RxNBits,
+			CSChange:   m.CSChange,
+			NoCSChange: m.NoCSChange,
+		}
+	}
+	return ms
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Recorder is an SPI driver recording the calls to the connections
+// of another driver, typically spi.DevFS, and their results, to be
+// replayed by a Replayer without the devices.
+// Recorder is safe for concurrent use.
+type Recorder struct {
+	// Opener is the driver opening the recorded devices.
+	Opener driver.Opener
+	// W receives the recording. The results of the calls are
+	// returned even if the recording fails; see Err.
+	W io.Writer
+
+	mu  sync.Mutex
+	err error
+}
+
+// Open opens the device of bus and chip with the recorded driver.
+func (r *Recorder) Open(bus, chip int) (driver.Conn, error) {
+	c, err := r.Opener.Open(bus, chip)
+	r.record(event{Op: "open", Bus: bus, Chip: chip, Err: errString(err)})
+	if err != nil {
+		return nil, err
+	}
+	return &recordConn{c: c, r: r}, nil
+}
+
+// Err returns the first error writing the recording, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(ev event) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		panic(err) // events are always encodable
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	_, r.err = r.W.Write(append(b, '\n'))
+}
+
+type recordConn struct {
+	c driver.Conn
+	r *Recorder
+}
+
+func (c *recordConn) Configure(k, v int) error {
+	err := c.c.Configure(k, v)
+	c.r.record(event{Op: "configure", Key: k, Value: v, Err: errString(err)})
+	return err
+}
+
+func (c *recordConn) Query(k int) (int, error) {
+	v, err := c.c.Query(k)
+	c.r.record(event{Op: "query", Key: k, Value: v, Err: errString(err)})
+	return v, err
+}
+
+// Transfer is recorded as a transfer of a single message, but it is
+// performed with Transfer, since drivers like DevFS split the large
+// transfers that a single message of TransferMany can't hold.
+func (c *recordConn) Transfer(tx, rx []byte) error {
+	err := c.c.Transfer(tx, rx)
+	c.r.record(event{Op: "transfer", Msgs: messages([]driver.Message{{Tx: tx, Rx: rx}}), Err: errString(err)})
+	return err
+}
+
+func (c *recordConn) TransferMany(msgs []driver.Message) error {
+	err := c.c.TransferMany(msgs)
+	c.r.record(event{Op: "transfer", Msgs: messages(msgs), Err: errString(err)})
+	return err
+}
+
+func (c *recordConn) Close() error {
+	err := c.c.Close()
+	c.r.record(event{Op: "close", Err: errString(err)})
+	return err
+}
+
+// ErrMismatch is returned, wrapped, by the connections of a Replayer
+// for a call that doesn't match the recording.
+var ErrMismatch = errors.New("spitest: call does not match the recording")
+
+// Replayer is an SPI driver replaying a recording made by a Recorder:
+// each call to its connections must be the next recorded call, with the
+// same arguments, and returns the recorded results. The calls of all the
+// connections are matched against the recording in the order they are
+// made. Replayer is safe for concurrent use.
+type Replayer struct {
+	// R is the recording, read on the first Open.
+	R io.Reader
+
+	mu     sync.Mutex
+	read   bool
+	events []event
+	err    error // error reading the recording
+}
+
+// Open replays the opening of the device of bus and chip.
+func (p *Replayer) Open(bus, chip int) (driver.Conn, error) {
+	ev, err := p.next(event{Op: "open", Bus: bus, Chip: chip})
+	if err != nil {
+		return nil, err
+	}
+	if ev.Err != "" {
+		return nil, errors.New(ev.Err)
+	}
+	return &replayConn{p: p}, nil
+}
+
+// Done returns an error if the recording hasn't been replayed entirely.
+func (p *Replayer) Done() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	if len(p.events) > 0 {
+		return fmt.Errorf("%d calls not replayed, next is %s", len(p.events), p.events[0].Op)
+	}
+	return nil
+}
+
+// next returns the next recorded event if it matches want,
+// comparing all the fields except the results.
+func (p *Replayer) next(want event) (event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.read {
+		p.read = true
+		p.err = p.readEvents()
+	}
+	if p.err != nil {
+		return event{}, p.err
+	}
+	if len(p.events) == 0 {
+		return event{}, fmt.Errorf("%w: unexpected %s after the end of the recording", ErrMismatch, want.Op)
+	}
+	ev := p.events[0]
+	if err := match(ev, want); err != nil {
+		return event{}, fmt.Errorf("%w: %s: %v", ErrMismatch, want.Op, err)
+	}
+	p.events = p.events[1:]
+	return ev, nil
+}
+
+func (p *Replayer) readEvents() error {
+	d := json.NewDecoder(p.R)
+	for {
+		var ev event
+		err := d.Decode(&ev)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the recording: %w", err)
+		}
+		p.events = append(p.events, ev)
+	}
+}
+
+// match returns an error describing the first difference between the
+// recorded event ev and the call want.
+func match(ev, want event) error {
+	switch {
+	case ev.Op != want.Op:
+		return fmt.Errorf("recorded %s", ev.Op)
+	case ev.Bus != want.Bus || ev.Chip != want.Chip:
+		return fmt.Errorf("recorded bus %d chip %d", ev.Bus, ev.Chip)
+	case ev.Key != want.Key:
+		return fmt.Errorf("recorded key %d", ev.Key)
+	case want.Op == "configure" && ev.Value != want.Value:
+		return fmt.Errorf("recorded value %d", ev.Value)
+	case len(ev.Msgs) != len(want.Msgs):
+		return fmt.Errorf("recorded %d messages", len(ev.Msgs))
+	}
+	for i, m := range ev.Msgs {
+		w := want.Msgs[i]
+		if !bytes.Equal(m.Tx, w.Tx) || (m.Tx == nil) != (w.Tx == nil) {
+			return fmt.Errorf("message %d: recorded tx % x", i, m.Tx)
+		}
+		if len(m.Rx) != len(w.Rx) || (m.Rx == nil) != (w.Rx == nil) {
+			return fmt.Errorf("message %d: recorded %d bytes read", i, len(m.Rx))
+		}
+		if m.Speed != w.Speed || m.Bits != w.Bits || m.Delay != w.Delay ||
+			m.TxNBits != w.TxNBits || m.RxNBits != w.RxNBits ||
+			m.CSChange != w.CSChange || m.NoCSChange != w.NoCSChange {
+			return fmt.Errorf("message %d: recorded speed %d, bits %d, delay %v, lines %d/%d, cs_change %t/%t",
+				i, m.Speed, m.Bits, m.Delay, m.TxNBits, m.RxNBits, m.CSChange, m.NoCSChange)
+		}
+	}
+	return nil
+}
+
+type replayConn struct {
+	p *Replayer
+}
+
+func (c *replayConn) Configure(k, v int) error {
+	ev, err := c.p.next(event{Op: "configure", Key: k, Value: v})
+	if err != nil {
+		return err
+	}
+	if ev.Err != "" {
+		return errors.New(ev.Err)
+	}
+	return nil
+}
+
+func (c *replayConn) Query(k int) (int, error) {
+	ev, err := c.p.next(event{Op: "query", Key: k})
+	if err != nil {
+		return 0, err
+	}
+	if ev.Err != "" {
+		return ev.Value, errors.New(ev.Err)
+	}
+	return ev.Value, nil
+}
+
+func (c *replayConn) Transfer(tx, rx []byte) error {
+	return c.TransferMany([]driver.Message{{Tx: tx, Rx: rx}})
+}
+
+func (c *replayConn) TransferMany(msgs []driver.Message) error {
+	ev, err := c.p.next(event{Op: "transfer", Msgs: messages(msgs)})
+	if err != nil {
+		return err
+	}
+	for i, m := range msgs {
+		copy(m.Rx, ev.Msgs[i].Rx)
+	}
+	if ev.Err != "" {
+		return errors.New(ev.Err)
+	}
+	return nil
+}
+
+func (c *replayConn) Close() error {
+	ev, err := c.p.next(event{Op: "close"})
+	if err != nil {
+		return err
+	}
+	if ev.Err != "" {
+		return errors.New(ev.Err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spitest_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/io/spi"
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// session is a use of a device: it sets the mode, reads the
+// identification of a flash memory chip and writes a register.
+func session(o driver.Opener) ([]byte, error) {
+	dev, err := spi.Open(o, 0, 1, spi.Mode3, 1000000)
+	if err != nil {
+		return nil, err
+	}
+	defer dev.Close()
+	id := make([]byte, 3)
+	if err := dev.WriteThenRead([]byte{0x9f}, id); err != nil {
+		return nil, err
+	}
+	if bits, err := dev.BitsPerWord(); err != nil || bits != 8 {
+		return nil, errors.New("unexpected bits per word")
+	}
+	if err := dev.TxMany([]spi.Message{{Tx: []byte{0x06}}, {Tx: []byte{0x01, 0x02}, Speed: 500000}}); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Respond(nil, []byte{0xef, 0x40, 0x18})
+	c.Configure(driver.Bits, 8)
+	var rec bytes.Buffer
+	r := &spitest.Recorder{Opener: c, W: &rec}
+	id, err := session(r)
+	if err != nil {
+		t.Fatalf("recorded session: %v", err)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+
+	p := &spitest.Replayer{R: bytes.NewReader(rec.Bytes())}
+	got, err := session(p)
+	if err != nil {
+		t.Fatalf("replayed session: %v", err)
+	}
+	if !bytes.Equal(got, id) {
+		t.Errorf("replayed id=% x, want % x", got, id)
+	}
+	if err := p.Done(); err != nil {
+		t.Errorf("Done: %v", err)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	c := &spitest.Conn{}
+	var rec bytes.Buffer
+	r := &spitest.Recorder{Opener: c, W: &rec}
+	dev, err := spi.Open(r, 0, 0, spi.Mode0, 1000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Transfer([]byte{1, 2}, make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		use  func(dev *spi.Device) error
+		want string
+	}{
+		{"different tx", func(dev *spi.Device) error {
+			return dev.Transfer([]byte{1, 3}, make([]byte, 2))
+		}, "recorded tx"},
+		{"different call", func(dev *spi.Device) error {
+			return dev.SetBitsPerWord(16)
+		}, "recorded transfer"},
+		{"different length", func(dev *spi.Device) error {
+			return dev.Transfer([]byte{1, 2, 3}, make([]byte, 3))
+		}, "recorded tx"},
+		{"extra call", func(dev *spi.Device) error {
+			if err := dev.Transfer([]byte{1, 2}, make([]byte, 2)); err != nil {
+				return err
+			}
+			if err := dev.Close(); err != nil {
+				return err
+			}
+			return dev.Close()
+		}, "after the end of the recording"},
+	}
+	for _, test := range tests {
+		p := &spitest.Replayer{R: bytes.NewReader(rec.Bytes())}
+		dev, err := spi.Open(p, 0, 0, spi.Mode0, 1000000)
+		if err != nil {
+			t.Fatalf("%s: Open: %v", test.name, err)
+		}
+		err = test.use(dev)
+		if !errors.Is(err, spitest.ErrMismatch) || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want %v containing %q", test.name, err, spitest.ErrMismatch, test.want)
+		}
+	}
+
+	p := &spitest.Replayer{R: bytes.NewReader(rec.Bytes())}
+	if _, err := spi.Open(p, 0, 1, spi.Mode0, 1000000); !errors.Is(err, spitest.ErrMismatch) {
+		t.Errorf("Open of another chip=%v, want %v", err, spitest.ErrMismatch)
+	}
+	p = &spitest.Replayer{R: bytes.NewReader(rec.Bytes())}
+	if _, err := spi.Open(p, 0, 0, spi.Mode0, 1000000); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Done(); err == nil {
+		t.Errorf("Done with calls left succeeded, want error")
+	}
+}
+
+// transferOnlyConn is a connection whose TransferMany fails, like the
+// drivers that can only perform large transfers with Transfer.
+type transferOnlyConn struct {
+	*spitest.Conn
+}
+
+func (c transferOnlyConn) Open(bus, chip int) (driver.Conn, error) {
+	if _, err := c.Conn.Open(bus, chip); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c transferOnlyConn) TransferMany(msgs []driver.Message) error {
+	return errors.New("TransferMany called")
+}
+
+func TestRecordTransfer(t *testing.T) {
+	c := transferOnlyConn{&spitest.Conn{}}
+	c.Respond([]byte{1, 2, 3})
+	var rec bytes.Buffer
+	r := &spitest.Recorder{Opener: c, W: &rec}
+	dev, err := spi.Open(r, 0, 0, spi.Mode0, 1000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx := make([]byte, 3)
+	if err := dev.Transfer([]byte{4, 5, 6}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &spitest.Replayer{R: bytes.NewReader(rec.Bytes())}
+	dev, err = spi.Open(p, 0, 0, spi.Mode0, 1000000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got := make([]byte, 3)
+	if err := dev.Transfer([]byte{4, 5, 6}, got); err != nil {
+		t.Fatalf("replayed Transfer: %v", err)
+	}
+	if !bytes.Equal(got, rx) {
+		t.Errorf("replayed rx=% x, want % x", got, rx)
+	}
+}
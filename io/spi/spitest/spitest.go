@@ -0,0 +1,184 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package spitest provides an in-memory SPI driver for testing
+// code that uses the spi package without an SPI device, and drivers
+// recording the use of a device and replaying it.
+package spitest // import "golang.org/x/exp/io/spi/spitest"
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// Config is a recorded Configure call.
+type Config struct {
+	Key, Value int
+}
+
+// Conn is an SPI driver that records the configuration and the
+// transfers and reads scripted responses. Conn is both a driver.Opener,
+// which opens the Conn itself, and a driver.Conn.
+// It is safe for concurrent use.
+//
+// The zero value is a connection that reads zeros.
+type Conn struct {
+	// Reply, if non-nil, returns the bytes read during the transfer
+	// of tx when no response is queued with Respond. If the reply
+	// is shorter than tx, the remaining bytes read are zero. For a
+	// message with a nil Tx, tx is the zeros written instead.
+	Reply func(tx []byte) []byte
+
+	// ConfigureError, if non-nil, is called by Configure and its
+	// non-nil results are returned without applying the value.
+	ConfigureError func(k, v int) error
+
+	// TransferError, if non-nil, is called for each message by Transfer
+	// and TransferMany and its non-nil results are returned without
+	// performing the transfer.
+	TransferError func(m driver.Message) error
+
+	mu        sync.Mutex
+	bus, chip int
+	values    map[int]int
+	configs   []Config
+	transfers []driver.Message
+	responses [][]byte
+	closed    bool
+}
+
+// ErrClosed is returned when using a closed connection.
+var ErrClosed = errors.New("spitest: connection closed")
+
+// Open opens c, recording the bus and chip number, and returns c.
+func (c *Conn) Open(bus, chip int) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bus, c.chip = bus, chip
+	c.closed = false
+	return c, nil
+}
+
+// Respond queues responses to be read by the next transfers,
+// one per message. A response shorter than the message leaves
+// the remaining bytes read zero.
+func (c *Conn) Respond(rx ...[]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range rx {
+		c.responses = append(c.responses, append([]byte(nil), r...))
+	}
+}
+
+func (c *Conn) Configure(k, v int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if c.ConfigureError != nil {
+		if err := c.ConfigureError(k, v); err != nil {
+			return err
+		}
+	}
+	c.configs = append(c.configs, Config{Key: k, Value: v})
+	if c.values == nil {
+		c.values = make(map[int]int)
+	}
+	c.values[k] = v
+	return nil
+}
+
+// Query returns the last value configured for k, or 0.
+func (c *Conn) Query(k int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, ErrClosed
+	}
+	return c.values[k], nil
+}
+
+func (c *Conn) Transfer(tx, rx []byte) error {
+	return c.TransferMany([]driver.Message{{Tx: tx, Rx: rx}})
+}
+
+func (c *Conn) TransferMany(msgs []driver.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	for i, m := range msgs {
+		if m.Tx != nil && m.Rx != nil && len(m.Rx) != len(m.Tx) {
+			return fmt.Errorf("message %d: rx length (%d) does not match tx length (%d)", i, len(m.Rx), len(m.Tx))
+		}
+		if c.TransferError != nil {
+			if err := c.TransferError(m); err != nil {
+				return err
+			}
+		}
+	}
+	for _, m := range msgs {
+		var r []byte
+		switch {
+		case len(c.responses) > 0:
+			r, c.responses = c.responses[0], c.responses[1:]
+		case c.Reply != nil && m.Tx == nil:
+			r = c.Reply(make([]byte, len(m.Rx)))
+		case c.Reply != nil:
+			r = c.Reply(m.Tx)
+		}
+		n := copy(m.Rx, r)
+		for i := n; i < len(m.Rx); i++ {
+			m.Rx[i] = 0
+		}
+		m.Tx = append([]byte(nil), m.Tx...)
+		m.Rx = append([]byte(nil), m.Rx...)
+		c.transfers = append(c.transfers, m)
+	}
+	return nil
+}
+
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	c.closed = true
+	return nil
+}
+
+// Bus returns the bus and chip numbers that c was opened with.
+func (c *Conn) Bus() (bus, chip int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bus, c.chip
+}
+
+// Configs returns the recorded successful Configure calls.
+func (c *Conn) Configs() []Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Config(nil), c.configs...)
+}
+
+// Transfers returns the recorded messages of the successful transfers,
+// with copies of the written and the read bytes.
+func (c *Conn) Transfers() []driver.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]driver.Message(nil), c.transfers...)
+}
+
+// Closed returns whether c is closed.
+func (c *Conn) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spitest_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi"
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestConn(t *testing.T) {
+	c := &spitest.Conn{}
+	dev, err := spi.Open(c, 1, 2, spi.Mode3, 500000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if bus, chip := c.Bus(); bus != 1 || chip != 2 {
+		t.Errorf("Bus()=%d, %d, want 1, 2", bus, chip)
+	}
+	c.Respond([]byte{0xaa, 0xbb})
+	rx := make([]byte, 2)
+	if err := dev.Transfer([]byte{1, 2}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !bytes.Equal(rx, []byte{0xaa, 0xbb}) {
+		t.Errorf("rx=% x, want aa bb", rx)
+	}
+	c.Reply = func(tx []byte) []byte { return []byte{tx[0] + 1} }
+	if err := dev.Transfer([]byte{7, 8}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !bytes.Equal(rx, []byte{8, 0}) {
+		t.Errorf("rx=% x, want 08 00", rx)
+	}
+
+	wantConfigs := []spitest.Config{{driver.Mode, 3}, {driver.Speed, 500000}}
+	if got := c.Configs(); !reflect.DeepEqual(got, wantConfigs) {
+		t.Errorf("Configs()=%v, want %v", got, wantConfigs)
+	}
+	wantTransfers := []driver.Message{
+		{Tx: []byte{1, 2}, Rx: []byte{0xaa, 0xbb}},
+		{Tx: []byte{7, 8}, Rx: []byte{8, 0}},
+	}
+	if got := c.Transfers(); !reflect.DeepEqual(got, wantTransfers) {
+		t.Errorf("Transfers()=%v, want %v", got, wantTransfers)
+	}
+	if m, err := dev.Mode(); err != nil || m != spi.Mode3 {
+		t.Errorf("Mode()=%v, %v, want %v, nil", m, err, spi.Mode3)
+	}
+
+	if err := dev.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !c.Closed() {
+		t.Errorf("Closed()=false after Close, want true")
+	}
+	if err := dev.Transfer(nil, nil); err != spitest.ErrClosed {
+		t.Errorf("Transfer after Close=%v, want %v", err, spitest.ErrClosed)
+	}
+}
+
+func TestConnErrors(t *testing.T) {
+	errSpeed := errors.New("speed rejected")
+	errBusy := errors.New("busy")
+	c := &spitest.Conn{
+		ConfigureError: func(k, v int) error {
+			if k == driver.Speed && v > 1000000 {
+				return errSpeed
+			}
+			return nil
+		},
+		TransferError: func(m driver.Message) error {
+			if len(m.Tx) > 2 {
+				return errBusy
+			}
+			return nil
+		},
+	}
+	if _, err := spi.Open(c, 0, 0, spi.Mode0, 2000000); err != errSpeed {
+		t.Errorf("Open with 2MHz=%v, want %v", err, errSpeed)
+	}
+	dev, err := spi.Open(c, 0, 0, spi.Mode0, 1000000)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := dev.Transfer(make([]byte, 3), make([]byte, 3)); err != errBusy {
+		t.Errorf("Transfer of 3 bytes=%v, want %v", err, errBusy)
+	}
+	if n := len(c.Transfers()); n != 0 {
+		t.Errorf("got %d recorded transfers, want 0", n)
+	}
+}
+
+func TestConnReplyNilTx(t *testing.T) {
+	c := &spitest.Conn{}
+	var got []byte
+	c.Reply = func(tx []byte) []byte {
+		got = tx
+		return []byte{1, 2}
+	}
+	rx := make([]byte, 2)
+	if err := c.Transfer(nil, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !bytes.Equal(got, []byte{0, 0}) {
+		t.Errorf("Reply got tx % x, want the zeros written", got)
+	}
+	if !bytes.Equal(rx, []byte{1, 2}) {
+		t.Errorf("rx=% x, want 01 02", rx)
+	}
+}
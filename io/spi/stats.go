@@ -0,0 +1,109 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// Stats are the statistics of the use of a device, see Device.Stats.
+type Stats struct {
+	// Transfers is the number of transfers; the messages
+	// of TxMany and of the other batched transfers count as one.
+	Transfers int64
+	// BytesOut and BytesIn are the numbers of bytes
+	// written from the tx buffers and read to the rx buffers.
+	BytesOut, BytesIn int64
+	// Time is the time spent in the transfers of the driver,
+	// e.g. in the ioctls of DevFS.
+	Time time.Duration
+	// Errors is the number of failed transfers
+	// and configuration changes.
+	Errors int64
+	// Retries is the number of attempts of the transfers
+	// retried after a transient error, see SetRetry.
+	Retries int64
+}
+
+// deviceStats are the counters of Stats, updated atomically.
+type deviceStats struct {
+	transfers atomic.Int64
+	bytesOut  atomic.Int64
+	bytesIn   atomic.Int64
+	time      atomic.Int64
+	errors    atomic.Int64
+	retries   atomic.Int64
+}
+
+// Stats returns the statistics of the transfers and configuration
+// changes of the device since it was opened. It is safe to call
+// concurrently with the other methods of the device.
+func (d *Device) Stats() Stats {
+	return Stats{
+		Transfers: d.stats.transfers.Load(),
+		BytesOut:  d.stats.bytesOut.Load(),
+		BytesIn:   d.stats.bytesIn.Load(),
+		Time:      time.Duration(d.stats.time.Load()),
+		Errors:    d.stats.errors.Load(),
+		Retries:   d.stats.retries.Load(),
+	}
+}
+
+// configure sets the configuration key k to v, counting the errors.
+func (d *Device) configure(k, v int) error {
+	err := d.conn.Configure(k, v)
+	if err != nil {
+		d.stats.errors.Add(1)
+	}
+	return err
+}
+
+// transfer performs Transfer with the driver, updating the statistics.
+// In a transaction begun with BeginTransaction, it is performed with
+// messages holding the chip select, see heldTransfer.
+func (d *Device) transfer(tx, rx []byte) error {
+	if d.held.Load() != nil {
+		return d.heldTransfer(tx, rx)
+	}
+	start := time.Now()
+	err := d.retry(func() error { return d.conn.Transfer(tx, rx) })
+	d.count(start, len(tx), len(rx), err)
+	return err
+}
+
+// transferMany performs TransferMany with the driver, updating the
+// statistics. In a transaction begun with BeginTransaction, the last
+// message holds the chip select.
+func (d *Device) transferMany(msgs []driver.Message) error {
+	return d.send(d.holdCS(msgs))
+}
+
+// send performs TransferMany with the driver,
+// updating the statistics.
+func (d *Device) send(msgs []driver.Message) error {
+	start := time.Now()
+	err := d.retry(func() error { return d.conn.TransferMany(msgs) })
+	out, in := 0, 0
+	for _, m := range msgs {
+		out += len(m.Tx)
+		in += len(m.Rx)
+	}
+	d.count(start, out, in, err)
+	return err
+}
+
+func (d *Device) count(start time.Time, out, in int, err error) {
+	d.stats.time.Add(int64(time.Since(start)))
+	d.stats.transfers.Add(1)
+	if err != nil {
+		d.stats.errors.Add(1)
+		return
+	}
+	d.stats.bytesOut.Add(int64(out))
+	d.stats.bytesIn.Add(int64(in))
+}
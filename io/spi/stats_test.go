@@ -0,0 +1,56 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestStats(t *testing.T) {
+	fail := false
+	c := &spitest.Conn{
+		ConfigureError: func(k, v int) error {
+			if k == driver.Bits {
+				return errors.New("bits rejected")
+			}
+			return nil
+		},
+		TransferError: func(driver.Message) error {
+			if fail {
+				return errors.New("bus error")
+			}
+			return nil
+		},
+	}
+	dev := &Device{conn: c}
+	for i := 0; i < 3; i++ {
+		if err := dev.Transfer([]byte{1, 2}, make([]byte, 2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dev.TxMany([]Message{{Tx: []byte{1}}, {Rx: make([]byte, 4)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.WriteThenRead([]byte{0x9f}, make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	dev.SetBitsPerWord(9)
+	fail = true
+	dev.Transfer([]byte{1}, make([]byte, 1))
+
+	s := dev.Stats()
+	want := Stats{Transfers: 6, BytesOut: 3*2 + 1 + 1, BytesIn: 3*2 + 4 + 3, Errors: 2}
+	if s.Time < 0 {
+		t.Errorf("Time=%v, want >= 0", s.Time)
+	}
+	s.Time = 0
+	if s != want {
+		t.Errorf("Stats()=%+v, want %+v", s, want)
+	}
+}
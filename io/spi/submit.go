@@ -0,0 +1,107 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import "time"
+
+// submitQueueLen is the number of pending submitted transfers
+// after which Submit blocks.
+const submitQueueLen = 64
+
+// submission is a transfer submitted with Submit,
+// or a barrier queued by Flush.
+type submission struct {
+	tx, rx []byte
+	delay  time.Duration
+	flush  bool
+	done   chan error
+}
+
+// queue is the queue of the submitted transfers.
+type queue struct {
+	c      chan submission
+	done   chan struct{} // closed when the worker returns
+	closed bool
+}
+
+// Submit queues the transfer of tx and rx, followed by a pause of
+// delay if non-zero, and returns a channel receiving its result. The
+// submitted transfers are performed in order, one at a time, by a
+// goroutine of the device; Submit only blocks when many transfers are
+// pending. tx and rx must not be used until the result is received.
+//
+// Close waits for the pending transfers to complete. The transfers
+// submitted after Close fail with ErrClosed.
+func (d *Device) Submit(tx, rx []byte, delay time.Duration) <-chan error {
+	done := make(chan error, 1)
+	d.queueMu.Lock()
+	defer d.queueMu.Unlock()
+	if d.queue.closed {
+		done <- ErrClosed
+		return done
+	}
+	if d.queue.c == nil {
+		d.queue.c = make(chan submission, submitQueueLen)
+		d.queue.done = make(chan struct{})
+		go d.work(d.queue.c, d.queue.done)
+	}
+	d.queue.c <- submission{tx: tx, rx: rx, delay: delay, done: done}
+	return done
+}
+
+// Flush waits for the transfers submitted with Submit before it to be
+// performed, and returns the first error of the submitted transfers
+// performed since the previous Flush. The other transfers of d, such
+// as Transfer, TxMany and the ones of ReadWriter, are performed before
+// they return, so Flush returns nil right away when nothing was
+// submitted. After Close, Flush returns ErrClosed.
+func (d *Device) Flush() error {
+	d.queueMu.Lock()
+	if d.queue.closed {
+		d.queueMu.Unlock()
+		return ErrClosed
+	}
+	if d.queue.c == nil {
+		d.queueMu.Unlock()
+		return nil
+	}
+	done := make(chan error, 1)
+	d.queue.c <- submission{flush: true, done: done}
+	d.queueMu.Unlock()
+	return <-done
+}
+
+// work performs the submitted transfers of c until it is closed,
+// and then closes done.
+func (d *Device) work(c <-chan submission, done chan<- struct{}) {
+	defer close(done)
+	var first error // the first error since the last flush
+	for s := range c {
+		if s.flush {
+			s.done <- first
+			first = nil
+			continue
+		}
+		err := d.transferMany([]Message{{Tx: s.tx, Rx: s.rx, Delay: s.delay}})
+		if first == nil {
+			first = err
+		}
+		s.done <- err
+	}
+}
+
+// closeQueue stops accepting submissions and
+// waits for the pending ones to complete.
+func (d *Device) closeQueue() {
+	d.queueMu.Lock()
+	closed := d.queue.closed
+	d.queue.closed = true
+	c, done := d.queue.c, d.queue.done
+	d.queueMu.Unlock()
+	if !closed && c != nil {
+		close(c)
+		<-done
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestSubmit(t *testing.T) {
+	c := &spitest.Conn{}
+	c.Reply = func(tx []byte) []byte { return []byte{tx[0] + 1} }
+	dev := &Device{conn: c}
+	var results []<-chan error
+	var rxs [][]byte
+	for i := 0; i < 10; i++ {
+		rx := make([]byte, 1)
+		rxs = append(rxs, rx)
+		results = append(results, dev.Submit([]byte{byte(i)}, rx, time.Duration(i)*time.Microsecond))
+	}
+	for i, r := range results {
+		if err := <-r; err != nil {
+			t.Errorf("transfer %d: %v", i, err)
+		}
+		if rxs[i][0] != byte(i+1) {
+			t.Errorf("transfer %d: rx=%d, want %d", i, rxs[i][0], i+1)
+		}
+	}
+	ts := c.Transfers()
+	if len(ts) != 10 {
+		t.Fatalf("got %d transfers, want 10", len(ts))
+	}
+	for i, m := range ts {
+		if m.Tx[0] != byte(i) || m.Delay != time.Duration(i)*time.Microsecond {
+			t.Errorf("transfer %d: tx=%d delay=%v, want %d, %v", i, m.Tx[0], m.Delay, i, time.Duration(i)*time.Microsecond)
+		}
+	}
+}
+
+func TestSubmitClose(t *testing.T) {
+	release := make(chan struct{})
+	c := &spitest.Conn{
+		TransferError: func(driver.Message) error {
+			<-release
+			return nil
+		},
+	}
+	dev := &Device{conn: c}
+	var results []<-chan error
+	for i := 0; i < 3; i++ {
+		results = append(results, dev.Submit([]byte{byte(i)}, make([]byte, 1), 0))
+	}
+	closed := make(chan error)
+	go func() { closed <- dev.Close() }()
+	select {
+	case <-closed:
+		t.Fatalf("Close returned with pending transfers")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	for i, r := range results {
+		if err := <-r; err != nil {
+			t.Errorf("transfer %d: %v", i, err)
+		}
+	}
+	if n := len(c.Transfers()); n != 3 {
+		t.Errorf("got %d transfers, want the 3 pending ones", n)
+	}
+	if err := <-dev.Submit([]byte{1}, make([]byte, 1), 0); err != ErrClosed {
+		t.Errorf("Submit after Close=%v, want %v", err, ErrClosed)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	if err := dev.Flush(); err != nil {
+		t.Errorf("Flush() without submissions=%v, want nil", err)
+	}
+	for i := 0; i < 5; i++ {
+		dev.Submit([]byte{byte(i)}, make([]byte, 1), 0)
+	}
+	if err := dev.Flush(); err != nil {
+		t.Errorf("Flush()=%v, want nil", err)
+	}
+	if n := len(c.Transfers()); n != 5 {
+		t.Errorf("got %d transfers after Flush, want 5", n)
+	}
+
+	errBoom := errors.New("boom")
+	c.TransferError = func(m driver.Message) error {
+		if m.Tx[0] >= 6 {
+			return fmt.Errorf("%w %d", errBoom, m.Tx[0])
+		}
+		return nil
+	}
+	for i := 5; i < 8; i++ {
+		dev.Submit([]byte{byte(i)}, make([]byte, 1), 0)
+	}
+	if err := dev.Flush(); err == nil || err.Error() != "boom 6" {
+		t.Errorf("Flush()=%v, want boom 6", err)
+	}
+	if err := dev.Flush(); err != nil {
+		t.Errorf("second Flush()=%v, want nil", err)
+	}
+
+	dev.Close()
+	if err := dev.Flush(); err != ErrClosed {
+		t.Errorf("Flush() after Close=%v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+// Write3Wire writes tx to a device in 3-wire mode, see SetThreeWire,
+// with a message that has no Rx buffer, so that the transfer is a
+// write phase only.
+func (d *Device) Write3Wire(tx []byte) error {
+	return d.TxMany([]Message{{Tx: tx}})
+}
+
+// Read3Wire reads n bytes from a device in 3-wire mode, see
+// SetThreeWire, with a message that has no Tx buffer. The devfs
+// driver then leaves tx_buf null, which the kernel drivers take for a
+// read phase: the controller stops driving the shared data line, so
+// that it doesn't drive it at the same time as the device.
+func (d *Device) Read3Wire(n int) ([]byte, error) {
+	rx := make([]byte, n)
+	if err := d.TxMany([]Message{{Rx: rx}}); err != nil {
+		return nil, err
+	}
+	return rx, nil
+}
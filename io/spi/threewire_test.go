@@ -0,0 +1,65 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// threeWireConn returns a connection rejecting the messages that
+// would both write and read the shared data line.
+func threeWireConn() *spitest.Conn {
+	return &spitest.Conn{
+		TransferError: func(m driver.Message) error {
+			if m.Tx != nil && m.Rx != nil {
+				return errors.New("bus contention")
+			}
+			return nil
+		},
+	}
+}
+
+func TestDeviceWrite3Wire(t *testing.T) {
+	c := threeWireConn()
+	dev := &Device{conn: c}
+	if err := dev.SetThreeWire(true); err != nil {
+		t.Fatalf("SetThreeWire: %v", err)
+	}
+	if err := dev.Write3Wire([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("Write3Wire: %v", err)
+	}
+	ts := c.Transfers()
+	if len(ts) != 1 || !reflect.DeepEqual(ts[0].Tx, []byte{1, 2, 3}) || ts[0].Rx != nil {
+		t.Errorf("transfers=%v, want a single write of 01 02 03", ts)
+	}
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err == nil {
+		t.Errorf("duplex Transfer succeeded on a 3-wire bus, want error")
+	}
+}
+
+func TestDeviceRead3Wire(t *testing.T) {
+	c := threeWireConn()
+	c.Respond([]byte{4, 5})
+	dev := &Device{conn: c}
+	if err := dev.SetThreeWire(true); err != nil {
+		t.Fatalf("SetThreeWire: %v", err)
+	}
+	rx, err := dev.Read3Wire(2)
+	if err != nil {
+		t.Fatalf("Read3Wire: %v", err)
+	}
+	if !reflect.DeepEqual(rx, []byte{4, 5}) {
+		t.Errorf("Read3Wire(2)=% x, want 04 05", rx)
+	}
+	ts := c.Transfers()
+	if len(ts) != 1 || ts[0].Tx != nil || len(ts[0].Rx) != 2 {
+		t.Errorf("transfers=%v, want a single read of 2 bytes", ts)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import "golang.org/x/exp/io/spi/driver"
+
+// TraceEvent describes a configuration change or a transfer
+// of a device, see SetTracer.
+type TraceEvent struct {
+	// Msgs holds the messages of a transfer; Transfer is traced as
+	// a single message. It is nil for a configuration change.
+	// The buffers of the messages must not be retained.
+	Msgs []Message
+
+	// Key and Value are the driver configuration key and value
+	// of a configuration change, e.g. driver.Speed.
+	Key, Value int
+
+	// Err is the error returned by the driver.
+	Err error
+}
+
+// SetTracer sets a function called after each configuration change
+// and transfer of the device, for instance to log them. A nil function
+// disables tracing, which is the default. It must not be called
+// concurrently with other methods of the device.
+func (d *Device) SetTracer(f func(ev TraceEvent)) {
+	if tc, ok := d.conn.(*tracingConn); ok {
+		d.conn = tc.Conn
+	}
+	if f != nil {
+		d.conn = &tracingConn{Conn: d.conn, trace: f}
+	}
+}
+
+// tracingConn is a connection calling trace after the
+// configuration changes and the transfers of Conn.
+type tracingConn struct {
+	driver.Conn
+	trace func(ev TraceEvent)
+}
+
+func (c *tracingConn) Configure(k, v int) error {
+	err := c.Conn.Configure(k, v)
+	c.trace(TraceEvent{Key: k, Value: v, Err: err})
+	return err
+}
+
+func (c *tracingConn) Transfer(tx, rx []byte) error {
+	err := c.Conn.Transfer(tx, rx)
+	c.trace(TraceEvent{Msgs: []Message{{Tx: tx, Rx: rx}}, Err: err})
+	return err
+}
+
+func (c *tracingConn) TransferMany(msgs []driver.Message) error {
+	err := c.Conn.TransferMany(msgs)
+	c.trace(TraceEvent{Msgs: msgs, Err: err})
+	return err
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestSetTracer(t *testing.T) {
+	errSpeed := errors.New("speed rejected")
+	c := &spitest.Conn{
+		ConfigureError: func(k, v int) error {
+			if k == driver.Speed {
+				return errSpeed
+			}
+			return nil
+		},
+	}
+	c.Respond([]byte{0xaa, 0xbb})
+	dev := &Device{conn: c}
+	var evs []TraceEvent
+	dev.SetTracer(func(ev TraceEvent) {
+		evs = append(evs, ev)
+	})
+
+	if err := dev.SetMode(Mode3); err != nil {
+		t.Fatal(err)
+	}
+	dev.SetMaxSpeed(1000000)
+	rx := make([]byte, 2)
+	if err := dev.Transfer([]byte{1, 2}, rx); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.TxMany([]Message{{Tx: []byte{3}, Rx: make([]byte, 1)}, {Tx: []byte{4}, Rx: make([]byte, 1)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(evs) != 4 {
+		t.Fatalf("got %d events, want 4", len(evs))
+	}
+	if ev := evs[0]; ev.Key != driver.Mode || ev.Value != 3 || ev.Err != nil || ev.Msgs != nil {
+		t.Errorf("event 0=%+v, want the mode change", ev)
+	}
+	if ev := evs[1]; ev.Key != driver.Speed || ev.Value != 1000000 || ev.Err != errSpeed {
+		t.Errorf("event 1=%+v, want the failed speed change", ev)
+	}
+	if ev := evs[2]; len(ev.Msgs) != 1 || !bytes.Equal(ev.Msgs[0].Tx, []byte{1, 2}) || !bytes.Equal(ev.Msgs[0].Rx, []byte{0xaa, 0xbb}) {
+		t.Errorf("event 2=%+v, want the transfer", ev)
+	}
+	if ev := evs[3]; len(ev.Msgs) != 2 {
+		t.Errorf("event 3=%+v, want the 2 messages", ev)
+	}
+
+	dev.SetTracer(nil)
+	if _, ok := dev.conn.(*tracingConn); ok {
+		t.Errorf("SetTracer(nil) left the tracing connection")
+	}
+	if err := dev.SetMode(Mode0); err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 4 {
+		t.Errorf("got %d events after disabling tracing, want 4", len(evs))
+	}
+}
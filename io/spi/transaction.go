@@ -0,0 +1,168 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"errors"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+var (
+	// errEnded is returned by the methods of a Transaction after End.
+	errEnded = errors.New("spi: transaction ended")
+	// errBegun and errNotBegun are returned by BeginTransaction
+	// and EndTransaction.
+	errBegun    = errors.New("spi: transaction already begun")
+	errNotBegun = errors.New("spi: no transaction")
+)
+
+// Transaction is a sequence of transfers performed with the
+// chip select of the device held asserted, for the protocols where
+// the next transfer depends on the data read by the previous ones.
+//
+// The chip select is held reliably by the drivers that control it
+// themselves, such as GPIO, and by the functions set with SetChipSelect,
+// typically with the NoCS mode flag. With DevFS, the transfers are
+// messages with cs_change set, which only asks the kernel to leave the
+// chip select asserted after them: it is honored by most controllers,
+// but the bus may be used for another device in between.
+type Transaction struct {
+	d     *Device
+	cs    *chipSelectConn // the chip select of the device, or nil
+	ended bool
+}
+
+// Begin begins a transaction with the device, asserting the chip select
+// with the function set with SetChipSelect, if any. The device must not
+// be used by other transfers until the transaction ends.
+func (d *Device) Begin() (*Transaction, error) {
+	t := &Transaction{d: d}
+	if err := t.begin(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// begin asserts the chip select of the transaction
+// with the function set with SetChipSelect, if any.
+func (t *Transaction) begin() error {
+	c := t.d.conn
+	if tc, ok := c.(*tracingConn); ok {
+		c = tc.Conn
+	}
+	if cc, ok := c.(*chipSelectConn); ok {
+		if cc.assert != nil {
+			if err := cc.assert(); err != nil {
+				return err
+			}
+		}
+		cc.held = true
+		t.cs = cc
+	}
+	return nil
+}
+
+// Transfer is like Device.Transfer but leaves the chip select
+// asserted afterwards.
+func (t *Transaction) Transfer(tx, rx []byte) error {
+	if t.ended {
+		return errEnded
+	}
+	return t.d.heldTransfer(tx, rx)
+}
+
+// heldTransfer performs a transfer of tx and rx with messages leaving
+// the chip select asserted. Like Transfer with DevFS, buffers larger
+// than MaxTransferSize are split in several requests, each one
+// holding the chip select.
+func (d *Device) heldTransfer(tx, rx []byte) error {
+	l, err := transferLen(tx, rx)
+	if err != nil {
+		return err
+	}
+	n := d.MaxTransferSize()
+	if bits, err := d.BitsPerWord(); err == nil && n > 0 {
+		if w := wordSize(bits); n >= w {
+			n -= n % w
+		}
+	}
+	for ; n > 0 && l > n; l -= n {
+		if err := d.send([]Message{{Tx: head(tx, n), Rx: head(rx, n), CSChange: true}}); err != nil {
+			return err
+		}
+		tx, rx = tail(tx, n), tail(rx, n)
+	}
+	return d.send([]Message{{Tx: tx, Rx: rx, CSChange: true}})
+}
+
+// End ends the transaction and deasserts the chip select,
+// with an empty transfer and the function set with SetChipSelect,
+// if any. It returns the first error of both.
+func (t *Transaction) End() error {
+	if t.ended {
+		return errEnded
+	}
+	t.ended = true
+	// The empty message clears cs_change, whatever the default set
+	// with SetCSChange and even if the device is in another
+	// transaction begun with BeginTransaction.
+	err := t.d.send([]Message{{NoCSChange: true}})
+	if t.cs != nil {
+		t.cs.held = false
+		if t.cs.deassert != nil {
+			if derr := t.cs.deassert(); err == nil {
+				err = derr
+			}
+		}
+	}
+	return err
+}
+
+// BeginTransaction begins a transaction like Begin, but the following
+// transfers of the device, with Transfer, TxMany or any other method,
+// are part of it until EndTransaction is called: the last message of
+// each transfer is sent with cs_change set, so with DevFS the kernel
+// leaves the chip select asserted after it returns. It lets the caller
+// decide what to transfer next while the device stays selected.
+//
+// The chip select stays asserted until EndTransaction, so a forgotten
+// call leaves the device selected, which may hang the bus for the
+// other devices and confuse the device itself. Submitted transfers
+// are part of the transaction as well.
+func (d *Device) BeginTransaction() error {
+	// The transaction is reserved before asserting the chip select,
+	// so that a concurrent call fails without touching it.
+	t := &Transaction{d: d}
+	if !d.held.CompareAndSwap(nil, t) {
+		return errBegun
+	}
+	if err := t.begin(); err != nil {
+		d.held.Store(nil)
+		return err
+	}
+	return nil
+}
+
+// EndTransaction ends the transaction begun with BeginTransaction
+// and deasserts the chip select, like Transaction.End.
+func (d *Device) EndTransaction() error {
+	t := d.held.Swap(nil)
+	if t == nil {
+		return errNotBegun
+	}
+	return t.End()
+}
+
+// holdCS returns msgs with CSChange set on the last message if the
+// device is in a transaction begun with BeginTransaction.
+func (d *Device) holdCS(msgs []driver.Message) []driver.Message {
+	if d.held.Load() == nil || len(msgs) == 0 || msgs[len(msgs)-1].CSChange {
+		return msgs
+	}
+	out := append([]driver.Message(nil), msgs...)
+	out[len(out)-1].CSChange = true
+	return out
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+func TestTransactionChipSelect(t *testing.T) {
+	var calls []string
+	c := &spitest.Conn{
+		TransferError: func(m driver.Message) error {
+			calls = append(calls, "transfer")
+			return nil
+		},
+	}
+	dev := &Device{conn: c}
+	dev.SetChipSelect(
+		func() error { calls = append(calls, "assert"); return nil },
+		func() error { calls = append(calls, "deassert"); return nil },
+	)
+	tx, err := dev.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := tx.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+			t.Fatalf("Transfer: %v", err)
+		}
+	}
+	if err := tx.End(); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+	want := []string{"assert", "transfer", "transfer", "transfer", "deassert"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls=%v, want %v", calls, want)
+	}
+	if err := tx.Transfer([]byte{1}, make([]byte, 1)); err != errEnded {
+		t.Errorf("Transfer after End=%v, want %v", err, errEnded)
+	}
+	if err := tx.End(); err != errEnded {
+		t.Errorf("End after End=%v, want %v", err, errEnded)
+	}
+
+	// Transfers outside of a transaction select the device again.
+	calls = nil
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if want := []string{"assert", "transfer", "deassert"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls after the transaction=%v, want %v", calls, want)
+	}
+}
+
+func TestTransactionGPIO(t *testing.T) {
+	s := &fakeSlave{}
+	s.out = bitsOf([]byte{0, 0x42}, false)
+	dev := &Device{conn: s.conn()}
+	tx, err := dev.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	// The second transfer depends on the response to the first one.
+	rx := make([]byte, 1)
+	if err := tx.Transfer([]byte{0x9f}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !bytes.Equal(rx, []byte{0}) {
+		t.Fatalf("first rx=% x, want 00", rx)
+	}
+	if err := tx.Transfer([]byte{0}, rx); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !bytes.Equal(rx, []byte{0x42}) {
+		t.Errorf("second rx=% x, want 42", rx)
+	}
+	if s.cs {
+		t.Errorf("cs deasserted during the transaction, want asserted")
+	}
+	if err := tx.End(); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+	if !s.cs || s.selects != 1 {
+		t.Errorf("cs=%t selects=%d, want deasserted after 1 select", s.cs, s.selects)
+	}
+}
+
+func TestBeginTransactionChipSelect(t *testing.T) {
+	var calls []string
+	c := &spitest.Conn{
+		TransferError: func(m driver.Message) error {
+			calls = append(calls, "transfer")
+			return nil
+		},
+	}
+	dev := &Device{conn: c}
+	dev.SetChipSelect(
+		func() error { calls = append(calls, "assert"); return nil },
+		func() error { calls = append(calls, "deassert"); return nil },
+	)
+	if err := dev.BeginTransaction(); err != nil {
+		t.Fatalf("BeginTransaction: %v", err)
+	}
+	if err := dev.Transfer([]byte{1}, make([]byte, 1)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := dev.Write3Wire([]byte{2}); err != nil {
+		t.Fatalf("Write3Wire: %v", err)
+	}
+	if err := dev.EndTransaction(); err != nil {
+		t.Fatalf("EndTransaction: %v", err)
+	}
+	want := []string{"assert", "transfer", "transfer", "transfer", "deassert"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls=%v, want %v", calls, want)
+	}
+	for i, m := range c.Transfers()[:2] {
+		if !m.CSChange {
+			t.Errorf("transfer %d: CSChange=false, want true", i)
+		}
+	}
+}
+
+func TestBeginTransactionBegun(t *testing.T) {
+	asserts, deasserts := 0, 0
+	dev := &Device{conn: &spitest.Conn{}}
+	dev.SetChipSelect(
+		func() error { asserts++; return nil },
+		func() error { deasserts++; return nil },
+	)
+	if err := dev.BeginTransaction(); err != nil {
+		t.Fatalf("BeginTransaction: %v", err)
+	}
+	// A second transaction fails without touching the chip select.
+	if err := dev.BeginTransaction(); err != errBegun {
+		t.Errorf("second BeginTransaction=%v, want %v", err, errBegun)
+	}
+	if asserts != 1 || deasserts != 0 {
+		t.Errorf("asserts=%d deasserts=%d, want 1, 0", asserts, deasserts)
+	}
+	if err := dev.EndTransaction(); err != nil {
+		t.Fatalf("EndTransaction: %v", err)
+	}
+	if asserts != 1 || deasserts != 1 {
+		t.Errorf("asserts=%d deasserts=%d, want 1, 1", asserts, deasserts)
+	}
+
+	// A failed assert leaves no transaction.
+	dev.SetChipSelect(func() error { return errors.New("no chip select") }, nil)
+	if err := dev.BeginTransaction(); err == nil {
+		t.Errorf("BeginTransaction with a failing chip select succeeded")
+	}
+	if err := dev.EndTransaction(); err != errNotBegun {
+		t.Errorf("EndTransaction after a failed BeginTransaction=%v, want %v", err, errNotBegun)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/exp/io/spi/driver"
+)
+
+// TransferWords16 is like Transfer but transfers 16-bit words.
+//
+// If the device uses 9 to 16 bits per word, each element is a word.
+// If it uses 8 bits per word or less, each element is transferred as
+// two words in the specified order: binary.BigEndian transfers the
+// most significant byte first. The order is ignored otherwise.
+// It is an error if the device uses more than 16 bits per word.
+func (d *Device) TransferWords16(tx, rx []uint16, order binary.ByteOrder) error {
+	if len(rx) != len(tx) {
+		return fmt.Errorf("rx length (%d) does not match tx length (%d)", len(rx), len(tx))
+	}
+	k, err := d.kernelWordSize(2)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 2*len(tx))
+	for i, w := range tx {
+		order.PutUint16(b[2*i:], w)
+	}
+	reorderWords(b, k, order)
+	if err := d.Transfer(b, b); err != nil {
+		return err
+	}
+	reorderWords(b, k, order)
+	for i := range rx {
+		rx[i] = order.Uint16(b[2*i:])
+	}
+	return nil
+}
+
+// TransferWords32 is like Transfer but transfers 32-bit words.
+//
+// If the device uses 17 to 32 bits per word, each element is a word.
+// If it uses fewer bits per word, each element is transferred as
+// two 16-bit words or four 8-bit words in the specified order:
+// binary.BigEndian transfers the most significant part first.
+// The order is ignored otherwise.
+func (d *Device) TransferWords32(tx, rx []uint32, order binary.ByteOrder) error {
+	if len(rx) != len(tx) {
+		return fmt.Errorf("rx length (%d) does not match tx length (%d)", len(rx), len(tx))
+	}
+	k, err := d.kernelWordSize(4)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 4*len(tx))
+	for i, w := range tx {
+		order.PutUint32(b[4*i:], w)
+	}
+	reorderWords(b, k, order)
+	if err := d.Transfer(b, b); err != nil {
+		return err
+	}
+	reorderWords(b, k, order)
+	for i := range rx {
+		rx[i] = order.Uint32(b[4*i:])
+	}
+	return nil
+}
+
+// PackWords returns the words of bits bits packed in bytes in the
+// specified byte order, as laid out in memory by the kernel for
+// the devices using bits bits per word: 8-bit words or smaller take
+// one byte, 9 to 16-bit words two bytes and 17 to 32-bit words four
+// bytes, e.g. 24-bit words take four bytes. The bits of the words
+// above bits are cleared. The kernel uses the host byte order,
+// see TransferWords16 and TransferWords32 to transfer words without
+// packing them. PackWords panics if bits is not between 1 and 32.
+func PackWords(words []uint32, bits int, order binary.ByteOrder) []byte {
+	k := packedWordSize(bits)
+	mask := uint32(1<<uint(bits) - 1)
+	b := make([]byte, k*len(words))
+	for i, w := range words {
+		w &= mask
+		switch k {
+		case 1:
+			b[i] = byte(w)
+		case 2:
+			order.PutUint16(b[2*i:], uint16(w))
+		default:
+			order.PutUint32(b[4*i:], w)
+		}
+	}
+	return b
+}
+
+// UnpackWords returns the words of bits bits packed in b as by
+// PackWords. A trailing partial word is ignored. UnpackWords panics
+// if bits is not between 1 and 32.
+func UnpackWords(b []byte, bits int, order binary.ByteOrder) []uint32 {
+	k := packedWordSize(bits)
+	mask := uint32(1<<uint(bits) - 1)
+	words := make([]uint32, len(b)/k)
+	for i := range words {
+		var w uint32
+		switch k {
+		case 1:
+			w = uint32(b[i])
+		case 2:
+			w = uint32(order.Uint16(b[2*i:]))
+		default:
+			w = order.Uint32(b[4*i:])
+		}
+		words[i] = w & mask
+	}
+	return words
+}
+
+// packedWordSize returns the size in bytes of the words of bits bits,
+// panicking if it is not a valid number of bits per word.
+func packedWordSize(bits int) int {
+	if bits < 1 || bits > 32 {
+		panic(fmt.Sprintf("spi: invalid number of bits per word: %d", bits))
+	}
+	return wordSize(bits)
+}
+
+// kernelWordSize returns the size in bytes of the words of the
+// device, checking that they fit in n bytes.
+func (d *Device) kernelWordSize(n int) (int, error) {
+	bits, err := d.conn.Query(driver.Bits)
+	if err != nil {
+		return 0, err
+	}
+	if bits == 0 {
+		bits = 8
+	}
+	k := wordSize(bits)
+	if k > n {
+		return 0, fmt.Errorf("%d-bit words do not fit in %d bytes", bits, n)
+	}
+	return k, nil
+}
+
+// reorderWords converts the k-byte words of b between the
+// specified byte order and the host byte order.
+func reorderWords(b []byte, k int, order binary.ByteOrder) {
+	if k == 1 || bigEndian(order) == bigEndian(nativeEndian) {
+		return
+	}
+	for i := 0; i+k <= len(b); i += k {
+		for j, l := i, i+k-1; j < l; j, l = j+1, l-1 {
+			b[j], b[l] = b[l], b[j]
+		}
+	}
+}
+
+func bigEndian(o binary.ByteOrder) bool {
+	var b [2]byte
+	o.PutUint16(b[:], 1)
+	return b[1] == 1
+}
+
+// nativeEndian is the byte order of the host, which the kernel
+// uses for the words that are larger than a byte.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// wordSize returns the number of bytes used to store
+// a word of the specified number of bits.
+func wordSize(bits int) int {
+	switch {
+	case bits <= 8:
+		return 1
+	case bits <= 16:
+		return 2
+	default:
+		return 4
+	}
+}
+
+func getWord(b []byte) uint32 {
+	switch len(b) {
+	case 1:
+		return uint32(b[0])
+	case 2:
+		return uint32(nativeEndian.Uint16(b))
+	default:
+		return nativeEndian.Uint32(b)
+	}
+}
+
+func putWord(b []byte, w uint32) {
+	switch len(b) {
+	case 1:
+		b[0] = byte(w)
+	case 2:
+		nativeEndian.PutUint16(b, uint16(w))
+	default:
+		nativeEndian.PutUint32(b, w)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/io/spi/driver"
+	"golang.org/x/exp/io/spi/spitest"
+)
+
+// native16 returns the bytes of the words ws in the host byte order,
+// as the kernel expects them.
+func native16(ws ...uint16) []byte {
+	b := make([]byte, 2*len(ws))
+	for i, w := range ws {
+		nativeEndian.PutUint16(b[2*i:], w)
+	}
+	return b
+}
+
+func TestTransferWords16(t *testing.T) {
+	tests := []struct {
+		bits  int
+		order binary.ByteOrder
+		want  []byte
+	}{
+		{bits: 8, order: binary.BigEndian, want: []byte{0x12, 0x34, 0xab, 0xcd}},
+		{bits: 8, order: binary.LittleEndian, want: []byte{0x34, 0x12, 0xcd, 0xab}},
+		{bits: 16, order: binary.BigEndian, want: native16(0x1234, 0xabcd)},
+		{bits: 16, order: binary.LittleEndian, want: native16(0x1234, 0xabcd)},
+		{bits: 12, order: binary.BigEndian, want: native16(0x1234, 0xabcd)},
+	}
+	for _, test := range tests {
+		c := &spitest.Conn{Reply: func(tx []byte) []byte { return tx }}
+		dev := &Device{conn: c}
+		if err := dev.SetBitsPerWord(test.bits); err != nil {
+			t.Fatalf("SetBitsPerWord: %v", err)
+		}
+		tx := []uint16{0x1234, 0xabcd}
+		rx := make([]uint16, len(tx))
+		if err := dev.TransferWords16(tx, rx, test.order); err != nil {
+			t.Errorf("bits=%d order=%v: TransferWords16: %v", test.bits, test.order, err)
+			continue
+		}
+		if got := c.Transfers()[0].Tx; !bytes.Equal(got, test.want) {
+			t.Errorf("bits=%d order=%v: transferred % x, want % x", test.bits, test.order, got, test.want)
+		}
+		if !reflect.DeepEqual(rx, tx) {
+			t.Errorf("bits=%d order=%v: rx=%#x, want %#x", test.bits, test.order, rx, tx)
+		}
+	}
+}
+
+func TestTransferWords32(t *testing.T) {
+	native := make([]byte, 4)
+	nativeEndian.PutUint32(native, 0x12345678)
+	tests := []struct {
+		bits  int
+		order binary.ByteOrder
+		want  []byte
+	}{
+		{bits: 8, order: binary.BigEndian, want: []byte{0x12, 0x34, 0x56, 0x78}},
+		{bits: 8, order: binary.LittleEndian, want: []byte{0x78, 0x56, 0x34, 0x12}},
+		{bits: 16, order: binary.BigEndian, want: native16(0x1234, 0x5678)},
+		{bits: 16, order: binary.LittleEndian, want: native16(0x5678, 0x1234)},
+		{bits: 32, order: binary.BigEndian, want: native},
+		{bits: 24, order: binary.LittleEndian, want: native},
+	}
+	for _, test := range tests {
+		c := &spitest.Conn{Reply: func(tx []byte) []byte { return tx }}
+		dev := &Device{conn: c}
+		if err := dev.SetBitsPerWord(test.bits); err != nil {
+			t.Fatalf("SetBitsPerWord: %v", err)
+		}
+		tx := []uint32{0x12345678}
+		rx := make([]uint32, len(tx))
+		if err := dev.TransferWords32(tx, rx, test.order); err != nil {
+			t.Errorf("bits=%d order=%v: TransferWords32: %v", test.bits, test.order, err)
+			continue
+		}
+		if got := c.Transfers()[0].Tx; !bytes.Equal(got, test.want) {
+			t.Errorf("bits=%d order=%v: transferred % x, want % x", test.bits, test.order, got, test.want)
+		}
+		if !reflect.DeepEqual(rx, tx) {
+			t.Errorf("bits=%d order=%v: rx=%#x, want %#x", test.bits, test.order, rx, tx)
+		}
+	}
+}
+
+func TestTransferWordsBigEndianHost(t *testing.T) {
+	// Simulate a big-endian host, on which the kernel expects
+	// the words larger than a byte in big-endian order.
+	defer func(o binary.ByteOrder) { nativeEndian = o }(nativeEndian)
+	nativeEndian = binary.BigEndian
+
+	tests := []struct {
+		bits  int
+		order binary.ByteOrder
+		want  []byte
+	}{
+		{bits: 8, order: binary.BigEndian, want: []byte{0x12, 0x34, 0x56, 0x78}},
+		{bits: 8, order: binary.LittleEndian, want: []byte{0x34, 0x12, 0x78, 0x56}},
+		{bits: 16, order: binary.BigEndian, want: []byte{0x12, 0x34, 0x56, 0x78}},
+		{bits: 16, order: binary.LittleEndian, want: []byte{0x12, 0x34, 0x56, 0x78}},
+	}
+	for _, test := range tests {
+		c := &spitest.Conn{Reply: func(tx []byte) []byte { return tx }}
+		dev := &Device{conn: c}
+		if err := dev.SetBitsPerWord(test.bits); err != nil {
+			t.Fatalf("SetBitsPerWord: %v", err)
+		}
+		tx := []uint16{0x1234, 0x5678}
+		rx := make([]uint16, len(tx))
+		if err := dev.TransferWords16(tx, rx, test.order); err != nil {
+			t.Errorf("bits=%d order=%v: TransferWords16: %v", test.bits, test.order, err)
+			continue
+		}
+		if got := c.Transfers()[0].Tx; !bytes.Equal(got, test.want) {
+			t.Errorf("bits=%d order=%v: transferred % x, want % x", test.bits, test.order, got, test.want)
+		}
+		if !reflect.DeepEqual(rx, tx) {
+			t.Errorf("bits=%d order=%v: rx=%#x, want %#x", test.bits, test.order, rx, tx)
+		}
+	}
+
+	// 32-bit words are a single kernel word in big-endian order.
+	c := &spitest.Conn{Reply: func(tx []byte) []byte { return tx }}
+	dev := &Device{conn: c}
+	if err := dev.SetBitsPerWord(32); err != nil {
+		t.Fatalf("SetBitsPerWord: %v", err)
+	}
+	rx := make([]uint32, 1)
+	if err := dev.TransferWords32([]uint32{0x12345678}, rx, binary.LittleEndian); err != nil {
+		t.Fatalf("TransferWords32: %v", err)
+	}
+	want := PackWords([]uint32{0x12345678}, 32, binary.BigEndian)
+	if got := c.Transfers()[0].Tx; !bytes.Equal(got, want) {
+		t.Errorf("TransferWords32 transferred % x, want % x", got, want)
+	}
+	if rx[0] != 0x12345678 {
+		t.Errorf("TransferWords32 rx=%#x, want 0x12345678", rx[0])
+	}
+}
+
+func TestTransferWordsErrors(t *testing.T) {
+	c := &spitest.Conn{}
+	dev := &Device{conn: c}
+	if err := dev.TransferWords16([]uint16{1, 2}, make([]uint16, 1), binary.BigEndian); err == nil {
+		t.Errorf("TransferWords16 with mismatched lengths succeeded, want error")
+	}
+	if err := c.Configure(driver.Bits, 24); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.TransferWords16([]uint16{1}, make([]uint16, 1), binary.BigEndian); err == nil {
+		t.Errorf("TransferWords16 with 24-bit words succeeded, want error")
+	}
+	if n := len(c.Transfers()); n != 0 {
+		t.Errorf("got %d transfers, want 0", n)
+	}
+}
+
+func TestPackWords(t *testing.T) {
+	tests := []struct {
+		bits   int
+		order  binary.ByteOrder
+		words  []uint32
+		packed []byte
+	}{
+		{9, binary.BigEndian, []uint32{0x1ff, 0x001}, []byte{0x01, 0xff, 0x00, 0x01}},
+		{9, binary.LittleEndian, []uint32{0x1ff, 0x001}, []byte{0xff, 0x01, 0x01, 0x00}},
+		{12, binary.BigEndian, []uint32{0xabc, 0x123}, []byte{0x0a, 0xbc, 0x01, 0x23}},
+		{12, binary.LittleEndian, []uint32{0xabc, 0x123}, []byte{0xbc, 0x0a, 0x23, 0x01}},
+		{16, binary.BigEndian, []uint32{0xabcd}, []byte{0xab, 0xcd}},
+		{16, binary.LittleEndian, []uint32{0xabcd}, []byte{0xcd, 0xab}},
+		{24, binary.BigEndian, []uint32{0xabcdef}, []byte{0x00, 0xab, 0xcd, 0xef}},
+		{24, binary.LittleEndian, []uint32{0xabcdef}, []byte{0xef, 0xcd, 0xab, 0x00}},
+		{8, binary.BigEndian, []uint32{0x12, 0x34}, []byte{0x12, 0x34}},
+		{32, binary.BigEndian, []uint32{0xffffffff}, []byte{0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, test := range tests {
+		if got := PackWords(test.words, test.bits, test.order); !bytes.Equal(got, test.packed) {
+			t.Errorf("PackWords(%x, %d, %v)=% x, want % x", test.words, test.bits, test.order, got, test.packed)
+		}
+		if got := UnpackWords(test.packed, test.bits, test.order); !reflect.DeepEqual(got, test.words) {
+			t.Errorf("UnpackWords(% x, %d, %v)=%x, want %x", test.packed, test.bits, test.order, got, test.words)
+		}
+	}
+
+	// The bits above the word size are cleared.
+	if got, want := PackWords([]uint32{0xffff}, 12, binary.BigEndian), []byte{0x0f, 0xff}; !bytes.Equal(got, want) {
+		t.Errorf("PackWords(ffff, 12)=% x, want % x", got, want)
+	}
+	if got, want := UnpackWords([]byte{0xff, 0xff, 0x01}, 12, binary.BigEndian), []uint32{0xfff}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnpackWords(ff ff 01, 12)=%x, want %x", got, want)
+	}
+}